@@ -0,0 +1,84 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var calendarCmd = &cobra.Command{
+	Use:   "calendar",
+	Short: "generate the liturgical calendar of a year",
+	Long: `generate the liturgical calendar of a year, with the liturgical day properties
+of each day (mode of the week, eothinon, day of the Triodion or Pentecostarion,
+week of Luke, fasting period and level) and the topics they resolve to.
+Use --year to set the year (default is this year), and --calendar julian for the Old calendar.
+Use --format ics to write iCalendar instead of json, and --file to write to a file
+instead of the terminal.  If the file ends with .ics, the format is ics.
+e.g. doxago calendar --year 2027 --file typikon2027.ics`,
+	Run: func(cmd *cobra.Command, args []string) {
+		year, _ := cmd.Flags().GetInt("year")
+		calendar, _ := cmd.Flags().GetString("calendar")
+		format, _ := cmd.Flags().GetString("format")
+		filename, _ := cmd.Flags().GetString("file")
+		if year == 0 {
+			year = time.Now().Year()
+		}
+		calendarType, err := ldp.ParseCalendarType(calendar)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !cmd.Flags().Changed("format") && strings.ToLower(filepath.Ext(filename)) == ".ics" {
+			format = "ics"
+		}
+		c, err := ldp.NewYearCalendar(year, calendarType)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var write func(io.Writer) error
+		switch strings.ToLower(format) {
+		case "json":
+			write = c.WriteJSON
+		case "ics":
+			write = c.WriteICS
+		default:
+			fmt.Printf("invalid format %s. Expected json or ics\n", format)
+			return
+		}
+		var w io.Writer = os.Stdout
+		if len(filename) > 0 {
+			f, err := os.Create(filename)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer f.Close()
+			w = f
+		}
+		if err = write(w); err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+			return
+		}
+		if len(filename) > 0 {
+			fmt.Printf("wrote the %s calendar of %d days of %d to %s\n", calendarType, len(c.Days), year, filename)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(calendarCmd)
+	calendarCmd.Flags().Int("year", 0, "the year of the calendar. Default is this year.")
+	calendarCmd.Flags().String("calendar", "gregorian", "gregorian (the Revised Julian or New calendar) or julian (the Old calendar)")
+	calendarCmd.Flags().String("format", "json", "json or ics")
+	calendarCmd.Flags().String("file", "", "the file to write. Default is the terminal.")
+}
@@ -0,0 +1,89 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// the check command groups the commands that check the integrity of the liturgical database
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "check the integrity of the liturgical database",
+	Long:  `check the integrity of the liturgical database, e.g. doxago check redirects`,
+}
+
+var checkRedirectsCmd = &cobra.Command{
+	Use:   "redirects",
+	Short: "report redirects that are dangling, cyclic, or to themselves",
+	Long: `follow the redirects in the liturgical database, and report, for each library,
+the redirects that are dangling (end at a record that does not exist), cyclic
+(return to a record already followed), or self referencing.
+Use --chains to also report redirects to a record that redirects in turn.
+Use --library to check a single library, e.g. --library gr_gr_cog.
+The exit status is 1 if there are problems.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		library, _ := cmd.Flags().GetString("library")
+		showChains, _ := cmd.Flags().GetBool("chains")
+		mapper, err := ltx2sql.NewLtxMapper(Paths.DbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer mapper.Close()
+		like := ""
+		if len(library) > 0 {
+			like = library + mapper.IDDelimiter() + "%"
+		}
+		report, err := ltxstore.CheckRedirects(mapper, like)
+		if err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+			return
+		}
+		for _, library := range report.Libraries() {
+			var lines []string
+			lines = append(lines, redirectProblems("dangling", library, report.Dangling)...)
+			lines = append(lines, redirectProblems("cyclic", library, report.Cyclic)...)
+			lines = append(lines, redirectProblems("self", library, report.Self)...)
+			if showChains {
+				lines = append(lines, redirectProblems("chain", library, report.Chains)...)
+			}
+			if len(lines) > 0 {
+				fmt.Println(library)
+				for _, line := range lines {
+					fmt.Println(line)
+				}
+			}
+		}
+		fmt.Printf("checked %d redirects: %d dangling, %d cyclic, %d self, %d chains\n",
+			report.Checked, len(report.Dangling), len(report.Cyclic), len(report.Self), len(report.Chains))
+		if !report.OK() {
+			mapper.Close()
+			os.Exit(1)
+		}
+	},
+}
+
+// redirectProblems formats the problems of the library, one per line
+func redirectProblems(kind, library string, problems []ltxstore.RedirectProblem) []string {
+	var lines []string
+	for _, p := range problems {
+		if p.Library == library {
+			lines = append(lines, fmt.Sprintf("  %-8s %s", kind, strings.Join(p.Chain, " => ")))
+		}
+	}
+	return lines
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.AddCommand(checkRedirectsCmd)
+	checkRedirectsCmd.Flags().String("library", "", "the library to check, e.g. gr_gr_cog. Default is all libraries.")
+	checkRedirectsCmd.Flags().Bool("chains", false, "also report chains of redirects")
+}
@@ -0,0 +1,99 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	SQL "database/sql"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+// the db command groups the commands that maintain the liturgical database
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "maintain the liturgical database",
+	Long:  `maintain the liturgical database, e.g. doxago db migrate`,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "upgrade (or downgrade) the schema of the liturgical database",
+	Long: `upgrade the schema of the liturgical database in place to the latest version.
+Use --to to migrate to a specific version, which can be lower than the current one.
+A downgrade drops the tables of the migrations it undoes, and what they hold.
+Version 0 drops the ltx table, that is, all the liturgical texts, so it also requires --force.
+Use doxago db version to see the current version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetInt("to")
+		force, _ := cmd.Flags().GetBool("force")
+		if to < 0 {
+			to = ltx2sql.LatestVersion()
+		}
+		db, err := SQL.Open("sqlite3", Paths.DbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer db.Close()
+		from, err := ltx2sql.SchemaVersion(db)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if from == to {
+			fmt.Printf("%s is already at schema version %d\n", Paths.DbPath, to)
+			return
+		}
+		if to < 1 && !force {
+			fmt.Printf("migrating %s to schema version %d would drop the ltx table and all the liturgical texts. Use --force to do it anyway.\n", Paths.DbPath, to)
+			return
+		}
+		for v := from; v > to && v <= len(ltx2sql.Migrations); v-- {
+			m := ltx2sql.Migrations[v-1]
+			fmt.Printf("undoing %d %s: %s\n", m.Version, m.Description, strings.ReplaceAll(m.Down, "\n", " "))
+		}
+		if err = ltx2sql.MigrateTo(db, to); err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+			return
+		}
+		fmt.Printf("migrated %s from schema version %d to %d\n", Paths.DbPath, from, to)
+	},
+}
+
+var dbVersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "show the schema version of the liturgical database",
+	Long:  `show the schema version of the liturgical database, and the latest version known to doxago`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := SQL.Open("sqlite3", Paths.DbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer db.Close()
+		v, err := ltx2sql.SchemaVersion(db)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("%s is at schema version %d. The latest version is %d.\n", Paths.DbPath, v, ltx2sql.LatestVersion())
+		for _, m := range ltx2sql.Migrations {
+			applied := " "
+			if m.Version <= v {
+				applied = "*"
+			}
+			fmt.Printf("%s %3d %s\n", applied, m.Version, m.Description)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbVersionCmd)
+	dbMigrateCmd.Flags().Int("to", -1, "the schema version to migrate to. Default is the latest.")
+	dbMigrateCmd.Flags().Bool("force", false, "migrate to version 0, which drops all the liturgical texts")
+}
@@ -0,0 +1,141 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2ares"
+	"github.com/liturgiko/doxa/pkg/db/ltx2csv"
+	"github.com/liturgiko/doxa/pkg/db/ltx2json"
+	"github.com/liturgiko/doxa/pkg/db/ltx2neo"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the export command groups the commands that write the liturgical database to files
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the liturgical database to files",
+	Long:  `export the liturgical database to files: doxago export ares, doxago export json, doxago export csv, or doxago export neo`,
+}
+
+var exportJsonCmd = &cobra.Command{
+	Use:   "json",
+	Short: "export the liturgical database to a json file",
+	Long: `export the liturgical database to a json array of records.
+Use --library to export a single library, e.g. --library gr_gr_cog,
+and --file to write to a file instead of the terminal.
+The file can be loaded using doxago load json from dir to sql --path file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		exportRecords(cmd, ltx2json.Write)
+	},
+}
+
+var exportCsvCmd = &cobra.Command{
+	Use:   "csv",
+	Short: "export the liturgical database to a csv file",
+	Long: `export the liturgical database to csv, with the columns ` + strings.Join(ltx2csv.Columns, ",") + `.
+Use --library to export a single library, e.g. --library gr_gr_cog,
+and --file to write to a file instead of the terminal.
+The file can be opened with a spreadsheet, and loaded using doxago load csv from dir to sql --path file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		exportRecords(cmd, ltx2csv.Write)
+	},
+}
+
+var exportNeoCmd = &cobra.Command{
+	Use:   "neo",
+	Short: "export the liturgical database to a Cypher script for neo4j",
+	Long: `export the liturgical database to a Cypher script that merges a Text node
+for each record, and a REDIRECTS_TO relationship for each redirect, into a neo4j graph.
+Use --library to export a single library, e.g. --library gr_gr_cog,
+and --file to write to a file instead of the terminal.
+Run the script using cypher-shell -f file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		exportRecords(cmd, ltx2neo.WriteCypher)
+	},
+}
+
+var exportAresCmd = &cobra.Command{
+	Use:   "ares",
+	Short: "export the liturgical database to AGES ares files",
+	Long: `export the liturgical database to AGES ares files, one per library and topic.
+By default, the files are written to the ares repositories cloned by doxago,
+so that the changes can be committed and pushed.  An existing ares file is
+rewritten in place, and keeps the order of its keys and its comments.  Use --dir to write elsewhere,
+and --library to export a single library, e.g. --library gr_gr_cog`,
+	Run: func(cmd *cobra.Command, args []string) {
+		library, _ := cmd.Flags().GetString("library")
+		dir, _ := cmd.Flags().GetString("dir")
+		if len(dir) == 0 {
+			dir = filepath.Join(Paths.ReposPath, "ares")
+		}
+		mapper, err := ltx2sql.NewLtxMapper(Paths.DbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer mapper.Close()
+		stats, err := ltx2ares.Export(mapper, library, dir)
+		if err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+		}
+		fmt.Printf("exported %s to %s: %s\n", Paths.DbPath, dir, stats)
+	},
+}
+
+// exportRecords writes the records of the library (or of all libraries) using write
+func exportRecords(cmd *cobra.Command, write func(io.Writer, []*models.Ltx) error) {
+	library, _ := cmd.Flags().GetString("library")
+	filename, _ := cmd.Flags().GetString("file")
+	mapper, err := ltx2sql.NewLtxMapper(Paths.DbPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer mapper.Close()
+	records, err := ltxstore.Records(mapper, library)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var w io.Writer = os.Stdout
+	if len(filename) > 0 {
+		f, err := os.Create(filename)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	if err = write(w, records); err != nil {
+		fmt.Println(err)
+		Logger.Println(err.Error())
+		return
+	}
+	if len(filename) > 0 {
+		fmt.Printf("exported %d records to %s\n", len(records), filename)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportAresCmd)
+	exportCmd.AddCommand(exportJsonCmd)
+	exportCmd.AddCommand(exportCsvCmd)
+	exportCmd.AddCommand(exportNeoCmd)
+	for _, c := range []*cobra.Command{exportJsonCmd, exportCsvCmd, exportNeoCmd} {
+		c.Flags().String("library", "", "the library to export, e.g. gr_gr_cog. Default is all libraries.")
+		c.Flags().String("file", "", "the file to write. Default is the terminal.")
+	}
+	exportAresCmd.Flags().String("library", "", "the library to export, e.g. gr_gr_cog. Default is all libraries.")
+	exportAresCmd.Flags().String("dir", "", "the directory to write the ares files to. Default is the ares repositories directory.")
+}
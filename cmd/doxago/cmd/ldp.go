@@ -0,0 +1,69 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var ldpCmd = &cobra.Command{
+	Use:   "ldp",
+	Short: "inspect the liturgical day properties of a date",
+	Long: `inspect the liturgical day properties (ldp) of a date, e.g. the mode of the week,
+the eothinon, the day of the movable cycle and of the Lukan cycle, and the oc, me, tr, pe,
+and le.* topics they resolve to.  The properties are written as json.
+Use --date to set the date (default is today), and --calendar julian for the Old calendar.
+Use --mode, --day, and --mcday to override the mode of the week, the day of the week,
+and the day of the movable cycle, as a template can.
+Use --rid, once for each rid, to see the topic/key a rid resolves to.  A rid can have
+@Mode and @Day overrides, as in a template.
+e.g. doxago ldp --date 2021-04-29 --rid "oc.*/ocVE.ApolTheotokionVM @Mode 3"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		date, _ := cmd.Flags().GetString("date")
+		calendar, _ := cmd.Flags().GetString("calendar")
+		var o ldp.Overrides
+		o.Mode, _ = cmd.Flags().GetInt("mode")
+		o.Day, _ = cmd.Flags().GetInt("day")
+		o.MovableCycleDay, _ = cmd.Flags().GetInt("mcday")
+		rids, _ := cmd.Flags().GetStringArray("rid")
+		calendarType, err := ldp.ParseCalendarType(calendar)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		t := time.Now()
+		if len(date) > 0 {
+			if t, err = time.Parse("2006-01-02", date); err != nil {
+				fmt.Printf("invalid date %s. Expected yyyy-mm-dd\n", date)
+				return
+			}
+		}
+		inspection, err := ldp.Inspect(t, calendarType, o, rids)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(inspection); err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ldpCmd)
+	ldpCmd.Flags().String("date", "", "the date, yyyy-mm-dd. Default is today.")
+	ldpCmd.Flags().String("calendar", "gregorian", "gregorian (the Revised Julian or New calendar) or julian (the Old calendar)")
+	ldpCmd.Flags().Int("mode", 0, "override the mode of the week, 1..8")
+	ldpCmd.Flags().Int("day", 0, "override the day of the week, 1..7, where Sunday is 1")
+	ldpCmd.Flags().Int("mcday", 0, "override the day of the movable cycle")
+	ldpCmd.Flags().StringArray("rid", nil, "a rid to resolve, e.g. \"oc.*/ocVE.ApolTheotokionVM @Mode 3\"")
+}
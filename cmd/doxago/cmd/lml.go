@@ -0,0 +1,97 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/parser"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the lml command groups the commands for LML templates
+var lmlCmd = &cobra.Command{
+	Use:   "lml",
+	Short: "work with LML templates",
+	Long:  `work with LML templates, e.g. doxago lml fmt`,
+}
+
+var lmlFmtCmd = &cobra.Command{
+	Use:   "fmt [files or directories]",
+	Short: "format LML templates in canonical form",
+	Long: `format LML templates in canonical form: ID, Type, and Status first, then the other
+properties in a fixed order, one statement per line, a tab of indentation for each block,
+if, switch, and case, and strings in double quotes.  Comments are kept.
+The arguments are templates, or directories whose .lml files are formatted.
+The default is the templates directory of doxa home.
+The files that change are rewritten, and their paths are printed.
+Use --check to only print the paths of the files that are not formatted, without rewriting them.
+Templates with syntax errors are not formatted, and their errors are printed.
+The exit status is 1 if a template has syntax errors, or with --check, if a template is not formatted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, _ := cmd.Flags().GetBool("check")
+		if len(args) == 0 {
+			args = []string{Paths.TemplatesPath}
+		}
+		var paths []string
+		for _, arg := range args {
+			err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() && (path == arg || strings.HasSuffix(path, parser.Extension)) {
+					paths = append(paths, path)
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Println(err)
+				Logger.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		failed := false
+		for _, path := range paths {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				fmt.Println(err)
+				Logger.Println(err.Error())
+				failed = true
+				continue
+			}
+			formatted, errors := parser.Format(path, string(b))
+			if len(errors) > 0 {
+				for _, e := range errors {
+					fmt.Printf("%s:%s\n", path, e.String())
+				}
+				failed = true
+				continue
+			}
+			if formatted == string(b) {
+				continue
+			}
+			fmt.Println(path)
+			if check {
+				failed = true
+				continue
+			}
+			if err = ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+				fmt.Println(err)
+				Logger.Println(err.Error())
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lmlCmd)
+	lmlCmd.AddCommand(lmlFmtCmd)
+	lmlFmtCmd.Flags().Bool("check", false, "print the templates that are not formatted, without rewriting them")
+}
@@ -24,18 +24,28 @@ import (
 	"fmt"
 	"github.com/liturgiko/doxa/pkg/config"
 	"github.com/liturgiko/doxa/pkg/db/lsql"
+	"github.com/liturgiko/doxa/pkg/db/ltx2csv"
+	"github.com/liturgiko/doxa/pkg/db/ltx2json"
+	"github.com/liturgiko/doxa/pkg/db/ltx2neo"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/mappers"
+	"github.com/liturgiko/doxa/pkg/models"
 	"github.com/liturgiko/doxa/pkg/utils/oslw"
 	"github.com/liturgiko/doxa/pkg/utils/repos"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"io"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 var dbFilename = "liturgical.db"
+var cypherFilename = "ltx.cypher"
 
 // vars for 'load' flags
 var (
@@ -46,6 +56,7 @@ var (
 	loadTexTmp bool
 	ares       = "ares"
 	cvs        = "cvs"
+	whatCsv    = "csv"
 	texRes     = "OSLW Resources"
 	texTmp     = "OSLW Templates"
 	whatJson   = "json"
@@ -84,6 +95,12 @@ load ares from github to sql
 or, you can just use the load command, and it will prompt
 you to enter each required piece of information, displaying
 the valid options at each point.
+To load ares files into an existing sqlite database, use --incremental.
+Only the files that changed since the last load are read, and keys that
+were edited locally are not overwritten.
+To load json or csv files (see doxago export json and doxago export csv
+for the formats) from a directory, use --path to specify the file, or the
+directory of files, to load.  The records are merged into the existing database.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -104,6 +121,7 @@ the valid options at each point.
 		// get the flags
 		printProgress, _ := cmd.Flags().GetBool("verbose")
 		useTestData, _ := cmd.Flags().GetBool("test")
+		incremental, _ := cmd.Flags().GetBool("incremental")
 		var theRepos []string
 		flagRepo, _ := cmd.Flags().GetString("cloneUrl")
 		if flagRepo != "" {
@@ -136,6 +154,17 @@ the valid options at each point.
 				Logger.Println(msg)
 				switch {
 				case toNeo:
+					count, err := writeCypher(mappers.Lp2Lt(repos.Ares2LpFromLocalDir(aresPath, "ares", printProgress, &Logger)))
+					reportCypher(count, err)
+				case toSql && incremental:
+					stats, err := lsql.AresDir2SqliteIncremental(aresPath, dbFilename, printProgress, &Logger)
+					if err != nil {
+						fmt.Println(err.Error())
+					}
+					fmt.Printf("\n%s", stats)
+					Logger.Println(stats)
+					fmt.Printf("\nFinished loading ares files into %s.", dbFilename)
+					fmt.Printf("\nCheck %s to see if there were errors.\n", LogFilename)
 				case toSql:
 					err := lsql.AresDir2Sqlite(aresPath, dbFilename, printProgress, &Logger)
 					if err != nil {
@@ -147,6 +176,17 @@ the valid options at each point.
 			case fromGithub:
 				switch {
 				case toNeo:
+					count, err := writeCypher(mappers.Lp2Lt(repos.Ares2LpFromGithub(theRepos, "ares", printProgress, &Logger)))
+					reportCypher(count, err)
+				case toSql && incremental:
+					stats, err := lsql.AresGithub2SqliteIncremental(theRepos, dbFilename, printProgress, &Logger)
+					if err != nil {
+						fmt.Println(err.Error())
+					}
+					fmt.Printf("\n%s", stats)
+					Logger.Println(stats)
+					fmt.Printf("\nFinished loading ares files into %s.", dbFilename)
+					fmt.Printf("\nCheck %s to see if there were errors.\n", LogFilename)
 				case toSql:
 					err := lsql.AresGithub2Sqlite(theRepos, dbFilename, printProgress, &Logger)
 					if err != nil {
@@ -163,8 +203,57 @@ the valid options at each point.
 				fmt.Println("What to load from is not defined.  Exiting.")
 				os.Exit(1)
 			}
-		case loadCvs:
-		case loadJson:
+		case loadCvs, loadJson:
+			suffix, read := ".json", ltx2json.Read
+			if loadCvs {
+				suffix, read = ".csv", ltx2csv.Read
+			}
+			switch {
+			case fromDir:
+				importPath, _ := cmd.Flags().GetString("path")
+				if len(importPath) == 0 {
+					importPath = filepath.Join(Paths.HomePath, "import")
+				}
+				msg = fmt.Sprintf("Reading from %s", importPath)
+				fmt.Println(msg)
+				Logger.Println(msg)
+				switch {
+				case toNeo:
+					records := make(chan *models.Ltx)
+					go func() {
+						_, err := readFiles(importPath, suffix, read, func(file string, r []*models.Ltx) (int, error) {
+							for _, l := range r {
+								if err := ltxstore.Normalize(l); err != nil {
+									return 0, err
+								}
+								records <- l
+							}
+							return len(r), nil
+						})
+						if err != nil {
+							fmt.Println(err.Error())
+							Logger.Println(err.Error())
+						}
+						close(records)
+					}()
+					count, err := writeCypher(records)
+					reportCypher(count, err)
+				case toSql:
+					count, err := loadFiles(importPath, suffix, read, dbFilename)
+					if err != nil {
+						fmt.Println(err.Error())
+						Logger.Println(err.Error())
+					}
+					fmt.Printf("\nFinished loading %d records into %s.", count, dbFilename)
+					fmt.Printf("\nCheck %s to see if there were errors.\n", LogFilename)
+				default:
+					fmt.Println("What to load into is not defined.  Exiting.")
+					os.Exit(1)
+				}
+			default:
+				fmt.Println("Only dir is supported for loading json or csv.  Exiting.")
+				os.Exit(1)
+			}
 		case loadTexRes:
 			oslwPath := path.Join(Paths.ReposPath, "oslw")
 			switch {
@@ -220,6 +309,109 @@ the valid options at each point.
 
 func init() {
 	rootCmd.AddCommand(loadCmd)
+	loadCmd.Flags().Bool("incremental", false, "load only the ares files that changed into the existing database, keeping local edits")
+	loadCmd.Flags().String("path", "", "the json or csv file, or directory of files, to load. Default is the import directory.")
+}
+
+// loadFiles reads the records from the file at path, or from each file in the
+// directory at path with the suffix, and merges them into the database.
+// Returns the number of records merged.
+func loadFiles(path, suffix string, read func(io.Reader) ([]*models.Ltx, error), dbname string) (int, error) {
+	mapper, err := ltx2sql.NewLtxMapper(dbname)
+	if err != nil {
+		return 0, err
+	}
+	defer mapper.Close()
+	return readFiles(path, suffix, read, func(file string, records []*models.Ltx) (int, error) {
+		n, err := ltxstore.Import(mapper, records)
+		if err == nil {
+			Logger.Printf("loaded %d records from %s", n, file)
+		}
+		return n, err
+	})
+}
+// readFiles reads the records from the file at path, or from each file in the
+// directory at path with the suffix, and passes the records of each file to handle.
+// Returns the sum of the counts returned by handle.
+func readFiles(path, suffix string, read func(io.Reader) ([]*models.Ltx, error), handle func(file string, records []*models.Ltx) (int, error)) (int, error) {
+	var files []string
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(strings.ToLower(p), suffix) {
+				files = append(files, p)
+			}
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		files = append(files, path)
+	}
+	var count int
+	for _, f := range files {
+		file, err := os.Open(f)
+		if err != nil {
+			return count, err
+		}
+		records, err := read(file)
+		file.Close()
+		if err != nil {
+			return count, fmt.Errorf("%s: %v", f, err)
+		}
+		n, err := handle(f, records)
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	return count, nil
+}
+// cypherPath returns the path of the Cypher script in the neo data directory
+func cypherPath() string {
+	return filepath.Join(DOXAHOME, config.DataDir, config.Neo, cypherFilename)
+}
+// writeCypher writes the records to a Cypher script in the neo data directory,
+// which can be run using cypher-shell to load them into neo4j.
+// Returns the number of records written.
+func writeCypher(records <-chan *models.Ltx) (int, error) {
+	path := cypherPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	c, err := ltx2neo.NewCypherWriter(f, ltx2neo.DefaultBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for l := range records {
+		if err == nil {
+			err = c.Write(l)
+		}
+	}
+	if err != nil {
+		return c.Nodes, err
+	}
+	err = c.Close()
+	return c.Nodes, err
+}
+func reportCypher(count int, err error) {
+	if err != nil {
+		fmt.Println(err.Error())
+		Logger.Println(err.Error())
+	}
+	path := cypherPath()
+	fmt.Printf("\nFinished writing %d records to %s.", count, path)
+	fmt.Printf("\nTo load them into neo4j, run cypher-shell -f %s", path)
+	fmt.Printf("\nCheck %s to see if there were errors.\n", LogFilename)
 }
 
 func setParameters(args []string) {
@@ -260,7 +452,7 @@ func setWhatFromArg(arg string) bool {
 		loadAres = true
 		return true
 	}
-	case cvs: {
+	case cvs, whatCsv: {
 		loadCvs = true
 		return true
 	}
@@ -0,0 +1,46 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/lsp"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "run a language server for LML templates over stdin and stdout",
+	Long: `run a language server for LML templates, for an editor that supports
+the Language Server Protocol.  The editor starts doxago lsp, and talks to it over
+stdin and stdout.  The server reports the errors in templates as they are edited,
+completes the topic and key of a sid or rid from the liturgical database,
+shows the text of a sid or rid in each library when hovering over it,
+and goes to the template of an insert.
+Use --templates to set the directory of the templates that are inserted.
+Since stdout is used by the protocol, errors are written to stderr and the log.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		templatesDir, _ := cmd.Flags().GetString("templates")
+		if len(templatesDir) == 0 {
+			templatesDir = Paths.TemplatesPath
+		}
+		mapper, err := ltx2sql.NewLtxMapper(Paths.DbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			Logger.Println(err.Error())
+			return
+		}
+		defer mapper.Close()
+		if err = lsp.NewServer(mapper, templatesDir).Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			Logger.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lspCmd)
+	lspCmd.Flags().String("templates", "", "the directory of the templates. Default is the templates directory of doxa home.")
+}
@@ -0,0 +1,109 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/paschalion"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var paschalionCmd = &cobra.Command{
+	Use:   "paschalion",
+	Short: "print or export the paschalion, the dates of the movable cycle, for a range of years",
+	Long: `print or export the paschalion, i.e. for each year the dates of the start of the Triodion,
+Clean Monday, Pascha, Ascension, Pentecost, and All Saints, the length of the Apostles' Fast,
+the Sundays after Theophany before the Triodion, the start of the Lukan cycle, and the Lukan jump.
+Use --from and --to to set the years (default is this year and the next nine),
+and --calendar julian for the Old calendar.
+Use --format json or csv to export the table, and --file to write to a file
+instead of the terminal.  If the file ends with .json or .csv, that is the format.
+e.g. doxago paschalion --from 2021 --to 2030 --calendar julian --file paschalion.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, _ := cmd.Flags().GetInt("from")
+		to, _ := cmd.Flags().GetInt("to")
+		calendar, _ := cmd.Flags().GetString("calendar")
+		format, _ := cmd.Flags().GetString("format")
+		filename, _ := cmd.Flags().GetString("file")
+		if from == 0 {
+			from = time.Now().Year()
+		}
+		if to == 0 {
+			to = from + 9
+		}
+		calendarType, err := ldp.ParseCalendarType(calendar)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !cmd.Flags().Changed("format") {
+			switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+			case ".json", ".csv":
+				format = ext[1:]
+			}
+		}
+		t, err := paschalion.NewTable(from, to, calendarType)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var write func(io.Writer) error
+		switch strings.ToLower(format) {
+		case "text":
+			write = func(w io.Writer) error { return writePaschalion(w, t) }
+		case "json":
+			write = t.WriteJSON
+		case "csv":
+			write = t.WriteCSV
+		default:
+			fmt.Printf("invalid format %s. Expected text, json, or csv\n", format)
+			return
+		}
+		var w io.Writer = os.Stdout
+		if len(filename) > 0 {
+			f, err := os.Create(filename)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer f.Close()
+			w = f
+		}
+		if err = write(w); err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+			return
+		}
+		if len(filename) > 0 {
+			fmt.Printf("wrote the %s paschalion of %d through %d to %s\n", calendarType, from, to, filename)
+		}
+	},
+}
+
+// writePaschalion writes the table as aligned columns
+func writePaschalion(w io.Writer, t *paschalion.Table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s calendar\n", t.Calendar)
+	fmt.Fprintln(tw, "year\ttriodion\tclean monday\tpascha\tascension\tpentecost\tall saints\tapostles' fast\tsundays before triodion\tlukan start\tlukan jump")
+	for _, y := range t.Years {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d\n", y.Year, y.TriodionStart, y.CleanMonday, y.Pascha,
+			y.Ascension, y.Pentecost, y.AllSaints, y.ApostlesFastDays, y.SundaysBeforeTriodion, y.LukanStart, y.LukanJump)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(paschalionCmd)
+	paschalionCmd.Flags().Int("from", 0, "the first year. Default is this year.")
+	paschalionCmd.Flags().Int("to", 0, "the last year. Default is nine years after the first.")
+	paschalionCmd.Flags().String("calendar", "gregorian", "gregorian (the Revised Julian or New calendar) or julian (the Old calendar)")
+	paschalionCmd.Flags().String("format", "text", "text, json, or csv")
+	paschalionCmd.Flags().String("file", "", "the file to write. Default is the terminal.")
+}
@@ -3,12 +3,12 @@
 package cmd
 
 import (
-	SQL "database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/c-bata/go-prompt"
 	"github.com/liturgiko/doxa/pkg/concord"
 	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/models"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh/terminal"
@@ -27,12 +27,13 @@ var shellCmd = &cobra.Command{
 	Long:  `provide a shell for accessing the liturgical database`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// open the database
-		db, err := SQL.Open("sqlite3", Paths.DbPath)
+		store, err := ltx2sql.NewLtxMapper(Paths.DbPath)
 		if err != nil {
 			log.Println(err.Error())
+			return
 		}
-		defer db.Close()
-		mapper.DB = db
+		defer store.Close()
+		mapper = store
 
 		settings.Padding.P1 = 4
 		settings.Padding.P2 = 50
@@ -68,11 +69,11 @@ func init() {
 	rootCmd.AddCommand(shellCmd)
 }
 
-var mapper = ltx2sql.LtxMapper{}
+var mapper ltxstore.LtxStore
 var conc concord.Concordance
 var commands []prompt.Suggest
 var suggestions []prompt.Suggest
-var pathDelimiter = mapper.IDDelimiter()
+var pathDelimiter = ltx2sql.IDDelimiter
 
 type Padding struct {
 	P1 int `json:"number"`
@@ -205,6 +206,9 @@ func executor(in string) {
 	case "cmp":
 		method = blocks[0]
 		compareValues()
+	case "cp", "mk", "mv", "rm":
+		method = blocks[0]
+		edit(blocks)
 	case "exit":
 		fmt.Println("Bye!")
 		os.Exit(0)
@@ -214,12 +218,18 @@ func executor(in string) {
 	case "help":
 		method = blocks[0]
 		showHelp()
+	case "history":
+		method = blocks[0]
+		showHistory()
 	case "lml":
 		method = blocks[0]
 		showTKAsLML()
 	case "ls":
 		method = blocks[0]
 		list(blocks)
+	case "revert":
+		method = blocks[0]
+		revert(blocks)
 	case "set":
 		// TODO: when ltx struct is modified to have properties for create/modify by whom, need to set these here.
 		method = blocks[0]
@@ -504,14 +514,16 @@ func appendCommands() {
 		{"cd ~", "CHANGE path to root"},
 		{"cd {number}", "After a find or ls, numbers can be used to change path, e.g. cd 244"},
 		{"cmp", "compare values for this topic/key. Must be 3 levels deep."},
-		{"cp", "*COPY contents"},
+		{"cp", "COPY a library, topic, or key to a new one, e.g. cp gr_gr_cog en_us_new. Use cp -n to see what would be copied."},
 		{"exit", "Exit Doxago Shell"},
-		{"find", "FIND records with specified value"},
+		{"find", "FIND records with specified value. If .exact is off, value is a query, e.g. find \"have mercy\" OR lord* NOT god"},
+		{"history", "Show the revision HISTORY of the current record. Must be 3 levels deep."},
 		{"lml", "Display topic/key in the format required for the Liturgical Markup Language."},
 		{"ls", "LIST contents. If at root, lists libraries. If 3 levels deep shows record value"},
-		{"mk", "*MAKE. At root, mk en_us_xyz makes library. 1 level deep, mk actors makes new topic, 3 deep mk Priest makes new key"},
-		{"mv", "*MOVE (rename) matching id to new id"},
-		{"rm", "*REMOVE for matching id"},
+		{"mk", "MAKE a new empty key, e.g. mk en_us_xyz/actors/Priest. 2 levels deep, mk Priest makes it in the topic. 3 deep, mk Deacon makes a sibling"},
+		{"mv", "MOVE (rename) a library, topic, or key, e.g. mv gr_gr_cog/actors gr_gr_cog/people. Redirects to it are changed. Use mv -n to see what would change."},
+		{"revert {number}", "REVERT the current record to a revision shown by history, e.g. revert 2"},
+		{"rm", "REMOVE a library, topic, or key, e.g. rm en_us_new. Use rm -n to see what would be removed, rm -f to remove even if other records redirect to it."},
 		{"set comment", "SET comment for current record. Must be 3 levels deep."},
 		{"set redirect", "SET redirect for current record. Must be 3 levels deep."},
 		{"set value", "SET value for current record. Must be 3 levels deep."},
@@ -654,32 +666,55 @@ func showValue(library, topic, key string) {
 	} else {
 		if rec != nil {
 			if len(rec.Redirect) > 0 {
-				fmt.Printf("Redirects to: 1 %s\n", rec.Redirect)
-				var id models.Id
-				err = id.Parse(rec.Redirect)
+				idMap.Reset()
+				to, chain, err := ltxstore.Resolve(mapper, rec.ID)
+				for i := 1; i < len(chain); i++ {
+					fmt.Printf("Redirects to: %d %s\n", i, chain[i])
+					idMap.Add(i, chain[i])
+				}
 				if err != nil {
 					fmt.Println(err)
 					return
 				}
-				idMap.Reset()
-				idMap.Add(1, rec.Redirect)
-				showValue(id.Domain.ToNeo(), id.Topic, id.Key)
-			} else {
-				if settings.ShowAll {
-					var jsonData []byte
-					jsonData, err := json.Marshal(rec)
-					if err != nil {
-						log.Println(err)
-					}
-					fmt.Println(string(jsonData))
-				} else {
-					fmt.Println(rec.Value)
+				if to == nil {
+					return
+				}
+				rec = to
+			}
+			if settings.ShowAll {
+				var jsonData []byte
+				jsonData, err := json.Marshal(rec)
+				if err != nil {
+					log.Println(err)
 				}
+				fmt.Println(string(jsonData))
+			} else {
+				fmt.Println(rec.Value)
 			}
 		}
 	}
 }
 
+// searchKey returns the first term of the query that occurs in the line,
+// so that it can be used as the key of a concordance line.
+func searchKey(line string, query *ltxstore.Query) string {
+	for _, term := range query.Terms() {
+		if strings.Contains(line, term) {
+			return term
+		}
+	}
+	// a prefix search or a phrase with punctuation in the line,
+	// so use the start of the first term
+	terms := query.Terms()
+	if len(terms) > 0 {
+		words := strings.Fields(terms[0])
+		if strings.Contains(line, words[0]) {
+			return words[0]
+		}
+	}
+	return ""
+}
+
 // escape quotes
 func escape(value string) string {
 	value = strconv.Quote(value)
@@ -783,6 +818,173 @@ func changeDirectory(blocks []string) {
 	setSuggestions()
 }
 
+// If the context is 3 levels deep, displays the revisions of the record, oldest first.
+// Each revision shows the value the record had before it was changed, and who changed it and when.
+func showHistory() {
+	if context.Depth() < 3 {
+		fmt.Println("You must be three levels deep to use this command.")
+		return
+	}
+	id := strings.Join([]string{context.Library, context.Topic, context.Key}, pathDelimiter)
+	revisions, err := mapper.History(id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("%s has not been changed.\n", id)
+		return
+	}
+	for _, r := range revisions {
+		fmt.Printf("%s\n", strings.Repeat("-", context.TWidth))
+		fmt.Printf("%*d | %s | %s\n", settings.Padding.P1, r.Revision, r.ChangedWhen, r.ChangedBy)
+		fmt.Printf("%s\n", strings.Repeat("-", context.TWidth))
+		if len(r.Redirect) > 0 {
+			fmt.Printf("Redirects to: %s\n", r.Redirect)
+		} else {
+			fmt.Println(r.Value)
+		}
+		if len(r.Comment) > 0 {
+			fmt.Printf("Comment: %s\n", r.Comment)
+		}
+	}
+	if settings.Hints {
+		fmt.Printf("\nHint: revert {number} to restore a revision, e.g. revert %d\n", len(revisions))
+	}
+}
+// If the context is 3 levels deep, reverts the record to the revision whose number is in blocks[1]
+func revert(blocks []string) {
+	if context.Depth() < 3 {
+		fmt.Println("You must be three levels deep to use this command.")
+		return
+	}
+	if len(blocks) != 2 {
+		fmt.Println("You must tell me which revision, e.g. revert 2. Use history to see the revisions.")
+		return
+	}
+	n, err := strconv.Atoi(blocks[1])
+	if err != nil {
+		fmt.Printf("%s is not a number. Use history to see the revisions.\n", blocks[1])
+		return
+	}
+	id := strings.Join([]string{context.Library, context.Topic, context.Key}, pathDelimiter)
+	err = mapper.Revert(id, n)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	showValue(context.Library, context.Topic, context.Key)
+}
+// Makes, copies, moves, or removes records, depending on blocks[0].
+// The paths are library, library/topic, or library/topic/key, or a number from the last ls or find.
+// A path without a delimiter is relative to the current path.
+// The flag -n (dry run) shows the changes without making them.  The flag -f forces rm.
+func edit(blocks []string) {
+	var options ltxstore.EditOptions
+	var args []string
+	for _, b := range blocks[1:] {
+		switch b {
+		case "":
+		case "-n":
+			options.DryRun = true
+		case "-f":
+			options.Force = true
+		default:
+			path, err := editPath(b)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			args = append(args, path)
+		}
+	}
+	var changes []ltxstore.Change
+	var err error
+	switch {
+	case blocks[0] == "mk" && len(args) == 1:
+		if len(strings.Split(args[0], pathDelimiter)) < 3 {
+			fmt.Printf("A library or topic exists once it has a key, e.g. mk %s%s...\n", args[0], pathDelimiter)
+			return
+		}
+		changes, err = ltxstore.Make(mapper, args[0], options)
+	case blocks[0] == "rm" && len(args) == 1:
+		changes, err = ltxstore.Remove(mapper, args[0], options)
+	case blocks[0] == "cp" && len(args) == 2:
+		changes, err = ltxstore.Copy(mapper, args[0], args[1], options)
+	case blocks[0] == "mv" && len(args) == 2:
+		changes, err = ltxstore.Move(mapper, args[0], args[1], options)
+	default:
+		for _, c := range commands {
+			if c.Text == blocks[0] {
+				fmt.Println(c.Description)
+			}
+		}
+		return
+	}
+	for _, c := range changes {
+		if options.DryRun || settings.ShowAll || len(changes) <= 20 {
+			fmt.Println(c)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if options.DryRun {
+		fmt.Printf("%d changes would be made. To make them, leave out -n.\n", len(changes))
+		return
+	}
+	fmt.Printf("%d changes made.\n", len(changes))
+	// the current path might not exist any more
+	switch blocks[0] {
+	case "mv":
+		if context.Path == args[0] || strings.HasPrefix(context.Path, args[0]+pathDelimiter) {
+			setContextPath(args[1] + strings.TrimPrefix(context.Path, args[0]))
+		}
+	case "rm":
+		if context.Path == args[0] || strings.HasPrefix(context.Path, args[0]+pathDelimiter) {
+			context.Path = resetPath()
+		}
+	}
+	setSuggestions()
+}
+
+// editPath returns the path for an argument of mk, cp, mv, or rm
+func editPath(arg string) (string, error) {
+	if isNumber(arg) {
+		index, _ := strconv.Atoi(arg)
+		id, ok := idMap.Map[index]
+		if !ok || !id.HasValues() {
+			return "", fmt.Errorf("%s not found", arg)
+		}
+		return id.ToPath(), nil
+	}
+	arg = strings.Trim(arg, pathDelimiter)
+	if arg == "." {
+		return context.Path, nil
+	}
+	if strings.Contains(arg, pathDelimiter) {
+		return arg, nil
+	}
+	switch context.Depth() {
+	case 0:
+		return arg, nil
+	case 3:
+		return context.Library + pathDelimiter + context.Topic + pathDelimiter + arg, nil
+	default:
+		return context.Path + pathDelimiter + arg, nil
+	}
+}
+
+// sets the context Library, Topic, and Key using a path
+func setContextPath(path string) {
+	resetPath()
+	for _, segment := range strings.Split(path, pathDelimiter) {
+		pushPath(segment)
+	}
+	context.Path = context.GetPath()
+}
+
 // If the context is 3 levels deep, i.e. library/topic/key, displays value of all records with the same topic/key
 func compareValues() {
 	idMap.Reset()
@@ -854,23 +1056,32 @@ func find(blocks []string) {
 			}
 			id = sb.String()
 		}
+		// if exact is off, the full text index is used, so the value is a search query,
+		// e.g. "have mercy" OR lord*
+		var query *ltxstore.Query
 		if settings.Exact {
 			recs, err = mapper.ReadByValue(id, value)
 		} else {
-			recs, err = mapper.ReadByNNP(id, value)
+			q := strings.Join(blocks[1:], " ")
+			query, err = ltxstore.ParseQuery(q)
+			if err == nil {
+				recs, err = mapper.Search(q, ltxstore.SearchOptions{Column: "nnp", Like: id})
+			}
 		}
 		if err != nil {
 			fmt.Println(err)
 		} else {
 			for _, rec := range recs {
 				var line = ""
+				var key = value
 				if settings.Exact {
 					line = rec.Value
 				} else {
 					line = rec.NNP
+					key = searchKey(line, query)
 				}
 
-				conc.Line(fmt.Sprintf("%*s", settings.Padding.P2, rec.ID), line, value, settings.Width)
+				conc.Line(fmt.Sprintf("%*s", settings.Padding.P2, rec.ID), line, key, settings.Width)
 			}
 			for i, res := range concord.SortedKeys(conc.Map, settings.Sort) {
 				idMap.Add(i+1, conc.Map[res].ID)
@@ -907,7 +1118,6 @@ func showHelp() {
 		fmt.Printf("%s:\t%s\n", command.Text, command.Description)
 	}
 	fmt.Println("")
-	fmt.Println("* indicates a command that is not available yet.")
 	fmt.Println("Commands that start with a dot are for the settings.")
 	fmt.Println("The settings affect the way the other commands behave.")
 	fmt.Printf("As you type, suggestions will appear as a pop up.\nTab to set focus on the pop up.\nYou can scroll up or down using the arrow keys.\nUse the <Enter> key to select an item in the pop up.\n")
@@ -0,0 +1,74 @@
+// Copyright © 2020 The Orthodox Christian Mission Center (ocmc.org)
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/typikon"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var typikonCmd = &cobra.Command{
+	Use:   "typikon",
+	Short: "rank the commemorations of a date using the rules of a typikon",
+	Long: `rank the commemorations of a date, and report the variant of the services,
+using the rules of the typikon in a library, i.e. the records of the topic typikon,
+which are loaded from ares files like any other records, e.g. typikon_gr_GR_cog.ares.
+Use --library to set the library, --date to set the date (default is today),
+and --calendar julian for the Old calendar.
+e.g. doxago typikon --library gr_gr_cog --date 2021-04-29`,
+	Run: func(cmd *cobra.Command, args []string) {
+		library, _ := cmd.Flags().GetString("library")
+		date, _ := cmd.Flags().GetString("date")
+		calendar, _ := cmd.Flags().GetString("calendar")
+		calendarType, err := ldp.ParseCalendarType(calendar)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		t := time.Now()
+		if len(date) > 0 {
+			if t, err = time.Parse("2006-01-02", date); err != nil {
+				fmt.Printf("invalid date %s. Expected yyyy-mm-dd\n", date)
+				return
+			}
+		}
+		l, err := ldp.NewLDPYMD(t.Year(), int(t.Month()), t.Day(), calendarType)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		mapper, err := ltx2sql.NewLtxMapper(Paths.DbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer mapper.Close()
+		rules, err := typikon.ReadRules(mapper, library)
+		if err != nil {
+			fmt.Println(err)
+			Logger.Println(err.Error())
+			return
+		}
+		day := rules.Evaluate(&l)
+		fmt.Printf("%s (%s calendar, %d rules)\n", day.Date, calendarType, len(rules.Commemorations)+len(rules.Collisions))
+		for i, c := range day.Commemorations {
+			fmt.Printf("%3d. %-30s rank %d %s\n", i+1, c.Name, c.Rank, c.Variant)
+		}
+		if len(day.Variant) > 0 {
+			fmt.Printf("variant: %s (rule %s)\n", day.Variant, day.VariantRule)
+		} else {
+			fmt.Println("variant: none")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(typikonCmd)
+	typikonCmd.Flags().String("library", "gr_gr_cog", "the library of the typikon rules")
+	typikonCmd.Flags().String("date", "", "the date, yyyy-mm-dd. Default is today.")
+	typikonCmd.Flags().String("calendar", "gregorian", "gregorian (the Revised Julian or New calendar) or julian (the Old calendar)")
+}
@@ -152,6 +152,63 @@ func ToRedirectId(value string) (string, error) {
 	}
 }
 
+// Converts an id from this form: en_us_lash/properties/media.key
+// To this form: properties_en_US_lash.media.key
+// It is the inverse of ToRedirectId.
+func ToAresRedirect(id string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(id), "/")
+	if len(parts) != 3 {
+		return id, ErrRedirectInvalid
+	}
+	domain, err := toAresDomain(parts[0])
+	if err != nil {
+		return id, err
+	}
+	return parts[1] + "_" + domain + "." + parts[2], nil
+}
+
+// Returns the name of the ares file for a library and topic,
+// e.g. actors_gr_GR_cog.ares for gr_gr_cog and actors
+func FileName(library, topic string) (string, error) {
+	domain, err := toAresDomain(library)
+	if err != nil {
+		return "", err
+	}
+	return topic + "_" + domain + ".ares", nil
+}
+
+// Formats a line of an ares file.  If redirect is not empty,
+// it is written instead of the value, in the form used by ares files.
+// Note that ParseLine cannot read back a comment after a value that contains //.
+func FormatLine(key, value, redirect, comment string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(key)
+	sb.WriteString(" = ")
+	if len(redirect) > 0 {
+		r, err := ToAresRedirect(redirect)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(r)
+	} else {
+		sb.WriteString(strconv.Quote(value))
+	}
+	if len(comment) > 0 {
+		sb.WriteString(" // ")
+		sb.WriteString(comment)
+	}
+	return sb.String(), nil
+}
+
+// converts a library, e.g. en_us_lash, to the form used in ares file names, e.g. en_US_lash
+func toAresDomain(library string) (string, error) {
+	parts := strings.Split(library, "_")
+	if len(parts) != 3 {
+		return library, ErrFileMissingTopic
+	}
+	return strings.ToLower(parts[0]) + "_" + strings.ToUpper(parts[1]) + "_" + strings.ToLower(parts[2]), nil
+}
+
 // CleanAres cleans Ares files by finding and fixing the following problems:
 //
 // When finds a value that starts with quote but does not end with one,
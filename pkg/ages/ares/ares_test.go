@@ -327,3 +327,42 @@ func TestCleanAres(t *testing.T) {
 	}
 }
 
+
+// Test that ToAresRedirect is the inverse of ToRedirectId
+func TestToAresRedirect(t *testing.T) {
+	for _, value := range []string{"properties_en_US_lash.media.key", "actors_gr_GR_cog.Priest"} {
+		id, err := ToRedirectId(value)
+		if err != nil {
+			t.Fatalf("ToRedirectId(%s): %v", value, err)
+		}
+		got, err := ToAresRedirect(id)
+		if err != nil {
+			t.Fatalf("ToAresRedirect(%s): %v", id, err)
+		}
+		if got != value {
+			t.Errorf("ToAresRedirect(%s): expected %s, got %s", id, value, got)
+		}
+	}
+	if _, err := ToAresRedirect("gr_gr_cog/actors"); err == nil {
+		t.Error("ToAresRedirect(gr_gr_cog/actors): expected an error")
+	}
+}
+
+// Test that a formatted line parses back to the same key, value, and comment
+func TestFormatLine(t *testing.T) {
+	line, err := FormatLine("Priest", "Ὁ \"Ἱερεύς\"", "", "a comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineParts, err := ParseLine(fnp, line)
+	if err != nil {
+		t.Fatalf("ParseLine(%s): %v", line, err)
+	}
+	if lineParts.Key != "Priest" || lineParts.Value != "Ὁ \"Ἱερεύς\"" || lineParts.Comment != "a comment" {
+		t.Errorf("FormatLine, round trip failed: %s", line)
+	}
+	line, _ = FormatLine("Deacon", "", "gr_gr_cog/actors/Priest", "")
+	if line != "Deacon = actors_gr_GR_cog.Priest" {
+		t.Errorf("FormatLine redirect, got %s", line)
+	}
+}
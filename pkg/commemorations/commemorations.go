@@ -0,0 +1,158 @@
+/**
+Package commemorations looks up who is commemorated on a date, i.e. the saints and events of the day,
+using the synaxarion (sy) records of a library.
+
+The commemorations of the fixed cycle are in the topic sy.mMM.dDD, where MM and DD are the
+month and day of the Menaion date, as computed by ldp.RelativeTopic, e.g. sy.m01.d01.
+The commemorations of the movable cycle are in the topic sy.dNNN, where NNN is the day of
+the Triodion or Pentecostarion (the same day used for the topics tr and pe), e.g. sy.d071 for Pascha.
+
+A commemoration is a pair of records whose keys are its name followed by .title and .life, e.g.
+
+  sy.m01.d01/basil.title = "Basil the Great, Archbishop of Caesarea in Cappadocia"
+  sy.m01.d01/basil.life = "Saint Basil was born in 330 ..."
+
+The title is required; the short life is optional.  Within a topic, the commemorations are
+ordered by name, so names can start with a number to set the order, e.g. 01.circumcision.
+The commemorations of the fixed cycle are listed before those of the movable cycle.
+ */
+package commemorations
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"sort"
+	"strings"
+)
+
+// Suffixes of the keys of a commemoration
+const (
+	TitleSuffix = ".title"
+	LifeSuffix  = ".life"
+)
+
+// Cycles of a commemoration
+const (
+	Fixed   = "fixed"
+	Movable = "movable"
+)
+
+// Commemoration is a saint or event commemorated on a day
+type Commemoration struct {
+	ID    string `json:"id"` // library, topic, and name, joined by the delimiter of the store
+	Name  string `json:"name"`
+	Cycle string `json:"cycle"`
+	Title string `json:"title"`
+	Life  string `json:"life,omitempty"`
+}
+
+// Day holds the commemorations of a date in a library
+type Day struct {
+	Date           string          `json:"date"`
+	Library        string          `json:"library"`
+	Topics         []string        `json:"topics"` // the synaxarion topics of the date
+	Commemorations []Commemoration `json:"commemorations"`
+}
+
+// Topics returns the synaxarion topics of the liturgical day: the topic of the fixed cycle,
+// and, in the Triodion or Pentecostarion, the topic of the movable cycle.
+func Topics(l *ldp.LDP) []string {
+	topics := []string{l.RelativeTopic("sy.*", 0, 0)}
+	if topic := MovableTopic(l); len(topic) > 0 {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// MovableTopic returns the synaxarion topic of the movable cycle of the liturgical day,
+// or an empty string if the day is not in the Triodion or Pentecostarion.
+func MovableTopic(l *ldp.LDP) string {
+	if l.DayOfSeason < 1 {
+		return ""
+	}
+	return fmt.Sprintf("sy.d%03d", l.DayOfSeason)
+}
+
+// Service looks up commemorations in a store
+type Service struct {
+	store ltxstore.LtxStore
+}
+
+// NewService returns a service that reads the synaxarion records from the store
+func NewService(store ltxstore.LtxStore) *Service {
+	return &Service{store: store}
+}
+
+// Lookup returns the commemorations of the liturgical day in the library
+func (s *Service) Lookup(l *ldp.LDP, library string) (*Day, error) {
+	day := &Day{
+		Date:           l.TheDay.Format("2006-01-02"),
+		Library:        library,
+		Topics:         Topics(l),
+		Commemorations: []Commemoration{},
+	}
+	for i, topic := range day.Topics {
+		cycle := Fixed
+		if i > 0 {
+			cycle = Movable
+		}
+		commemorations, err := s.read(library, topic, cycle)
+		if err != nil {
+			return nil, err
+		}
+		day.Commemorations = append(day.Commemorations, commemorations...)
+	}
+	return day, nil
+}
+
+// read returns the commemorations of the topic in the library, ordered by name
+func (s *Service) read(library, topic, cycle string) ([]Commemoration, error) {
+	records, err := s.store.ReadByLT(library, topic, true)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Commemoration)
+	for _, record := range records {
+		var name string
+		isTitle := strings.HasSuffix(record.Key, TitleSuffix)
+		switch {
+		case isTitle:
+			name = strings.TrimSuffix(record.Key, TitleSuffix)
+		case strings.HasSuffix(record.Key, LifeSuffix):
+			name = strings.TrimSuffix(record.Key, LifeSuffix)
+		default:
+			continue
+		}
+		value := record.Value
+		if len(record.Redirect) > 0 {
+			to, _, err := ltxstore.Resolve(s.store, record.ID)
+			if err != nil {
+				return nil, err
+			}
+			value = to.Value
+		}
+		c, ok := byName[name]
+		if !ok {
+			c = &Commemoration{
+				ID:    strings.Join([]string{library, topic, name}, s.store.IDDelimiter()),
+				Name:  name,
+				Cycle: cycle,
+			}
+			byName[name] = c
+		}
+		if isTitle {
+			c.Title = value
+		} else {
+			c.Life = value
+		}
+	}
+	var commemorations []Commemoration
+	for _, c := range byName {
+		if len(c.Title) > 0 {
+			commemorations = append(commemorations, *c)
+		}
+	}
+	sort.Slice(commemorations, func(i, j int) bool { return commemorations[i].Name < commemorations[j].Name })
+	return commemorations, nil
+}
@@ -0,0 +1,72 @@
+package commemorations
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/models"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	for _, r := range []struct {
+		library, topic, key, value, redirect string
+	}{
+		{"en_us_goa", "sy.m03.d25", "annunciation.title", "The Annunciation of the Theotokos", ""},
+		{"en_us_goa", "sy.m03.d25", "annunciation.life", "The Archangel Gabriel was sent ...", ""},
+		{"en_us_goa", "sy.m03.d25", "01.synaxis.life", "a life without a title", ""},
+		{"en_us_goa", "sy.m03.d25", "note", "not a commemoration", ""},
+		{"en_us_goa", "sy.d033", "canon.title", "The Great Canon of Saint Andrew of Crete", ""},
+		{"en_us_goa", "sy.m03.d12", "theophanes.title", "Theophanes the Confessor", ""},
+		{"en_us_dedes", "sy.m03.d25", "annunciation.title", "", "en_us_goa/sy.m03.d25/annunciation.title"},
+	} {
+		store.Merge(models.NewLtx(r.library, r.topic, r.key, r.value, "", r.redirect))
+	}
+	service := NewService(store)
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		library          string
+		expected         []string
+	}{
+		{2021, 3, 25, calendarTypes.Gregorian, "en_us_goa", []string{"The Annunciation of the Theotokos", "The Great Canon of Saint Andrew of Crete"}},
+		{2021, 3, 25, calendarTypes.Julian, "en_us_goa", []string{"Theophanes the Confessor", "The Great Canon of Saint Andrew of Crete"}},
+		{2021, 3, 25, calendarTypes.Gregorian, "en_us_dedes", []string{"The Annunciation of the Theotokos"}},
+		{2020, 3, 25, calendarTypes.Gregorian, "gr_gr_cog", nil},
+	}
+	for _, d := range data {
+		l, err := ldp.NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		day, err := service.Lookup(&l, d.library)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(day.Commemorations) != len(d.expected) {
+			t.Errorf("%s %s %s: expected %d commemorations, got %+v", day.Date, d.calendarType, d.library, len(d.expected), day.Commemorations)
+			continue
+		}
+		for i, c := range day.Commemorations {
+			if c.Title != d.expected[i] {
+				t.Errorf("%s %s %s: expected %s, got %s", day.Date, d.calendarType, d.library, d.expected[i], c.Title)
+			}
+		}
+	}
+	l, err := ldp.NewLDPYMD(2021, 3, 25, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day, err := service.Lookup(&l, "en_us_goa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := day.Commemorations[0]
+	if c.ID != "en_us_goa/sy.m03.d25/annunciation" || c.Cycle != Fixed || c.Life != "The Archangel Gabriel was sent ..." {
+		t.Errorf("unexpected %+v", c)
+	}
+	if day.Commemorations[1].Cycle != Movable {
+		t.Errorf("expected the second commemoration to be of the movable cycle, got %+v", day.Commemorations[1])
+	}
+}
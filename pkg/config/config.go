@@ -15,6 +15,7 @@ const (
 	DataDir = "data"
 	HTTPDir = "http"
 	LogDir = "logs"
+	Neo = "neo"
 	ReposDir = "repos"
 	Site = "site"
 	SQL = "sql"
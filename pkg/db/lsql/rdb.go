@@ -10,6 +10,7 @@ import (
 	"fmt"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/jmoiron/sqlx"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
 	"github.com/liturgiko/doxa/pkg/mappers"
 	"github.com/liturgiko/doxa/pkg/models"
 	"github.com/liturgiko/doxa/pkg/utils/repos"
@@ -41,6 +42,16 @@ func CreateSchema(schema string, dbname string) error {
 	return err
 }
 
+// Create or upgrade the schema in a Sqlite3 database opened using a supplied path (dbname)
+func MigrateSchema(dbname string) error {
+	db, err := sqlx.Connect("sqlite3", dbname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return ltx2sql.MigrateUp(db.DB)
+}
+
 // Using the repo urls loads the repos into memory from Github, then writes the lines from each file into the database.
 func AresGithub2Sqlite(
 	urls []string,
@@ -54,7 +65,7 @@ func AresGithub2Sqlite(
 		os.Remove(dbname)
 	}
 	// set up the schema
-	err = CreateSchema(models.LtxSchema, dbname)
+	err = MigrateSchema(dbname)
 	if err == nil {
 		// open the database
 		var db *sqlx.DB
@@ -78,6 +89,10 @@ func AresGithub2Sqlite(
 			}
 		}
 		err = tx.Commit()
+		if err == nil {
+			// the search index is created after loading, since that is faster than maintaining it row by row
+			check(ltx2sql.CreateSearchIndex(db.DB), logger)
+		}
 	}
 	return err
 }
@@ -95,7 +110,7 @@ func AresDir2Sqlite(
 		os.Remove(dbname)
 	}
 	// set up the schema
-	err = CreateSchema(models.LtxSchema, dbname)
+	err = MigrateSchema(dbname)
 	if err == nil {
 		// open the database
 		var db *sqlx.DB
@@ -116,6 +131,7 @@ func AresDir2Sqlite(
 				}
 			}
 		}
+		check(ltx2sql.CreateSearchIndex(db.DB), logger)
 	}
 	return err
 }
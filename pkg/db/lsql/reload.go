@@ -0,0 +1,499 @@
+package lsql
+
+// Incremental loading of ares files.  Instead of recreating the database,
+// only the ares files that changed since they were last loaded are read,
+// and only the keys whose value, redirect, or comment changed are written.
+// Keys that were edited (or deleted) locally since they were loaded are
+// preserved, i.e. the ares file does not overwrite them.
+// The hashes needed to do this are kept in the tables ares_file and ares_key.
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/ages/ares"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/mappers"
+	"github.com/liturgiko/doxa/pkg/models"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AresUser is recorded in ltx_history as the user for changes made by loading ares files
+const AresUser = "ares"
+
+// ReloadStats reports what an incremental load did
+type ReloadStats struct {
+	FilesUnchanged int // ares files (or repositories) skipped because they have not changed
+	FilesLoaded    int // ares files read because they are new or changed
+	FilesRemoved   int // ares files that no longer exist
+	Inserted       int // keys added
+	Updated        int // keys changed
+	Deleted        int // keys removed from their ares file
+	Preserved      int // keys not changed because they were edited locally
+}
+
+func (s ReloadStats) String() string {
+	return fmt.Sprintf("files: %d unchanged, %d loaded, %d removed; keys: %d inserted, %d updated, %d deleted, %d preserved local edits",
+		s.FilesUnchanged, s.FilesLoaded, s.FilesRemoved, s.Inserted, s.Updated, s.Deleted, s.Preserved)
+}
+
+// Reads lines from ares files in local directories,
+// and writes to the database the keys that changed since the last load.
+// Unlike AresDir2Sqlite, the database is not recreated.
+func AresDir2SqliteIncremental(
+	rootDir string,
+	dbname string,
+	printProgress bool,
+	logger *log.Logger,
+) (ReloadStats, error) {
+	r, err := newReloader(dbname, logger)
+	if err != nil {
+		return ReloadStats{}, err
+	}
+	defer r.close()
+	seen := make(map[string]bool)
+	err = filepath.Walk(rootDir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".ares") {
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(rootDir, path)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(name)
+			seen[name] = true
+			sum := sha1.Sum(content)
+			if printProgress {
+				fmt.Printf("\r%-80s", "")
+				fmt.Printf("\rProcessing %s", name)
+			}
+			return r.load(name, hex.EncodeToString(sum[:]), func() ([]string, error) {
+				return strings.Split(string(content), "\n"), nil
+			})
+		})
+	if printProgress {
+		fmt.Println()
+	}
+	if err != nil {
+		return r.stats, err
+	}
+	// files loaded from github have the repository url in their name
+	err = r.removeFiles(func(name string) bool {
+		return !strings.Contains(name, "://") && !seen[name]
+	})
+	return r.stats, err
+}
+
+// Using the repo urls, writes to the database the keys that changed since the last load.
+// A repository whose latest commit was already loaded is not cloned.
+// Unlike AresGithub2Sqlite, the database is not recreated.
+func AresGithub2SqliteIncremental(
+	urls []string,
+	dbname string,
+	printProgress bool,
+	logger *log.Logger,
+) (ReloadStats, error) {
+	r, err := newReloader(dbname, logger)
+	if err != nil {
+		return ReloadStats{}, err
+	}
+	defer r.close()
+	for i, url := range urls {
+		if printProgress {
+			fmt.Printf("Processing %d/%d: %s\n", i+1, len(urls), url)
+		}
+		head, err := remoteHead(url)
+		if err != nil {
+			logger.Printf("%s: %v", url, err)
+		} else if loaded, found, _ := r.fileHash(url); found && loaded == head {
+			r.stats.FilesUnchanged++
+			continue
+		}
+		repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url})
+		if err != nil {
+			return r.stats, fmt.Errorf("%s: %v", url, err)
+		}
+		ref, err := repo.Head()
+		if err != nil {
+			return r.stats, fmt.Errorf("%s: %v", url, err)
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return r.stats, fmt.Errorf("%s: %v", url, err)
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return r.stats, fmt.Errorf("%s: %v", url, err)
+		}
+		prefix := url + "/"
+		seen := make(map[string]bool)
+		err = tree.Files().ForEach(func(f *object.File) error {
+			if !strings.HasSuffix(f.Name, ".ares") {
+				return nil
+			}
+			seen[prefix+f.Name] = true
+			return r.load(prefix+f.Name, f.Hash.String(), f.Lines)
+		})
+		if err != nil {
+			return r.stats, fmt.Errorf("%s: %v", url, err)
+		}
+		err = r.removeFiles(func(name string) bool {
+			return strings.HasPrefix(name, prefix) && !seen[name]
+		})
+		if err != nil {
+			return r.stats, err
+		}
+		if err = r.setFileHash(url, ref.Hash().String()); err != nil {
+			return r.stats, err
+		}
+	}
+	return r.stats, nil
+}
+
+// remoteHead returns the hash of the commit HEAD refers to in a remote repository
+func remoteHead(url string) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.List(&git.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference)
+	for _, ref := range refs {
+		byName[ref.Name()] = ref
+	}
+	head := byName[plumbing.HEAD]
+	if head != nil && head.Type() == plumbing.SymbolicReference {
+		head = byName[head.Target()]
+	}
+	if head == nil {
+		return "", fmt.Errorf("HEAD not found")
+	}
+	return head.Hash().String(), nil
+}
+
+// reloader writes changed ares files to the database
+type reloader struct {
+	mapper *ltx2sql.LtxMapper
+	db     *sql.DB
+	logger *log.Logger
+	stats  ReloadStats
+}
+
+func newReloader(dbname string, logger *log.Logger) (*reloader, error) {
+	mapper, err := ltx2sql.NewLtxMapper(dbname)
+	if err != nil {
+		return nil, err
+	}
+	return &reloader{mapper: mapper, db: mapper.DB, logger: logger}, nil
+}
+func (r *reloader) close() {
+	check(r.mapper.Close(), r.logger)
+}
+
+// fileHash returns the hash of the named file when it was last loaded
+func (r *reloader) fileHash(name string) (string, bool, error) {
+	var hash string
+	err := r.db.QueryRow(`SELECT hash FROM ares_file WHERE name = $1`, name).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
+func (r *reloader) setFileHash(name, hash string) error {
+	_, err := r.db.Exec(sqlMergeAresFile, name, hash, time.Now().UTC().String())
+	return err
+}
+
+var sqlMergeAresFile = `INSERT INTO ares_file (name, hash, loadedWhen) VALUES (?, ?, ?)
+    ON CONFLICT(name) DO UPDATE SET hash = excluded.hash, loadedWhen = excluded.loadedWhen`
+var sqlMergeAresKey = `INSERT INTO ares_key (id, file, hash) VALUES (?, ?, ?)
+    ON CONFLICT(id) DO UPDATE SET file = excluded.file, hash = excluded.hash`
+var sqlUpdateFromAres = `UPDATE ltx SET value = ?, nnp = ?, nwp = ?, comment = ?, redirect = ?, modifiedWhen = ? WHERE id = ?`
+
+// load reads the named ares file, unless it has the same hash as when it was
+// last loaded, and writes the keys that changed.  Each file is loaded in its own transaction.
+func (r *reloader) load(name, hash string, lines func() ([]string, error)) error {
+	loaded, found, err := r.fileHash(name)
+	if err != nil {
+		return err
+	}
+	if found && loaded == hash {
+		r.stats.FilesUnchanged++
+		return nil
+	}
+	text, err := lines()
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	records, err := parseAres(name, text, r.logger)
+	if err != nil {
+		// do not treat the keys of a file we cannot read as removed
+		r.logger.Printf("%s: %v", name, err)
+		return nil
+	}
+	stats := r.stats
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = r.loadFile(tx, name, hash, records); err != nil {
+		tx.Rollback()
+		r.stats = stats
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if err = tx.Commit(); err != nil {
+		r.stats = stats
+		return err
+	}
+	r.stats.FilesLoaded++
+	return nil
+}
+func (r *reloader) loadFile(tx *sql.Tx, name, hash string, records []*models.Ltx) error {
+	baselines, err := keyHashes(tx, name)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		baseline, found := baselines[record.ID]
+		delete(baselines, record.ID)
+		if err = r.loadKey(tx, name, record, baseline, found); err != nil {
+			return err
+		}
+	}
+	// the keys left are no longer in the file
+	for id, baseline := range baselines {
+		if err = r.removeKey(tx, id, baseline); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(sqlMergeAresFile, name, hash, time.Now().UTC().String())
+	return err
+}
+
+// loadKey writes the record from the ares file, unless the record in the database
+// was edited locally.  baseline is the hash of the record when it was last loaded.
+func (r *reloader) loadKey(tx *sql.Tx, file string, record *models.Ltx, baseline string, hasBaseline bool) error {
+	current, err := readKey(tx, record.ID)
+	if err != nil {
+		return err
+	}
+	hash := ltxHash(record)
+	switch {
+	case current == nil && hasBaseline: // deleted locally
+		r.stats.Preserved++
+		return nil
+	case current == nil:
+		_, err = tx.Exec(ltx2sql.SQLMerge, record.ID, record.Library, record.Topic, record.Key, record.Value, record.NNP, record.NWP, record.Comment, record.Redirect, record.CreatedWhen, record.ModifiedWhen)
+		if err != nil {
+			return err
+		}
+		r.stats.Inserted++
+	case ltxHash(current) == hash:
+		// nothing changed
+	case hasBaseline && ltxHash(current) != baseline:
+		r.stats.Preserved++
+		return nil
+	default:
+		if !hasBaseline {
+			// loaded before ares_key existed, so only the history can tell if it was edited
+			edited, err := editedLocally(tx, record.ID)
+			if err != nil {
+				return err
+			}
+			if edited {
+				r.stats.Preserved++
+				return nil
+			}
+		}
+		if _, err = tx.Exec(ltx2sql.SQLInsertHistory, current.ID, current.Value, current.Redirect, current.Comment, AresUser, time.Now().UTC().String()); err != nil {
+			return err
+		}
+		_, err = tx.Exec(sqlUpdateFromAres, record.Value, record.NNP, record.NWP, record.Comment, record.Redirect, record.ModifiedWhen, record.ID)
+		if err != nil {
+			return err
+		}
+		r.stats.Updated++
+	}
+	_, err = tx.Exec(sqlMergeAresKey, record.ID, file, hash)
+	return err
+}
+
+// removeKey deletes a record that is no longer in its ares file, unless it was edited locally
+func (r *reloader) removeKey(tx *sql.Tx, id, baseline string) error {
+	current, err := readKey(tx, id)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if ltxHash(current) != baseline {
+			r.stats.Preserved++
+		} else {
+			if _, err = tx.Exec(ltx2sql.SQLInsertHistory, current.ID, current.Value, current.Redirect, current.Comment, AresUser, time.Now().UTC().String()); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ltx2sql.SQLDelete, id); err != nil {
+				return err
+			}
+			r.stats.Deleted++
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM ares_key WHERE id = $1`, id)
+	return err
+}
+
+// removeFiles removes the keys of the files that were loaded before, and have been removed since
+func (r *reloader) removeFiles(removed func(name string) bool) error {
+	rows, err := r.db.Query(`SELECT name FROM ares_file ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		if removed(name) {
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+	for _, name := range names {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err = r.loadFile(tx, name, "", nil); err == nil {
+			_, err = tx.Exec(`DELETE FROM ares_file WHERE name = $1`, name)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		r.stats.FilesRemoved++
+	}
+	return nil
+}
+
+// parseAres returns the records of the lines of an ares file.
+// If a key occurs more than once, the last one is used.
+func parseAres(name string, lines []string, logger *log.Logger) ([]*models.Ltx, error) {
+	fileNameParts, err := ares.ParseAresFileName(name)
+	if err != nil {
+		return nil, err
+	}
+	var records []*models.Ltx
+	index := make(map[string]int)
+	inCommentBlock := false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "/*") {
+			inCommentBlock = true
+			continue
+		}
+		if strings.HasPrefix(line, "*/") || strings.HasSuffix(line, "*/") {
+			inCommentBlock = false
+			continue
+		}
+		if inCommentBlock {
+			continue
+		}
+		lineParts, err := ares.ParseLine(fileNameParts, line)
+		if err != nil {
+			logger.Printf("%s: %s: line %d", err.Error(), name, i+1)
+			continue
+		}
+		if lineParts.IsAresId || lineParts.IsBlank || lineParts.IsCommentedOut {
+			continue
+		}
+		lineParts.LineNbr = i + 1
+		record := mappers.LineParts2Ltx(&lineParts)
+		if j, ok := index[record.ID]; ok {
+			logger.Printf("duplicate key: %s ", record.ID)
+			records[j] = record
+			continue
+		}
+		index[record.ID] = len(records)
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// keyHashes returns the hash of each key of the file when it was last loaded
+func keyHashes(tx *sql.Tx, file string) (map[string]string, error) {
+	rows, err := tx.Query(`SELECT id, hash FROM ares_key WHERE file = $1`, file)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		if err = rows.Scan(&id, &hash); err != nil {
+			return nil, err
+		}
+		hashes[id] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// readKey returns the value, redirect, and comment of a record, or nil if it does not exist
+func readKey(tx *sql.Tx, id string) (*models.Ltx, error) {
+	var l models.Ltx
+	err := tx.QueryRow(`SELECT id, value, redirect, comment FROM ltx WHERE id = $1`, id).Scan(&l.ID, &l.Value, &l.Redirect, &l.Comment)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// editedLocally reports whether a record has history from someone other than an ares load
+func editedLocally(tx *sql.Tx, id string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM ltx_history WHERE id = $1 AND changedBy != $2`, id, AresUser).Scan(&count)
+	return count > 0, err
+}
+
+// ltxHash is used to tell whether the value, redirect, or comment of a record changed
+func ltxHash(l *models.Ltx) string {
+	sum := sha1.Sum([]byte(l.Value + "\x00" + l.Redirect + "\x00" + l.Comment))
+	return hex.EncodeToString(sum[:])
+}
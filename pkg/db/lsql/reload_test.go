@@ -0,0 +1,90 @@
+package lsql
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test an incremental load keeps local edits and deletions
+func TestAresDir2SqliteIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbname := filepath.Join(dir, "reload_test.db")
+	file := filepath.Join(dir, "actors_en_US_test.ares")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`A_Resource = actors_en_US_test
+Priest = "Priest"
+Deacon = "Deacon"
+Reader = "Reader"
+Choir = "Choir"
+`)
+	stats, err := AresDir2SqliteIncremental(dir, dbname, false, &logger)
+	if err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	if stats.FilesLoaded != 1 || stats.Inserted != 4 {
+		t.Errorf("first load, expected 1 file and 4 inserts, got: %s", stats)
+	}
+	stats, _ = AresDir2SqliteIncremental(dir, dbname, false, &logger)
+	if stats.FilesUnchanged != 1 || stats.FilesLoaded != 0 {
+		t.Errorf("unchanged load, expected 1 unchanged file, got: %s", stats)
+	}
+	// edit and delete locally
+	mapper, err := ltx2sql.NewLtxMapper(dbname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priest, _ := mapper.ReadById("en_us_test/actors/Priest")
+	priest.SetValue("Presbyter")
+	mapper.Merge(priest)
+	mapper.Delete("en_us_test/actors/Reader")
+	mapper.Close()
+
+	write(`A_Resource = actors_en_US_test
+Priest = "The Priest"
+Deacon = "The Deacon"
+Reader = "The Reader"
+Bishop = "Bishop"
+`)
+	stats, err = AresDir2SqliteIncremental(dir, dbname, false, &logger)
+	if err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	if stats.Inserted != 1 || stats.Updated != 1 || stats.Deleted != 1 || stats.Preserved != 2 {
+		t.Errorf("second load, expected 1 inserted, 1 updated, 1 deleted, 2 preserved, got: %s", stats)
+	}
+	mapper, _ = ltx2sql.NewLtxMapper(dbname)
+	defer mapper.Close()
+	expect := map[string]string{
+		"en_us_test/actors/Priest": "Presbyter",
+		"en_us_test/actors/Deacon": "The Deacon",
+		"en_us_test/actors/Bishop": "Bishop",
+	}
+	for id, value := range expect {
+		r, _ := mapper.ReadById(id)
+		if r == nil || r.Value != value {
+			t.Errorf("%s, expected %s, got: %v", id, value, r)
+		}
+	}
+	for _, id := range []string{"en_us_test/actors/Reader", "en_us_test/actors/Choir"} {
+		if r, _ := mapper.ReadById(id); r != nil {
+			t.Errorf("%s, expected it to be deleted, got: %v", id, r)
+		}
+	}
+
+	os.Remove(file)
+	stats, _ = AresDir2SqliteIncremental(dir, dbname, false, &logger)
+	if stats.FilesRemoved != 1 || stats.Deleted != 2 || stats.Preserved != 1 {
+		t.Errorf("removed file, expected 2 deleted and 1 preserved, got: %s", stats)
+	}
+}
@@ -0,0 +1,272 @@
+// Package ltx2ares writes the records of a liturgical text store to AGES ares files,
+// so that changes made in doxa can be shared with AGES users, e.g. via git.
+// The files can be read back into a store by lsql.
+package ltx2ares
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/ages/ares"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExportStats reports what an export did
+type ExportStats struct {
+	Files     int // ares files written
+	Unchanged int // ares files not written, because their content did not change
+	Keys      int // keys written
+}
+
+func (s ExportStats) String() string {
+	return fmt.Sprintf("%d ares files written, %d unchanged, %d keys", s.Files, s.Unchanged, s.Keys)
+}
+
+// Export writes an ares file for each topic of the library to dir.
+// If library is empty, all libraries are exported.
+// When an ares file for the topic already exists somewhere below dir
+// (e.g. in a git repository cloned there), it is rewritten in place (see Rewrite),
+// so that a diff only shows what changed.  Otherwise, new files are
+// written to dir/library.
+func Export(store ltxstore.LtxStore, library, dir string) (ExportStats, error) {
+	var stats ExportStats
+	libraries := []string{library}
+	if len(library) == 0 {
+		var err error
+		libraries, err = store.Libraries()
+		if err != nil {
+			return stats, err
+		}
+	}
+	existing, err := aresFiles(dir)
+	if err != nil {
+		return stats, err
+	}
+	for _, library := range libraries {
+		topics, err := store.Topics(library + store.IDDelimiter())
+		if err != nil {
+			return stats, err
+		}
+		for _, topic := range topics {
+			records, err := store.ReadByLT(library, topic, true)
+			if err != nil {
+				return stats, err
+			}
+			records = inLibrary(library+store.IDDelimiter()+topic+store.IDDelimiter(), records)
+			if len(records) == 0 {
+				continue
+			}
+			name, err := ares.FileName(library, topic)
+			if err != nil {
+				return stats, err
+			}
+			path, found := existing[name]
+			if !found {
+				path = filepath.Join(dir, library, name)
+			}
+			changed, err := writeFile(path, library, topic, records)
+			if err != nil {
+				return stats, fmt.Errorf("%s: %v", path, err)
+			}
+			if changed {
+				stats.Files++
+			} else {
+				stats.Unchanged++
+			}
+			stats.Keys += len(records)
+		}
+	}
+	return stats, nil
+}
+
+// Write writes an ares file for the topic of the library to w.
+// Keys in order come first, in that order, followed by the other keys, sorted.
+func Write(w io.Writer, library, topic string, records []*models.Ltx, order []string) error {
+	name, err := ares.FileName(library, topic)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "A_Resource = %s\n\n", strings.TrimSuffix(name, ".ares"))
+	for _, r := range Sort(records, order) {
+		line, err := ares.FormatLine(r.Key, r.Value, r.Redirect, r.Comment)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.ID, err)
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// Sort returns the records ordered by key, with the keys in order first, in that order.
+// The sort does not depend on the order of records, so an export is always the same.
+func Sort(records []*models.Ltx, order []string) []*models.Ltx {
+	position := make(map[string]int)
+	for i, key := range order {
+		if _, ok := position[key]; !ok {
+			position[key] = i
+		}
+	}
+	sorted := make([]*models.Ltx, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, iok := position[sorted[i].Key]
+		pj, jok := position[sorted[j].Key]
+		switch {
+		case iok && jok:
+			return pi < pj
+		case iok != jok:
+			return iok
+		default:
+			return sorted[i].Key < sorted[j].Key
+		}
+	})
+	return sorted
+}
+
+// Rewrite writes the content of an existing ares file for the topic of the library to w,
+// with the values of the records.  The line of each key is replaced by that of its record,
+// in the same place, or removed if there is no record for the key.  The other lines, i.e.
+// comment blocks, commented-out lines, and blank lines, are kept where they are.
+// The keys not in the file are appended, sorted.
+func Rewrite(w io.Writer, content, library, topic string, records []*models.Ltx) error {
+	byKey := make(map[string]*models.Ltx)
+	for _, r := range records {
+		byKey[r.Key] = r
+	}
+	lines, keys := keyLines(content)
+	bw := bufio.NewWriter(w)
+	written := make(map[string]bool)
+	for i, line := range lines {
+		key := keys[i]
+		if len(key) > 0 {
+			r, ok := byKey[key]
+			if !ok || written[key] {
+				continue
+			}
+			written[key] = true
+			var err error
+			if line, err = ares.FormatLine(r.Key, r.Value, r.Redirect, r.Comment); err != nil {
+				return fmt.Errorf("%s: %v", r.ID, err)
+			}
+		}
+		fmt.Fprintln(bw, line)
+	}
+	var rest []*models.Ltx
+	for _, r := range records {
+		if !written[r.Key] {
+			rest = append(rest, r)
+		}
+	}
+	for _, r := range Sort(rest, nil) {
+		line, err := ares.FormatLine(r.Key, r.Value, r.Redirect, r.Comment)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.ID, err)
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// writeFile writes the ares file, unless it exists and has the same content.
+func writeFile(path, library, topic string, records []*models.Ltx) (bool, error) {
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	var sb strings.Builder
+	if len(old) > 0 {
+		err = Rewrite(&sb, string(old), library, topic, records)
+	} else {
+		err = Write(&sb, library, topic, records, nil)
+	}
+	if err != nil {
+		return false, err
+	}
+	if sb.String() == string(old) {
+		return false, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	return true, ioutil.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// Keys returns the keys defined in the content of an ares file, in the order they occur
+func Keys(content string) []string {
+	var result []string
+	_, keys := keyLines(content)
+	for _, key := range keys {
+		if len(key) > 0 {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// keyLines returns the lines of the content of an ares file, without the line ends,
+// and the key defined on each line, or an empty string for a line that is not a key,
+// e.g. a blank line, a commented-out line, or a line in a comment block
+func keyLines(content string) ([]string, []string) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	keys := make([]string, len(lines))
+	var fnp ares.FilenameParts
+	inCommentBlock := false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "/*") {
+			inCommentBlock = true
+		}
+		if inCommentBlock {
+			if strings.HasPrefix(line, "*/") || strings.HasSuffix(line, "*/") {
+				inCommentBlock = false
+			}
+			continue
+		}
+		lineParts, err := ares.ParseLine(fnp, line)
+		if err != nil || lineParts.IsAresId || lineParts.IsBlank || lineParts.IsCommentedOut {
+			continue
+		}
+		keys[i] = lineParts.Key
+	}
+	return lines, keys
+}
+
+// aresFiles returns the path of each ares file below dir, by file name
+func aresFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".ares") {
+			files[info.Name()] = path
+		}
+		return nil
+	})
+	return files, err
+}
+
+// inLibrary filters out the records that matched the LIKE pattern
+// of the library and topic, but do not start with the prefix, e.g. because of an _ in the library
+func inLibrary(prefix string, records []*models.Ltx) []*models.Ltx {
+	var result []*models.Ltx
+	for _, r := range records {
+		if strings.HasPrefix(r.ID, prefix) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
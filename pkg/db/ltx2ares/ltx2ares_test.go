@@ -0,0 +1,65 @@
+package ltx2ares
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ", "", ""))
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"))
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Choir", "ΧΟΡΟΣ", "the choir", ""))
+	store.Merge(models.NewLtx("en_us_dedes", "actors", "Priest", "Priest", "", ""))
+
+	// an existing file keeps its order and comments, and is updated in place
+	repo := filepath.Join(dir, "repo", "Resources")
+	os.MkdirAll(repo, 0755)
+	existing := filepath.Join(repo, "actors_gr_GR_cog.ares")
+	ioutil.WriteFile(existing, []byte("A_Resource = actors_gr_GR_cog\n\n/*\nOld = \"x\"\n*/\nPriest = \"Ιερευς\"\n// Reader = \"Αναγνώστης\"\nChoir = \"ΧΟΡΟΣ\"\nGone = \"x\"\n"), 0644)
+
+	stats, err := Export(store, "", dir)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if stats.Files != 2 || stats.Keys != 4 {
+		t.Errorf("Export, expected 2 files and 4 keys, got: %s", stats)
+	}
+	content, _ := ioutil.ReadFile(existing)
+	expected := `A_Resource = actors_gr_GR_cog
+
+/*
+Old = "x"
+*/
+Priest = "ΙΕΡΕΥΣ"
+// Reader = "Αναγνώστης"
+Choir = "ΧΟΡΟΣ" // the choir
+Deacon = actors_gr_GR_cog.Priest
+`
+	if string(content) != expected {
+		t.Errorf("Export, expected:\n%s\ngot:\n%s", expected, content)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "en_us_dedes", "actors_en_US_dedes.ares")); err != nil {
+		t.Errorf("Export en_us_dedes: %v", err)
+	}
+	stats, _ = Export(store, "gr_gr_cog", dir)
+	if stats.Files != 0 || stats.Unchanged != 1 {
+		t.Errorf("Export again, expected 1 unchanged file, got: %s", stats)
+	}
+}
+func TestKeys(t *testing.T) {
+	content := "A_Resource = actors_gr_GR_cog\n/* one line */\n/*\nOld = \"x\"\n*/\n// Skip = \"y\"\nB = \"b\"\nA = actors_gr_GR_cog.B\n"
+	keys := Keys(content)
+	if len(keys) != 2 || keys[0] != "B" || keys[1] != "A" {
+		t.Errorf("Keys, expected [B A], got %v", keys)
+	}
+}
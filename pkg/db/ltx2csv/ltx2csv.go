@@ -0,0 +1,109 @@
+/**
+Package ltx2csv reads and writes liturgical text records as csv,
+e.g. to exchange translations with reviewers who use a spreadsheet.
+
+The first row is a header with the names of the columns:
+
+  library,topic,key,value,redirect,comment
+  gr_gr_cog,actors,Priest,ΙΕΡΕΥΣ,,
+  gr_gr_cog,actors,Deacon,,gr_gr_cog/actors/Priest,
+
+When reading, the columns can be in any order, and columns with other
+names are ignored, so reviewers can add their own.  Instead of the library,
+topic, and key, there can be an id column, e.g. gr_gr_cog/actors/Priest.
+A byte order mark, which some spreadsheets write, is skipped.
+ */
+package ltx2csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io"
+	"strings"
+)
+
+// Columns are the columns written by Write, in order
+var Columns = []string{"library", "topic", "key", "value", "redirect", "comment"}
+
+var ErrMissingColumns = errors.New("ltx2csv: the header needs an id column, or library, topic, and key columns")
+
+// Read reads records from csv with a header row
+func Read(r io.Reader) ([]*models.Ltx, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	column := make(map[string]int)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		column[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	_, hasID := column["id"]
+	_, hasLibrary := column["library"]
+	_, hasTopic := column["topic"]
+	_, hasKey := column["key"]
+	if !hasID && !(hasLibrary && hasTopic && hasKey) {
+		return nil, ErrMissingColumns
+	}
+	var records []*models.Ltx
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := column[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		l := &models.Ltx{
+			ID:       field("id"),
+			Library:  field("library"),
+			Topic:    field("topic"),
+			Key:      field("key"),
+			Value:    field("value"),
+			Redirect: field("redirect"),
+			Comment:  field("comment"),
+		}
+		if len(l.ID) == 0 && len(l.Library) == 0 && len(l.Topic) == 0 && len(l.Key) == 0 {
+			if len(strings.TrimSpace(strings.Join(row, ""))) == 0 {
+				continue // a blank row
+			}
+			return nil, fmt.Errorf("ltx2csv: line %d has no id", line)
+		}
+		records = append(records, l)
+	}
+	return records, nil
+}
+
+// Write writes the records as csv, with a header row
+func Write(w io.Writer, records []*models.Ltx) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, r := range records {
+		library, topic, key := r.Library, r.Topic, r.Key
+		if parts := strings.Split(r.ID, models.IDDelimiter); len(parts) == 3 {
+			library, topic, key = parts[0], parts[1], parts[2]
+		}
+		if err := writer.Write([]string{library, topic, key, r.Value, r.Redirect, r.Comment}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,51 @@
+package ltx2csv
+
+import (
+	"bytes"
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ, \"ὁ\"", "", ""))
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "see the priest", "gr_gr_cog/actors/Priest"))
+	records, err := ltxstore.Records(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = Write(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	copy := ltx2mem.NewLtxMapper()
+	if n, err := ltxstore.Import(copy, read); n != 2 || err != nil {
+		t.Fatalf("Import, expected 2, got %d: %v", n, err)
+	}
+	for _, r := range records {
+		c, _ := copy.ReadById(r.ID)
+		if c == nil || c.Value != r.Value || c.Redirect != r.Redirect || c.Comment != r.Comment || c.NNP != r.NNP {
+			t.Errorf("round trip %s, expected %v, got %v", r.ID, r, c)
+		}
+	}
+}
+func TestRead(t *testing.T) {
+	in := "\ufeffNotes,ID,Value\nlooks good,gr_gr_cog/actors/Priest,ΙΕΡΕΥΣ\n,,\n"
+	records, err := Read(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "gr_gr_cog/actors/Priest" || records[0].Value != "ΙΕΡΕΥΣ" {
+		t.Errorf("Read, unexpected records: %v", records)
+	}
+	if _, err = Read(strings.NewReader("value,comment\nx,y\n")); err != ErrMissingColumns {
+		t.Errorf("Read without id, expected ErrMissingColumns, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+/**
+Package ltx2json reads and writes liturgical text records as json.
+
+The format is a models.LtxArray, i.e. an array of objects, e.g.
+
+  [
+    {
+      "id": "gr_gr_cog/actors/Priest",
+      "library": "gr_gr_cog",
+      "topic": "actors",
+      "key": "Priest",
+      "value": "ΙΕΡΕΥΣ",
+      "nnp": "ιερευσ",
+      "nwp": "ιερευσ",
+      "comment": "",
+      "redirect": "",
+      "createdWhen": "2020-06-01 12:00:00 +0000 UTC",
+      "modifiedWhen": "2020-06-01 12:00:00 +0000 UTC"
+    }
+  ]
+
+When reading, only the id (or the library, topic, and key), and the value
+or redirect are required.  The nnp and nwp are always recomputed from the value.
+ */
+package ltx2json
+
+import (
+	"encoding/json"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io"
+)
+
+// Read reads a json array of records
+func Read(r io.Reader) ([]*models.Ltx, error) {
+	var array models.LtxArray
+	if err := json.NewDecoder(r).Decode(&array); err != nil {
+		return nil, err
+	}
+	records := make([]*models.Ltx, len(array))
+	for i := range array {
+		records[i] = &array[i]
+	}
+	return records, nil
+}
+
+// Write writes the records as an indented json array
+func Write(w io.Writer, records []*models.Ltx) error {
+	array := models.NewLtxArray()
+	for _, r := range records {
+		array.Append(r)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(array)
+}
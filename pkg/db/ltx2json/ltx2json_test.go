@@ -0,0 +1,29 @@
+package ltx2json
+
+import (
+	"bytes"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	records := []*models.Ltx{
+		models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ <ὁ>", "", ""),
+		models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"),
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<ὁ>") {
+		t.Errorf("Write, expected html not to be escaped: %s", buf.String())
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(read) != 2 || *read[0] != *records[0] || *read[1] != *records[1] {
+		t.Errorf("round trip, expected %v, got %v", records, read)
+	}
+}
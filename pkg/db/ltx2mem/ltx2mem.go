@@ -0,0 +1,419 @@
+/**
+Package ltx2mem provides an in-memory implementation of ltxstore.LtxStore.
+It has the same behavior as the sqlite3 mapper in package ltx2sql,
+including sql LIKE patterns (% and _, with \ as the escape character only
+in the substrings of ReadByValue, ReadByNNP, and ReadByNWP, as ltx2sql uses ESCAPE there)
+and matching that ignores the case of ASCII letters, but not of others, e.g. Greek,
+unless CaseSensitiveLike(true) is called.
+It is intended for tests and for small projects that do not need a database.
+The mapper is safe for concurrent use.
+ */
+package ltx2mem
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const IDDelimiter = "/"
+
+type LtxMapper struct {
+	mutex         sync.RWMutex
+	records       map[string]models.Ltx
+	history       map[string][]models.LtxRevision
+	user          string
+	caseSensitive bool
+}
+
+// LtxMapper is the in-memory implementation of ltxstore.LtxStore
+var _ ltxstore.LtxStore = (*LtxMapper)(nil)
+
+// NewLtxMapper returns an empty in-memory mapper
+func NewLtxMapper() *LtxMapper {
+	return &LtxMapper{
+		records: make(map[string]models.Ltx),
+		history: make(map[string][]models.LtxRevision),
+		user:    ltxstore.DefaultUser(),
+	}
+}
+// Get the delimiter used in IDs
+func (m *LtxMapper) IDDelimiter() string {
+	return IDDelimiter
+}
+// Creates or updates the record.
+// If the record is updated, its previous value, redirect, and comment are added to the history.
+func (m *LtxMapper) Merge(l *models.Ltx) error {
+	if l == nil || len(l.ID) == 0 {
+		return errors.New("ltx2mem: record must have an id")
+	}
+	l.ModifiedWhen = time.Now().UTC().String()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.addHistory(l.ID, l)
+	m.records[l.ID] = *l
+	return nil
+}
+// Deletes the record for the specified id, and adds it to the history
+func (m *LtxMapper) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.addHistory(id, nil)
+	delete(m.records, id)
+	return nil
+}
+// Merges the records, then deletes the records for the ids.
+// The records are checked first, so if any is not valid, none of the changes are made.
+func (m *LtxMapper) Apply(merges []*models.Ltx, deletes []string) error {
+	for _, l := range merges {
+		if l == nil || len(l.ID) == 0 {
+			return errors.New("ltx2mem: record must have an id")
+		}
+	}
+	now := time.Now().UTC().String()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, l := range merges {
+		l.ModifiedWhen = now
+		m.addHistory(l.ID, l)
+		m.records[l.ID] = *l
+	}
+	for _, id := range deletes {
+		m.addHistory(id, nil)
+		delete(m.records, id)
+	}
+	return nil
+}
+// Sets who is recorded in the history as making subsequent changes
+func (m *LtxMapper) SetUser(user string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.user = user
+}
+// Returns the revisions of the record with the specified id, oldest first, numbered from 1
+func (m *LtxMapper) History(id string) ([]models.LtxRevision, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]models.LtxRevision(nil), m.history[id]...), nil
+}
+// Sets the value, redirect, and comment of the record to those of the revision
+func (m *LtxMapper) Revert(id string, revision int) error {
+	return ltxstore.ApplyRevision(m, id, revision)
+}
+// addHistory adds the current value, redirect, and comment of the record to the history,
+// unless the record does not exist, or next would not change them.  Next is nil for a delete.
+// Callers must hold the mutex for writing.
+func (m *LtxMapper) addHistory(id string, next *models.Ltx) {
+	old, ok := m.records[id]
+	if !ok {
+		return
+	}
+	if next != nil && next.Value == old.Value && next.Redirect == old.Redirect && next.Comment == old.Comment {
+		return
+	}
+	m.history[id] = append(m.history[id], models.LtxRevision{
+		Revision:    len(m.history[id]) + 1,
+		ID:          id,
+		Value:       old.Value,
+		Redirect:    old.Redirect,
+		Comment:     old.Comment,
+		ChangedBy:   m.user,
+		ChangedWhen: time.Now().UTC().String(),
+	})
+}
+// Read (by id) returns the record for the specified id, or nil if not found
+func (m *LtxMapper) ReadById(id string) (*models.Ltx, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if l, ok := m.records[id]; ok {
+		return &l, nil
+	}
+	return nil, nil
+}
+// Read (by library, topic, and key) returns the record, or nil if not found
+func (m *LtxMapper) ReadByLTK(library, topic, key string) (*models.Ltx, error) {
+	return m.ReadById(strings.Join([]string{library, topic, key}, IDDelimiter))
+}
+// Read (by library and topic) returns the records for the specified library and topic
+func (m *LtxMapper) ReadByLT(library, topic string, returnEmpty bool) ([]*models.Ltx, error) {
+	like := fmt.Sprintf("%s%s%s%s%%", library, IDDelimiter, topic, IDDelimiter)
+	return m.query(returnEmpty, func(l *models.Ltx) bool {
+		return m.like(l.ID, like)
+	}), nil
+}
+// Read (by topic and key) returns the records in all libraries for the specified topic and key
+func (m *LtxMapper) ReadByTK(topic, key string, returnEmpty bool) ([]*models.Ltx, error) {
+	like := fmt.Sprintf("%%%s%s%s%s", IDDelimiter, topic, IDDelimiter, key)
+	return m.query(returnEmpty, func(l *models.Ltx) bool {
+		return m.like(l.ID, like)
+	}), nil
+}
+// Read (by value) returns the records whose value contains the substring.
+// id can be empty or use %, e.g. gr_gr_cog% instead of a full id
+func (m *LtxMapper) ReadByValue(id, substring string) ([]*models.Ltx, error) {
+	return m.readByColumn(id, substring, func(l *models.Ltx) string { return l.Value }), nil
+}
+// Read (by NNP) returns the records whose nnp contains the substring.
+// id can be empty or use %, e.g. gr_gr_cog% instead of a full id
+func (m *LtxMapper) ReadByNNP(id, substring string) ([]*models.Ltx, error) {
+	return m.readByColumn(id, substring, func(l *models.Ltx) string { return l.NNP }), nil
+}
+// Read (by NWP) returns the records whose nwp contains the substring.
+// id can be empty or use %, e.g. gr_gr_cog% instead of a full id
+func (m *LtxMapper) ReadByNWP(id, substring string) ([]*models.Ltx, error) {
+	return m.readByColumn(id, substring, func(l *models.Ltx) string { return l.NWP }), nil
+}
+// Search returns the records matching the full text query, best match first.
+// See ltxstore.ParseQuery for the query syntax.
+func (m *LtxMapper) Search(query string, options ltxstore.SearchOptions) ([]*models.Ltx, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	q, err := ltxstore.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	candidates := m.query(true, func(l *models.Ltx) bool {
+		return len(options.Like) == 0 || m.like(l.ID, options.Like)
+	})
+	return ltxstore.Rank(q, options, candidates), nil
+}
+func (m *LtxMapper) readByColumn(id, substring string, column func(l *models.Ltx) string) []*models.Ltx {
+	pattern := fmt.Sprintf("%%%s%%", substring)
+	return m.query(true, func(l *models.Ltx) bool {
+		if len(id) > 0 && !m.like(l.ID, id) {
+			return false
+		}
+		return m.likeEscaped(column(l), pattern)
+	})
+}
+// query returns copies of the records that satisfy the filter, in id order
+func (m *LtxMapper) query(returnEmpty bool, filter func(l *models.Ltx) bool) []*models.Ltx {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var records []*models.Ltx
+	for _, l := range m.records {
+		r := l
+		if !filter(&r) {
+			continue
+		}
+		if returnEmpty || len(r.Value) > 0 {
+			records = append(records, &r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
+// Returns an array of the libraries
+func (m *LtxMapper) Libraries() ([]string, error) {
+	values := m.distinct("", func(l *models.Ltx) string { return l.Library })
+	sort.Strings(values)
+	return values, nil
+}
+// Returns an array of the topics for ids like the parameter
+func (m *LtxMapper) Topics(like string) ([]string, error) {
+	values := m.distinct(like+"%", func(l *models.Ltx) string { return l.Topic })
+	sortNoCase(values)
+	return values, nil
+}
+// Returns an array of the keys for ids like the parameter
+func (m *LtxMapper) Keys(like string) ([]string, error) {
+	values := m.distinct(like+"%", func(l *models.Ltx) string { return l.Key })
+	sortNoCase(values)
+	return values, nil
+}
+// Returns an array of the distinct values of the specified column (library, topic, or key)
+func (m *LtxMapper) Distinct(column, like string) ([]string, error) {
+	var f func(l *models.Ltx) string
+	switch column {
+	case "library":
+		f = func(l *models.Ltx) string { return l.Library }
+	case "topic":
+		f = func(l *models.Ltx) string { return l.Topic }
+	case "key":
+		f = func(l *models.Ltx) string { return l.Key }
+	default:
+		return nil, fmt.Errorf("ltx2mem: unsupported column %s", column)
+	}
+	values := m.distinct(like, f)
+	sort.Strings(values)
+	return values, nil
+}
+func (m *LtxMapper) distinct(like string, column func(l *models.Ltx) string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	seen := make(map[string]bool)
+	var values []string
+	for _, l := range m.records {
+		if len(like) > 0 && !m.like(l.ID, like) {
+			continue
+		}
+		v := column(&l)
+		if len(v) > 0 && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+// Returns an array of the records with redirects
+func (m *LtxMapper) Redirects(like string) ([]models.Redirect, error) {
+	var records []models.Redirect
+	for _, l := range m.query(true, func(l *models.Ltx) bool {
+		return len(l.Redirect) > 0 && (len(like) == 0 || m.like(l.ID, like))
+	}) {
+		records = append(records, models.Redirect{ID: l.ID, Redirect: l.Redirect})
+	}
+	return records, nil
+}
+// Returns an array of the redirects to specified id
+func (m *LtxMapper) ReferredTo(by string) ([]models.Redirect, error) {
+	var records []models.Redirect
+	for _, l := range m.query(true, func(l *models.Ltx) bool {
+		return l.Redirect == by
+	}) {
+		records = append(records, models.Redirect{ID: l.ID, Redirect: l.Redirect})
+	}
+	return records, nil
+}
+// Returns an array of ids with both value and redirect blank
+func (m *LtxMapper) Empty(like string) ([]string, error) {
+	var records []string
+	for _, l := range m.query(true, func(l *models.Ltx) bool {
+		return len(l.Value) == 0 && len(l.Redirect) == 0 && (len(like) == 0 || m.like(l.ID, like))
+	}) {
+		records = append(records, l.ID)
+	}
+	return records, nil
+}
+// returns the number of distinct topics for the library
+func (m *LtxMapper) CountTopics(library string) (int, error) {
+	return len(m.distinct(library+IDDelimiter+"%", func(l *models.Ltx) string { return l.Topic })), nil
+}
+// returns the count for id like specified library, topic, key
+// Topic and/or key can be empty strings
+func (m *LtxMapper) CountKeys(library, topic, key string) (int, error) {
+	if len(library) == 0 {
+		library = "%"
+	}
+	var like string
+	if len(key) > 0 {
+		like = strings.Join([]string{library, topic, key}, IDDelimiter)
+	} else if len(topic) > 0 {
+		like = strings.Join([]string{library, topic, "%"}, IDDelimiter)
+	} else {
+		like = library + IDDelimiter + "%"
+	}
+	return len(m.query(true, func(l *models.Ltx) bool {
+		return m.like(l.ID, like)
+	})), nil
+}
+// Verifies a record exists for the specified library, topic, and key
+func (m *LtxMapper) Exists(library, topic, key string) bool {
+	c, _ := m.CountKeys(library, topic, key)
+	return c == 1
+}
+// Verifies a record exists for the specified topic and key
+func (m *LtxMapper) ExistsTK(topic, key string) bool {
+	c, _ := m.CountKeys("", topic, key)
+	return c > 0
+}
+func (m *LtxMapper) CaseSensitiveLike(on bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.caseSensitive = on
+	return nil
+}
+// Close removes all records and their history
+func (m *LtxMapper) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = make(map[string]models.Ltx)
+	m.history = make(map[string][]models.LtxRevision)
+	return nil
+}
+// like reports whether s matches the sql LIKE pattern, which has no escape character.
+// Callers must hold the mutex.
+func (m *LtxMapper) like(s, pattern string) bool {
+	if !m.caseSensitive {
+		s, pattern = asciiLower(s), asciiLower(pattern)
+	}
+	return Like(s, pattern, false)
+}
+// likeEscaped reports whether s matches the sql LIKE pattern, with \ as the escape character.
+// Callers must hold the mutex.
+func (m *LtxMapper) likeEscaped(s, pattern string) bool {
+	if !m.caseSensitive {
+		s, pattern = asciiLower(s), asciiLower(pattern)
+	}
+	return Like(s, pattern, true)
+}
+// asciiLower changes the ASCII letters of s to lower case, as sqlite does for LIKE
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+// Like reports whether s matches the sql LIKE pattern, case sensitively.
+// % matches zero or more characters, and _ matches one character.
+// If escape is true, \ escapes the character that follows it, as with ESCAPE '\',
+// and a pattern that ends with \ matches nothing.
+func Like(s, pattern string, escape bool) bool {
+	for len(pattern) > 0 {
+		p, n := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[n:]
+		switch p {
+		case '%':
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); {
+				if Like(s[i:], pattern, escape) {
+					return true
+				}
+				if i == len(s) {
+					break
+				}
+				_, w := utf8.DecodeRuneInString(s[i:])
+				i += w
+			}
+			return false
+		case '_':
+			if len(s) == 0 {
+				return false
+			}
+			_, w := utf8.DecodeRuneInString(s)
+			s = s[w:]
+		default:
+			if p == '\\' && escape {
+				if len(pattern) == 0 {
+					return false
+				}
+				p, n = utf8.DecodeRuneInString(pattern)
+				pattern = pattern[n:]
+			}
+			c, w := utf8.DecodeRuneInString(s)
+			if len(s) == 0 || c != p {
+				return false
+			}
+			s = s[w:]
+		}
+	}
+	return len(s) == 0
+}
+func sortNoCase(values []string) {
+	sort.Slice(values, func(i, j int) bool {
+		return strings.ToLower(values[i]) < strings.ToLower(values[j])
+	})
+}
@@ -0,0 +1,243 @@
+package ltx2mem
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"testing"
+)
+
+func TestMapper_Create(t *testing.T) {
+	mapper := NewLtxMapper()
+	library := "gr_gr_cog"
+	topic := "actors"
+	key := "Priest"
+	l := models.NewLtx(library, topic, key, "Priest", "", "")
+	err := mapper.Merge(l)
+	if err != nil {
+		t.Error(fmt.Sprintf("Merge %s: %v", l.ID, err))
+	}
+	r, err := mapper.ReadById(l.ID)
+	if err != nil || r == nil {
+		t.Fatalf("Read %s: %v", l.ID, err)
+	}
+	if r.ID != l.ID {
+		t.Error(fmt.Sprintf("Read %s, %s: do not match", l.ID, r.ID))
+	}
+	s := models.NewLtx(library, topic, "deacon", "Deacon", "", "")
+	mapper.Merge(s)
+	records, _ := mapper.ReadByLT(library, topic, true)
+	if len(records) != 2 {
+		t.Error(fmt.Sprintf("ReadByLT %s/%s, expected 2, got: %v", library, topic, len(records)))
+	}
+	records, _ = mapper.ReadByTK(topic, key, true)
+	if len(records) != 1 {
+		t.Error(fmt.Sprintf("ReadByTK %s/%s, expected 1, got: %v", topic, key, len(records)))
+	}
+	u := models.NewLtx("en_us_dedes", topic, "deacon", "Deacon", "", "")
+	mapper.Merge(u)
+	v := "Deacon"
+	records, _ = mapper.ReadByValue("", v)
+	if len(records) != 2 {
+		t.Error(fmt.Sprintf("ReadByValue %s, expected 2, got: %v", v, len(records)))
+	}
+	records, _ = mapper.ReadByValue("en_us%", v)
+	if len(records) != 1 {
+		t.Error(fmt.Sprintf("ReadByValue en_us%% %s, expected 1, got: %v", v, len(records)))
+	}
+	libraries, _ := mapper.Libraries()
+	if len(libraries) != 2 || libraries[0] != "en_us_dedes" {
+		t.Error(fmt.Sprintf("Libraries, expected [en_us_dedes gr_gr_cog], got: %v", libraries))
+	}
+	keys, _ := mapper.Keys(library + "/" + topic + "/")
+	if len(keys) != 2 || keys[0] != "deacon" {
+		t.Error(fmt.Sprintf("Keys, expected [deacon Priest], got: %v", keys))
+	}
+	if !mapper.Exists(library, topic, key) {
+		t.Error(fmt.Sprintf("Exists %s/%s/%s, expected true", library, topic, key))
+	}
+	mapper.Delete(l.ID)
+	if mapper.Exists(library, topic, key) {
+		t.Error(fmt.Sprintf("Delete %s, record still exists", l.ID))
+	}
+}
+func TestMapper_Redirects(t *testing.T) {
+	mapper := NewLtxMapper()
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ", "", ""))
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"))
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Choir", "", "", ""))
+	redirects, _ := mapper.Redirects("gr_gr_cog/%")
+	if len(redirects) != 1 || redirects[0].Redirect != "gr_gr_cog/actors/Priest" {
+		t.Error(fmt.Sprintf("Redirects, expected 1, got: %v", redirects))
+	}
+	referred, _ := mapper.ReferredTo("gr_gr_cog/actors/Priest")
+	if len(referred) != 1 || referred[0].ID != "gr_gr_cog/actors/Deacon" {
+		t.Error(fmt.Sprintf("ReferredTo, expected 1, got: %v", referred))
+	}
+	empty, _ := mapper.Empty("")
+	if len(empty) != 1 || empty[0] != "gr_gr_cog/actors/Choir" {
+		t.Error(fmt.Sprintf("Empty, expected 1, got: %v", empty))
+	}
+}
+func TestLike(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		escape     bool
+		want       bool
+	}{
+		{"gr_gr_cog/actors/Priest", "gr_gr_cog/%", false, true},
+		{"gr_gr_cog/actors/Priest", "%/actors/Priest", false, true},
+		{"gr_gr_cog/actors/Priest", "gr_gr_cog/actors/", false, false},
+		{"grxgr_cog", "gr\\_gr_cog", true, false},
+		{"gr_gr_cog", "gr\\_gr_cog", true, true},
+		{"gr_gr_cog", "gr\\_gr_cog", false, false},
+		{"gr\\xgr_cog", "gr\\_gr_cog", false, true},
+		{"a\\", "a\\", true, false},
+		{"ΙΕΡΕΥΣ", "%ΡΕ%", false, true},
+		{"ΙΕΡΕΥΣ", "ΙΕΡΕΥ_", false, true},
+		{"", "%", false, true},
+	}
+	for _, test := range tests {
+		if got := Like(test.s, test.pattern, test.escape); got != test.want {
+			t.Errorf("Like(%s, %s, %v): expected %v, got %v", test.s, test.pattern, test.escape, test.want, got)
+		}
+	}
+}
+func TestMapper_Search(t *testing.T) {
+	mapper := NewLtxMapper()
+	mapper.Merge(models.NewLtx("en_us_dedes", "le.go.me", "key1", "Lord, have mercy.", "", ""))
+	mapper.Merge(models.NewLtx("en_us_dedes", "le.go.me", "key2", "Lord, have mercy. Lord, have mercy.", "", ""))
+	mapper.Merge(models.NewLtx("gr_gr_cog", "le.go.me", "key1", "Κύριε, ἐλέησον.", "", ""))
+	records, err := mapper.Search("mercy", ltxstore.SearchOptions{Column: "value"})
+	if err != nil {
+		t.Fatalf("Search mercy: %v", err)
+	}
+	if len(records) != 2 || records[0].Key != "key2" {
+		t.Error(fmt.Sprintf("Search mercy, expected key2 and key1, got: %v", records))
+	}
+	records, _ = mapper.Search("ελεησον", ltxstore.SearchOptions{Column: "nnp", Like: "gr_gr_cog/%"})
+	if len(records) != 1 {
+		t.Error(fmt.Sprintf("Search ελεησον, expected 1, got: %v", len(records)))
+	}
+}
+func TestMapper_History(t *testing.T) {
+	mapper := NewLtxMapper()
+	mapper.SetUser("tester")
+	l := models.NewLtx("en_us_test", "actors", "Priest", "Priest", "", "")
+	mapper.Merge(l)
+	l.SetValue("PRIEST")
+	mapper.Merge(l)
+	mapper.Delete(l.ID)
+	revisions, _ := mapper.History(l.ID)
+	if len(revisions) != 2 || revisions[1].Value != "PRIEST" || revisions[1].ChangedBy != "tester" {
+		t.Fatalf("History %s, unexpected revisions: %v", l.ID, revisions)
+	}
+	if err := mapper.Revert(l.ID, 1); err != nil {
+		t.Fatalf("Revert %s 1: %v", l.ID, err)
+	}
+	r, _ := mapper.ReadById(l.ID)
+	if r == nil || r.Value != "Priest" {
+		t.Error(fmt.Sprintf("Revert %s 1, unexpected record: %v", l.ID, r))
+	}
+}
+func TestResolve(t *testing.T) {
+	mapper := NewLtxMapper()
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ", "", ""))
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "Deacon", "", "", "gr_gr_cog/actors/Deacon"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "Choir", "", "", "en_us_dedes/actors/Missing"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "Self", "", "", "en_us_dedes/actors/Self"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "A", "", "", "en_us_dedes/actors/B"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "B", "", "", "en_us_dedes/actors/A"))
+	r, chain, err := ltxstore.Resolve(mapper, "en_us_dedes/actors/Deacon")
+	if err != nil || r == nil || r.Value != "ΙΕΡΕΥΣ" || len(chain) != 3 {
+		t.Errorf("Resolve en_us_dedes/actors/Deacon, got %v %v: %v", r, chain, err)
+	}
+	if r, _, err = ltxstore.Resolve(mapper, "en_us_dedes/actors/Nothing"); r != nil || err != nil {
+		t.Errorf("Resolve a missing id, expected nil, got %v: %v", r, err)
+	}
+	tests := map[string]string{
+		"en_us_dedes/actors/Choir": ltxstore.RedirectDangling,
+		"en_us_dedes/actors/Self":  ltxstore.RedirectSelf,
+		"en_us_dedes/actors/A":     ltxstore.RedirectCycle,
+	}
+	for id, kind := range tests {
+		_, _, err = ltxstore.Resolve(mapper, id)
+		if e, ok := err.(*ltxstore.RedirectError); !ok || e.Kind != kind {
+			t.Errorf("Resolve %s, expected a %s redirect error, got %v", id, kind, err)
+		}
+	}
+	report, err := ltxstore.CheckRedirects(mapper, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 6 || len(report.Dangling) != 1 || len(report.Self) != 1 || len(report.Cyclic) != 2 || len(report.Chains) != 1 {
+		t.Errorf("CheckRedirects, unexpected report: %+v", report)
+	}
+	if libraries := report.Libraries(); len(libraries) != 1 || libraries[0] != "en_us_dedes" {
+		t.Errorf("CheckRedirects, expected problems in en_us_dedes, got %v", libraries)
+	}
+	report, _ = ltxstore.CheckRedirects(mapper, "gr_gr_cog/%")
+	if report.Checked != 1 || !report.OK() || len(report.Chains) != 0 {
+		t.Errorf("CheckRedirects gr_gr_cog, unexpected report: %+v", report)
+	}
+}
+func TestEdit(t *testing.T) {
+	mapper := NewLtxMapper()
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ", "", ""))
+	mapper.Merge(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"))
+	mapper.Merge(models.NewLtx("en_us_dedes", "actors", "Priest", "", "", "gr_gr_cog/actors/Priest"))
+
+	// a dry run does not change anything
+	changes, err := ltxstore.Copy(mapper, "gr_gr_cog", "en_us_new", ltxstore.EditOptions{DryRun: true})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("Copy dry run, expected 2 changes, got %v: %v", changes, err)
+	}
+	if records, _ := ltxstore.Under(mapper, "en_us_new"); len(records) != 0 {
+		t.Errorf("Copy dry run, expected no records, got %v", records)
+	}
+	if _, err = ltxstore.Copy(mapper, "gr_gr_cog", "en_us_new", ltxstore.EditOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := mapper.ReadById("en_us_new/actors/Deacon")
+	if r == nil || r.Redirect != "en_us_new/actors/Priest" {
+		t.Errorf("Copy, expected the redirect to be copied to the new library, got %v", r)
+	}
+	if _, err = ltxstore.Copy(mapper, "gr_gr_cog", "en_us_new", ltxstore.EditOptions{}); err == nil {
+		t.Error("Copy to existing records, expected an error")
+	}
+
+	// moving a topic rewrites the redirects to it
+	changes, err = ltxstore.Move(mapper, "gr_gr_cog/actors", "gr_gr_cog/people", ltxstore.EditOptions{})
+	if err != nil || len(changes) != 5 {
+		t.Fatalf("Move, expected 5 changes, got %v: %v", changes, err)
+	}
+	if r, _ = mapper.ReadById("en_us_dedes/actors/Priest"); r == nil || r.Redirect != "gr_gr_cog/people/Priest" {
+		t.Errorf("Move, expected the redirect to be rewritten, got %v", r)
+	}
+	if r, _ = mapper.ReadById("gr_gr_cog/people/Deacon"); r == nil || r.Redirect != "gr_gr_cog/people/Priest" {
+		t.Errorf("Move, expected the redirect to move, got %v", r)
+	}
+	if mapper.Exists("gr_gr_cog", "actors", "Priest") {
+		t.Error("Move, expected gr_gr_cog/actors/Priest to be deleted")
+	}
+
+	// removing a record others redirect to needs force
+	if _, err = ltxstore.Remove(mapper, "gr_gr_cog/people/Priest", ltxstore.EditOptions{}); err == nil {
+		t.Error("Remove a record redirected to, expected an error")
+	}
+	changes, err = ltxstore.Remove(mapper, "gr_gr_cog/people", ltxstore.EditOptions{Force: true})
+	if err != nil || len(changes) != 3 || changes[2].Kind != ltxstore.ChangeDangling {
+		t.Errorf("Remove with force, unexpected changes %v: %v", changes, err)
+	}
+	if records, _ := ltxstore.Under(mapper, "gr_gr_cog"); len(records) != 0 {
+		t.Errorf("Remove, expected no records, got %v", records)
+	}
+
+	if _, err = ltxstore.Make(mapper, "en_us_new/actors/Reader", ltxstore.EditOptions{}); err != nil || !mapper.Exists("en_us_new", "actors", "Reader") {
+		t.Errorf("Make, expected the record to exist: %v", err)
+	}
+	if _, err = ltxstore.Make(mapper, "en_us_new/actors", ltxstore.EditOptions{}); err == nil {
+		t.Error("Make a topic, expected an error")
+	}
+}
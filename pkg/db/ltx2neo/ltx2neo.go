@@ -0,0 +1,149 @@
+/**
+Package ltx2neo writes liturgical text records as a Cypher script,
+to feed the graph of the Online Liturgical Workbench (OLW) from doxa.
+The script can be run offline, e.g.
+
+  cypher-shell -u neo4j -p password -f ltx.cypher
+
+Each record is a node with the label Text, and an id in the form used by OLW,
+e.g. gr_gr_cog~actors~Priest (see models.Id.ToNeoId).  A record that redirects
+to another has a REDIRECTS_TO relationship to it.  The nodes are merged on their id,
+so the script can be run again to update the graph.  A relationship to a record that
+is not in the graph is not created.
+
+The constraint on Text ids uses the syntax of Neo4j 3.5 and 4.x.
+ */
+package ltx2neo
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io"
+	"strings"
+)
+
+// DefaultBatchSize is the number of nodes or relationships merged by each statement
+const DefaultBatchSize = 1000
+
+// CypherWriter writes records as a Cypher script.  The nodes are written in batches
+// as records are written.  The relationships are written by Close, after all the nodes exist.
+type CypherWriter struct {
+	w             *bufio.Writer
+	batchSize     int
+	nodes         []*models.Ltx
+	redirects     []models.Redirect
+	Nodes         int // the number of nodes written
+	Relationships int // the number of relationships written
+}
+
+// NewCypherWriter returns a writer of records to w, after writing the constraint on Text ids.
+// If batchSize is less than one, DefaultBatchSize is used.
+func NewCypherWriter(w io.Writer, batchSize int) (*CypherWriter, error) {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	c := &CypherWriter{w: bufio.NewWriter(w), batchSize: batchSize}
+	_, err := c.w.WriteString("// liturgical text records, generated by doxa\nCREATE CONSTRAINT ON (t:Text) ASSERT t.id IS UNIQUE;\n")
+	return c, err
+}
+
+// Write adds a record to the script
+func (c *CypherWriter) Write(l *models.Ltx) error {
+	c.nodes = append(c.nodes, l)
+	if len(l.Redirect) > 0 {
+		c.redirects = append(c.redirects, models.Redirect{ID: NeoId(l.ID), Redirect: NeoId(l.Redirect)})
+	}
+	if len(c.nodes) >= c.batchSize {
+		return c.writeNodes()
+	}
+	return nil
+}
+
+// Close writes the remaining nodes and the relationships, and flushes the script.
+// It does not close the underlying writer.
+func (c *CypherWriter) Close() error {
+	if err := c.writeNodes(); err != nil {
+		return err
+	}
+	for start := 0; start < len(c.redirects); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(c.redirects) {
+			end = len(c.redirects)
+		}
+		var rows []string
+		for _, r := range c.redirects[start:end] {
+			rows = append(rows, fmt.Sprintf("{from: %s, to: %s}", Quote(r.ID), Quote(r.Redirect)))
+		}
+		_, err := fmt.Fprintf(c.w, "UNWIND [\n%s\n] AS r\nMATCH (a:Text {id: r.from}), (b:Text {id: r.to})\nMERGE (a)-[:REDIRECTS_TO]->(b);\n",
+			strings.Join(rows, ",\n"))
+		if err != nil {
+			return err
+		}
+		c.Relationships += end - start
+	}
+	c.redirects = nil
+	return c.w.Flush()
+}
+
+func (c *CypherWriter) writeNodes() error {
+	if len(c.nodes) == 0 {
+		return nil
+	}
+	var rows []string
+	for _, l := range c.nodes {
+		rows = append(rows, fmt.Sprintf("{id: %s, library: %s, topic: %s, key: %s, value: %s, nnp: %s, nwp: %s, comment: %s, createdWhen: %s, modifiedWhen: %s}",
+			Quote(NeoId(l.ID)), Quote(l.Library), Quote(l.Topic), Quote(l.Key), Quote(l.Value), Quote(l.NNP), Quote(l.NWP),
+			Quote(l.Comment), Quote(l.CreatedWhen), Quote(l.ModifiedWhen)))
+	}
+	_, err := fmt.Fprintf(c.w, "UNWIND [\n%s\n] AS r\nMERGE (t:Text {id: r.id})\nSET t += r;\n", strings.Join(rows, ",\n"))
+	if err != nil {
+		return err
+	}
+	c.Nodes += len(c.nodes)
+	c.nodes = c.nodes[:0]
+	return nil
+}
+
+// WriteCypher writes the records as a Cypher script
+func WriteCypher(w io.Writer, records []*models.Ltx) error {
+	c, err := NewCypherWriter(w, DefaultBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, l := range records {
+		if err = c.Write(l); err != nil {
+			return err
+		}
+	}
+	return c.Close()
+}
+
+// NeoId converts an id from the form library/topic/key to the form used by OLW, library~topic~key
+func NeoId(id string) string {
+	return strings.Replace(id, models.IDDelimiter, "~", 2)
+}
+
+// Quote returns s as a Cypher string literal
+func Quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
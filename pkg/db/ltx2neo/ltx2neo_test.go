@@ -0,0 +1,43 @@
+package ltx2neo
+
+import (
+	"bytes"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestWriteCypher(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewCypherWriter(&buf, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write(models.NewLtx("gr_gr_cog", "actors", "Priest", "ΙΕΡΕΥΣ", "", ""))
+	c.Write(models.NewLtx("gr_gr_cog", "actors", "Deacon", "", "", "gr_gr_cog/actors/Priest"))
+	c.Write(models.NewLtx("en_us_dedes", "actors", "Priest", "Priest's", "", ""))
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Nodes != 3 || c.Relationships != 1 {
+		t.Errorf("expected 3 nodes and 1 relationship, got %d and %d", c.Nodes, c.Relationships)
+	}
+	script := buf.String()
+	if n := strings.Count(script, "MERGE (t:Text {id: r.id})"); n != 2 {
+		t.Errorf("expected 2 batches of nodes, got %d:\n%s", n, script)
+	}
+	for _, s := range []string{
+		`{from: 'gr_gr_cog~actors~Deacon', to: 'gr_gr_cog~actors~Priest'}`,
+		`value: 'Priest\'s'`,
+		`MERGE (a)-[:REDIRECTS_TO]->(b);`,
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("expected the script to contain %s:\n%s", s, script)
+		}
+	}
+}
+func TestQuote(t *testing.T) {
+	if got := Quote("a'b\\c\nd"); got != `'a\'b\\c\nd'` {
+		t.Errorf("Quote, got %s", got)
+	}
+}
@@ -0,0 +1,73 @@
+package ltx2sql
+
+import (
+	"database/sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"time"
+)
+
+// SQL to create the table that holds the history of changes to ltx.
+// Each row holds the value, redirect, and comment a record had before a change.
+// This is migration 2.
+var SQLCreateHistoryTable = `CREATE TABLE IF NOT EXISTS ltx_history (
+    revision      INTEGER PRIMARY KEY AUTOINCREMENT,
+    id            TEXT,
+    value         TEXT,
+    redirect      TEXT,
+    comment       TEXT,
+    changedBy     TEXT,
+    changedWhen   TEXT);
+CREATE INDEX IF NOT EXISTS ltx_history_id ON ltx_history(id);`
+
+// SQL to add a row to the history
+var SQLInsertHistory = `INSERT INTO ltx_history (id, value, redirect, comment, changedBy, changedWhen) VALUES (?, ?, ?, ?, ?, ?)`
+
+// SQL to read the history of a record
+var SQLHistoryForID = `SELECT id, value, redirect, comment, changedBy, changedWhen FROM ltx_history WHERE id = $1 ORDER BY revision`
+
+// Sets who is recorded in the history as making subsequent changes
+func (m *LtxMapper) SetUser(user string) {
+	m.User = user
+}
+// Returns the revisions of the record with the specified id, oldest first, numbered from 1
+func (m *LtxMapper) History(id string) ([]models.LtxRevision, error) {
+	var records []models.LtxRevision
+	rows, err := m.DB.Query(SQLHistoryForID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r models.LtxRevision
+		err = rows.Scan(&r.ID, &r.Value, &r.Redirect, &r.Comment, &r.ChangedBy, &r.ChangedWhen)
+		if err != nil {
+			return nil, err
+		}
+		r.Revision = len(records) + 1
+		records = append(records, r)
+	}
+	err = rows.Err()
+	return records, err
+}
+// Sets the value, redirect, and comment of the record to those of the revision
+func (m *LtxMapper) Revert(id string, revision int) error {
+	return ltxstore.ApplyRevision(m, id, revision)
+}
+// addHistory adds the current value, redirect, and comment of the record to the history,
+// unless the record does not exist, or next would not change them.  Next is nil for a delete.
+func (m *LtxMapper) addHistory(tx *sql.Tx, id string, next *models.Ltx) error {
+	var r models.LtxRevision
+	err := tx.QueryRow(`SELECT value, redirect, comment FROM ltx WHERE id = $1`, id).Scan(&r.Value, &r.Redirect, &r.Comment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if next != nil && next.Value == r.Value && next.Redirect == r.Redirect && next.Comment == r.Comment {
+		return nil
+	}
+	_, err = tx.Exec(SQLInsertHistory, id, r.Value, r.Redirect, r.Comment, m.User, time.Now().UTC().String())
+	return err
+}
@@ -22,6 +22,7 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/models"
 	"log"
 	"strconv"
@@ -33,10 +34,44 @@ import (
 const IDDelimiter = "/"
 
 type LtxMapper struct {
-	DB *sql.DB
+	DB   *sql.DB
+	User string // who is recorded in the history as making changes
+}
+
+// LtxMapper is the sqlite3 implementation of ltxstore.LtxStore
+var _ ltxstore.LtxStore = (*LtxMapper)(nil)
+
+// NewLtxMapper opens the sqlite3 database at dbPath, migrates its schema to
+// the latest version, creates the full text search index if it does not exist,
+// and returns a mapper for it.
+// If sqlite was built without FTS5, the index is not created, and a database
+// that already has it is refused with ErrSearchIndexWithoutFTS5.
+func NewLtxMapper(dbPath string) (*LtxMapper, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if hasSearchIndex(db) && !HasFTS5(db) {
+		db.Close()
+		return nil, ErrSearchIndexWithoutFTS5
+	}
+	if err = MigrateUp(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err = CreateSearchIndex(db); err != nil && err != ErrNoFTS5 {
+		db.Close()
+		return nil, err
+	}
+	return &LtxMapper{DB: db, User: ltxstore.DefaultUser()}, nil
 }
 // SQL to create the table schema for the struct.  If the table exists,
-// it will be left untouched.
+// it will be left untouched.  This is migration 1.  Changes to the table
+// must be made by adding a migration, not by editing this.
 var SQLCreateTable = `CREATE TABLE IF NOT EXISTS ltx (
     id            TEXT PRIMARY KEY,
     library       TEXT,
@@ -54,12 +89,15 @@ var SQLCreateTable = `CREATE TABLE IF NOT EXISTS ltx (
 // SQL to insert a row for the struct into a database.
 var sqlInsert = `INSERT INTO ltx (id, library, topic, key, value, nnp, nwp, comment, redirect, createdWhen, modifiedWhen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-// SQL to insert or replace (merge) a row for the struct into database.
+// SQL to insert or update (merge) a row for the struct into database.
 //  This is used for insertions in an existing database where you want a row to be created if it does not exist, or to be replaced if it does.
-var SQLMerge = `INSERT OR REPLACE INTO ltx (id, library, topic, key, value, nnp, nwp, comment, redirect, createdWhen, modifiedWhen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+//  An upsert is used rather than INSERT OR REPLACE, so the rowid is kept and the full text search triggers fire.
+var SQLMerge = `INSERT INTO ltx (id, library, topic, key, value, nnp, nwp, comment, redirect, createdWhen, modifiedWhen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT(id) DO UPDATE SET library = excluded.library, topic = excluded.topic, key = excluded.key, value = excluded.value, nnp = excluded.nnp, nwp = excluded.nwp,
+    comment = excluded.comment, redirect = excluded.redirect, createdWhen = excluded.createdWhen, modifiedWhen = excluded.modifiedWhen`
 
 // SQL to delete a record by id
-var SQLDelete = `DELETE ltx WHERE id = $1`
+var SQLDelete = `DELETE FROM ltx WHERE id = $1`
 
 // SQL to record count like id
 var SQLCountIDLike = `SELECT COUNT(*) FROM ltx WHERE id like $1`
@@ -74,10 +112,7 @@ var SQLTopicsForLibrary = `SELECT DISTINCT topic FROM ltx WHERE id LIKE $1 ORDER
 var SQLKeysForTopic = `SELECT DISTINCT key FROM ltx WHERE id LIKE $1 ORDER BY key COLLATE NOCASE ASC`
 
 // used to hold results of query for redirects that are not blank
-type Redirect struct {
-	ID       string
-	Redirect string
-}
+type Redirect = models.Redirect
 // Get the delimiter used in Database IDs
 func (m *LtxMapper) IDDelimiter() string {
 	return IDDelimiter
@@ -111,10 +146,47 @@ func (m *LtxMapper) BulkInsert(in <-chan *models.Ltx) error {
 	err = tx.Commit()
 	return err
 }
-// Creates or updates a row from the struct in the database table using SQL MERGE
+// Creates or updates a row from the struct in the database table using SQL MERGE.
+// If the row is updated, its previous value, redirect, and comment are added to the history.
 func (m *LtxMapper) Merge(l *models.Ltx) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err = m.merge(tx, l); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+// Merges the records, then deletes the rows for the ids, in one database transaction.
+// If any of them fails, the transaction is rolled back, so none of the changes are made.
+func (m *LtxMapper) Apply(merges []*models.Ltx, deletes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, l := range merges {
+		if err = m.merge(tx, l); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %v", l.ID, err)
+		}
+	}
+	for _, id := range deletes {
+		if err = m.delete(tx, id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %v", id, err)
+		}
+	}
+	return tx.Commit()
+}
+// merge adds the row to the history, if it exists, and merges the record in the transaction
+func (m *LtxMapper) merge(tx *sql.Tx, l *models.Ltx) error {
 	l.ModifiedWhen = time.Now().UTC().String()
-	_, err := m.DB.Exec(SQLMerge, l.ID, l.Library, l.Topic, l.Key, l.Value, l.NNP, l.NWP, l.Comment, l.Redirect, l.CreatedWhen, l.ModifiedWhen)
+	err := m.addHistory(tx, l.ID, l)
+	if err == nil {
+		_, err = tx.Exec(SQLMerge, l.ID, l.Library, l.Topic, l.Key, l.Value, l.NNP, l.NWP, l.Comment, l.Redirect, l.CreatedWhen, l.ModifiedWhen)
+	}
 	return err
 }
 // Read (by id) returns a struct populated by reading the database table for the specified id
@@ -168,7 +240,7 @@ func (m *LtxMapper) ReadByNNP(id, substring string) ([]*models.Ltx, error) {
 // substring is what is being searched for.
 func (m *LtxMapper) ReadByNWP(id, substring string) ([]*models.Ltx, error) {
 	if len(id) > 0 {
-		return m.Query("id LIKE $1 and nwp LIKE $2 ESCAPE '\\'", true, id, fmt.Sprintf("%s%%%s%%", id, substring))
+		return m.Query("id LIKE $1 and nwp LIKE $2 ESCAPE '\\'", true, id, fmt.Sprintf("%%%s%%", substring))
 	} else {
 		return m.Query("nwp like $1 ESCAPE '\\'", true, fmt.Sprintf("%%%s%%", substring))
 	}
@@ -338,8 +410,8 @@ func (m *LtxMapper) Distinct(column, like string) ([] string, error) {
 	return records, err
 }
 // Returns an array of the records with redirects
-func (m *LtxMapper) Redirects(like string) ([]Redirect, error) {
-	var records []Redirect
+func (m *LtxMapper) Redirects(like string) ([]models.Redirect, error) {
+	var records []models.Redirect
 	var q string
 	if len(like) > 0 {
 		q = fmt.Sprintf(`SELECT id, redirect FROM ltx WHERE id LIKE "%s" AND length(redirect) > 0 ORDER BY id;`, like)
@@ -364,7 +436,7 @@ func (m *LtxMapper) Redirects(like string) ([]Redirect, error) {
 			return nil, err
 		}
 		if len(id) > 0 {
-			var redirect Redirect
+			var redirect models.Redirect
 			redirect.ID = id
 			redirect.Redirect = to
 			records = append(records, redirect)
@@ -374,8 +446,8 @@ func (m *LtxMapper) Redirects(like string) ([]Redirect, error) {
 	return records, err
 }
 // Returns an array of the redirects to specified id
-func (m *LtxMapper) ReferredTo(by string) ([]Redirect, error) {
-	var records []Redirect
+func (m *LtxMapper) ReferredTo(by string) ([]models.Redirect, error) {
+	var records []models.Redirect
 	var q string = fmt.Sprintf(`SELECT id, redirect FROM ltx WHERE redirect = "%s" ORDER BY redirect;`, by)
 	rows, err := m.DB.Query(q)
 	if err != nil {
@@ -395,7 +467,7 @@ func (m *LtxMapper) ReferredTo(by string) ([]Redirect, error) {
 			return nil, err
 		}
 		if len(id) > 0 {
-			var redirect Redirect
+			var redirect models.Redirect
 			redirect.ID = id
 			redirect.Redirect = to
 			records = append(records, redirect)
@@ -435,9 +507,25 @@ func (m *LtxMapper) Empty(like string) ([]string, error) {
 	err = rows.Err()
 	return records, err
 }
-// Deletes a row from the struct in the database table for the specified id
+// Deletes a row from the struct in the database table for the specified id.
+// The row is added to the history, so the delete can be reverted.
 func (m *LtxMapper) Delete(id string) error {
-	_, err := m.DB.Exec(SQLDelete, id)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err = m.delete(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+// delete adds the row to the history and deletes it in the transaction
+func (m *LtxMapper) delete(tx *sql.Tx, id string) error {
+	err := m.addHistory(tx, id, nil)
+	if err == nil {
+		_, err = tx.Exec(SQLDelete, id)
+	}
 	return err
 }
 // returns the count for id like specified library, topic, key
@@ -513,9 +601,13 @@ func (m *LtxMapper) CountKeys(library, topic, key string) (int, error) {
 	return count, err
 }
 func (m *LtxMapper) CaseSensitiveLike(on bool) error {
-	_,err := m.DB.Exec("PRAGMA case_sensitive_like = true;")
+	_,err := m.DB.Exec(fmt.Sprintf("PRAGMA case_sensitive_like = %t;", on))
 	return err
 }
+// Closes the database
+func (m *LtxMapper) Close() error {
+	return m.DB.Close()
+}
 // Verifies a record exists in the database for the specified library, topic, and key
 func (m *LtxMapper) Exists(library, topic, key string) bool {
 	c, _ := m.CountKeys(library, topic, key)
@@ -538,7 +630,7 @@ func NewLtx(library, topic, key, value, comment, redirect string) *models.Ltx {
 	id.Topic = topic
 	id.Key = key
 	l := models.Ltx{}
-	l.ID = id.ToNeoId()
+	l.ID = id.ToSQLId()
 	l.Library = library
 	l.Topic = topic
 	l.Key = key
@@ -3,8 +3,12 @@ package ltx2sql
 import (
 	"database/sql"
 	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/models"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +30,11 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	err = DropSearchIndex(theDb)
+	if err!= nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 	_, err = theDb.Exec("DROP TABLE IF EXISTS ltx")
 	if err!= nil {
 		fmt.Println(err.Error())
@@ -36,6 +45,16 @@ func TestMain(m *testing.M) {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	_, err = theDb.Exec("DROP TABLE IF EXISTS ltx_history")
+	if err!= nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	_, err = theDb.Exec(SQLCreateHistoryTable)
+	if err!= nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 	mapper.DB = theDb
 	os.Exit(m.Run())
 }
@@ -86,7 +105,7 @@ func TestMapper_Create(t *testing.T) {
 		t.Error(fmt.Sprintf("Merge %s: %v", u.ID, err))
 	}
 	v := "Deacon"
-	records, err = mapper.ReadByValue(v)
+	records, err = mapper.ReadByValue("", v)
 	if err != nil {
 		t.Error(fmt.Sprintf("ReadByValue %s: %v", v, err))
 	}
@@ -96,4 +115,180 @@ func TestMapper_Create(t *testing.T) {
 	if len(records) != 2 {
 		t.Error(fmt.Sprintf("ReadByValue %s, expected 2, got: %v", v, len(records)))
 	}
-}
\ No newline at end of file
+}
+func TestMapper_Search(t *testing.T) {
+	err := CreateSearchIndex(mapper.DB)
+	if err != nil && err != ErrNoFTS5 {
+		t.Fatalf("CreateSearchIndex: %v", err)
+	}
+	library := "en_us_dedes"
+	topic := "le.go.me"
+	mapper.Merge(models.NewLtx(library, topic, "key1", "Lord, have mercy.", "", ""))
+	mapper.Merge(models.NewLtx(library, topic, "key2", "Lord, have mercy. Lord, have mercy. Lord, have mercy.", "", ""))
+	mapper.Merge(models.NewLtx(library, topic, "key3", "Glory to the Father", "", ""))
+	q := "mercy"
+	records, err := mapper.Search(q, ltxstore.SearchOptions{Column: "nnp", Like: library + "/%"})
+	if err != nil {
+		t.Fatalf("Search %s: %v", q, err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Search %s, expected 2, got: %v", q, len(records))
+	}
+	if records[0].Key != "key2" {
+		t.Error(fmt.Sprintf("Search %s, expected key2 to rank first, got: %s", q, records[0].Key))
+	}
+	q = `"to the" OR merc*`
+	records, _ = mapper.Search(q, ltxstore.SearchOptions{Like: library + "/%"})
+	if len(records) != 3 {
+		t.Error(fmt.Sprintf("Search %s, expected 3, got: %v", q, len(records)))
+	}
+	// the index must follow updates and deletes
+	mapper.Merge(models.NewLtx(library, topic, "key3", "Glory to the Son", "", ""))
+	q = "father"
+	records, _ = mapper.Search(q, ltxstore.SearchOptions{})
+	if len(records) != 0 {
+		t.Error(fmt.Sprintf("Search %s after update, expected 0, got: %v", q, len(records)))
+	}
+	mapper.Delete(library + "/" + topic + "/key1")
+	q = "mercy"
+	records, _ = mapper.Search(q, ltxstore.SearchOptions{})
+	if len(records) != 1 {
+		t.Error(fmt.Sprintf("Search %s after delete, expected 1, got: %v", q, len(records)))
+	}
+	_, err = mapper.Search("mercy", ltxstore.SearchOptions{Column: "comment"})
+	if err == nil {
+		t.Error("Search comment column, expected an error")
+	}
+}
+func TestMapper_History(t *testing.T) {
+	mapper.SetUser("tester")
+	l := models.NewLtx("en_us_test", "actors", "Priest", "Priest", "", "")
+	id := l.ID
+	mapper.Merge(l)
+	l.SetValue("PRIEST")
+	mapper.Merge(l)
+	mapper.Merge(l) // no change, so no revision
+	l.Comment = "upper case"
+	mapper.Merge(l)
+	revisions, err := mapper.History(id)
+	if err != nil {
+		t.Fatalf("History %s: %v", id, err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("History %s, expected 2, got: %v", id, len(revisions))
+	}
+	if revisions[0].Revision != 1 || revisions[0].Value != "Priest" || revisions[0].ChangedBy != "tester" {
+		t.Error(fmt.Sprintf("History %s, unexpected first revision: %v", id, revisions[0]))
+	}
+	err = mapper.Revert(id, 1)
+	if err != nil {
+		t.Fatalf("Revert %s 1: %v", id, err)
+	}
+	r, _ := mapper.ReadById(id)
+	if r.Value != "Priest" || r.NNP != "priest" || r.Comment != "" {
+		t.Error(fmt.Sprintf("Revert %s 1, unexpected record: %v", id, r))
+	}
+	mapper.Delete(id)
+	err = mapper.Revert(id, 4)
+	if err != nil {
+		t.Fatalf("Revert %s 4: %v", id, err)
+	}
+	r, _ = mapper.ReadById(id)
+	if r == nil || r.Value != "Priest" || r.Library != "en_us_test" {
+		t.Error(fmt.Sprintf("Revert %s after delete, unexpected record: %v", id, r))
+	}
+	if err = mapper.Revert(id, 99); err == nil {
+		t.Error(fmt.Sprintf("Revert %s 99, expected an error", id))
+	}
+}
+func TestMapper_Apply(t *testing.T) {
+	mapper.Merge(models.NewLtx("en_us_apply", "actors", "Priest", "Priest", "", ""))
+	mapper.Merge(models.NewLtx("en_us_apply", "actors", "Deacon", "Deacon", "", ""))
+	mapper.Merge(models.NewLtx("en_us_other", "actors", "Priest", "", "", "en_us_apply/actors/Priest"))
+	// the copy of the second record fails, after the first is copied
+	_, err := mapper.DB.Exec(`CREATE TRIGGER refuse_apply BEFORE INSERT ON ltx WHEN NEW.id = 'en_us_apply/people/Priest'
+    BEGIN SELECT RAISE(ABORT, 'refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapper.DB.Exec("DROP TRIGGER refuse_apply")
+	changes, err := ltxstore.Move(mapper, "en_us_apply/actors", "en_us_apply/people", ltxstore.EditOptions{})
+	if err == nil || len(changes) != 0 {
+		t.Fatalf("Move, expected an error and no changes, got %v: %v", changes, err)
+	}
+	if mapper.Exists("en_us_apply", "people", "Deacon") {
+		t.Error("Move failed, expected en_us_apply/people/Deacon to be rolled back")
+	}
+	if !mapper.Exists("en_us_apply", "actors", "Priest") || !mapper.Exists("en_us_apply", "actors", "Deacon") {
+		t.Error("Move failed, expected en_us_apply/actors to be kept")
+	}
+	if r, _ := mapper.ReadById("en_us_other/actors/Priest"); r == nil || r.Redirect != "en_us_apply/actors/Priest" {
+		t.Errorf("Move failed, expected the redirect to be kept, got %v", r)
+	}
+}
+func TestMapper_Import(t *testing.T) {
+	_, err := mapper.DB.Exec(`CREATE TRIGGER refuse_import BEFORE INSERT ON ltx WHEN NEW.id = 'en_us_import/actors/Priest'
+    BEGIN SELECT RAISE(ABORT, 'refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapper.DB.Exec("DROP TRIGGER refuse_import")
+	records := []*models.Ltx{
+		{ID: "en_us_import/actors/Deacon", Value: "Deacon"},
+		{ID: "en_us_import/actors/Priest", Value: "Priest"},
+	}
+	if n, err := ltxstore.Import(mapper, records); n != 0 || err == nil {
+		t.Fatalf("Import, expected an error and none merged, got %d: %v", n, err)
+	}
+	if mapper.Exists("en_us_import", "actors", "Deacon") {
+		t.Error("Import failed, expected en_us_import/actors/Deacon to be rolled back")
+	}
+}
+func TestMapper_LikeMatchesMem(t *testing.T) {
+	mem := ltx2mem.NewLtxMapper()
+	for _, l := range []*models.Ltx{
+		models.NewLtx("en_us_like", "greek", "Upper", "ΑΓΙΟΣ Holy", "", ""),
+		models.NewLtx("en_us_like", "greek", "lower", "αγιος holy", "", ""),
+		models.NewLtx("en_us_like", "path", "back", "a\\b", "", ""),
+		models.NewLtx("en_us_like", "path", "percent", "100%", "", ""),
+	} {
+		mapper.Merge(l)
+		mem.Merge(l)
+	}
+	// the ids are matched without an escape character, the values with \ as the escape character
+	data := []struct {
+		id, substring string
+	}{
+		{"en_us_like/%", "ΑΓΙΟΣ"},
+		{"en_us_like/%", "αγιος"},
+		{"en_us_like/%", "HOLY"},
+		{"EN_US_LIKE/GREEK/%", ""},
+		{"en_us_like/greek/UPPER", ""},
+		{"en_us_like/GREEK/lowe_", "Α"},
+		{"en\\_us\\_like/%", ""},
+		{"en_us_like/path/%", "\\%"},
+		{"en_us_like/path/%", "\\\\"},
+		{"en_us_like/path/%", "a\\b"},
+	}
+	ids := func(records []*models.Ltx) string {
+		var result []string
+		for _, r := range records {
+			result = append(result, r.ID)
+		}
+		sort.Strings(result)
+		return strings.Join(result, " ")
+	}
+	for _, d := range data {
+		fromSql, err := mapper.ReadByValue(d.id, d.substring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromMem, err := mem.ReadByValue(d.id, d.substring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids(fromSql) != ids(fromMem) {
+			t.Errorf("ReadByValue(%s, %s): ltx2sql found '%s', but ltx2mem found '%s'", d.id, d.substring, ids(fromSql), ids(fromMem))
+		}
+	}
+}
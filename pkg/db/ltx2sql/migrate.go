@@ -0,0 +1,134 @@
+package ltx2sql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The schema of the database is created and changed by migrations.
+// Each migration has a version, and the versions applied to a database
+// are recorded in its schema_version table.  To change the schema, append
+// a migration to Migrations.  Do not edit a migration that has been released,
+// since databases that already have it will not apply it again.
+// The full text search index is not a migration, because it depends on
+// how sqlite was built.  See CreateSearchIndex.
+
+// Migration changes the schema from Version-1 to Version (Up), or back (Down)
+type Migration struct {
+	Version     int
+	Description string
+	Up          string
+	Down        string
+}
+
+// SQL to create the table that records the migrations applied to a database
+var SQLCreateSchemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+    version       INTEGER PRIMARY KEY,
+    description   TEXT,
+    appliedWhen   TEXT);`
+
+// Migrations, ordered by version.  The versions must start at 1 and have no gaps.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create table ltx",
+		Up:          SQLCreateTable,
+		Down:        SQLDropSearchIndex + "\nDROP TABLE IF EXISTS ltx;",
+	},
+	{
+		Version:     2,
+		Description: "create table ltx_history",
+		Up:          SQLCreateHistoryTable,
+		Down:        "DROP INDEX IF EXISTS ltx_history_id;\nDROP TABLE IF EXISTS ltx_history;",
+	},
+	{
+		Version:     3,
+		Description: "create tables ares_file and ares_key for incremental loads",
+		Up:          SQLCreateAresTables,
+		Down:        "DROP INDEX IF EXISTS ares_key_file;\nDROP TABLE IF EXISTS ares_key;\nDROP TABLE IF EXISTS ares_file;",
+	},
+}
+
+// SQL to create the tables used to load ares files incrementally.
+// ares_file has the hash of each ares file (or the commit of each repository) when it was last loaded.
+// ares_key has the hash of the value, redirect, and comment of each key as loaded from its ares file,
+// so that keys that have been edited locally since then can be recognized.
+var SQLCreateAresTables = `CREATE TABLE IF NOT EXISTS ares_file (
+    name          TEXT PRIMARY KEY,
+    hash          TEXT,
+    loadedWhen    TEXT);
+CREATE TABLE IF NOT EXISTS ares_key (
+    id            TEXT PRIMARY KEY,
+    file          TEXT,
+    hash          TEXT);
+CREATE INDEX IF NOT EXISTS ares_key_file ON ares_key(file);`
+
+// LatestVersion returns the version of the last migration
+func LatestVersion() int {
+	return len(Migrations)
+}
+// SchemaVersion returns the version of the schema of the database.
+// Zero means no migration has been applied.
+func SchemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(SQLCreateSchemaVersionTable); err != nil {
+		return -1, err
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return -1, err
+	}
+	return version, nil
+}
+// MigrateUp applies the migrations the database does not have yet
+func MigrateUp(db *sql.DB) error {
+	return MigrateTo(db, LatestVersion())
+}
+// MigrateTo applies the up migrations or the down migrations needed to
+// change the schema of the database to the specified version.
+// Each migration is applied in its own transaction.
+func MigrateTo(db *sql.DB, version int) error {
+	if version < 0 || version > LatestVersion() {
+		return fmt.Errorf("ltx2sql: schema version %d does not exist, the latest is %d", version, LatestVersion())
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return fmt.Errorf("ltx2sql: the database schema version %d is newer than the latest known version %d", current, LatestVersion())
+	}
+	for v := current + 1; v <= version; v++ {
+		m := Migrations[v-1]
+		err = migrate(db, m.Up, `INSERT INTO schema_version (version, description, appliedWhen) VALUES ($1, $2, $3)`,
+			m.Version, m.Description, time.Now().UTC().String())
+		if err != nil {
+			return fmt.Errorf("ltx2sql: migrate up to %d (%s): %v", m.Version, m.Description, err)
+		}
+	}
+	for v := current; v > version; v-- {
+		m := Migrations[v-1]
+		err = migrate(db, m.Down, `DELETE FROM schema_version WHERE version = $1`, m.Version)
+		if err != nil {
+			return fmt.Errorf("ltx2sql: migrate down from %d (%s): %v", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
+// migrate executes the statements of a migration, and then the
+// statement that records it in the schema_version table.
+func migrate(db *sql.DB, statements string, record string, v ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(statements); err == nil {
+		_, err = tx.Exec(record, v...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package ltx2sql
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestMigrateTo(t *testing.T) {
+	dbPath := "migrate_test.db"
+	os.Remove(dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	if err = MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	v, _ := SchemaVersion(db)
+	if v != LatestVersion() {
+		t.Errorf("MigrateUp: expected version %d, got %d", LatestVersion(), v)
+	}
+	// applying again must do nothing
+	if err = MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp twice: %v", err)
+	}
+	if _, err = db.Exec(SQLInsertHistory, "a/b/c", "", "", "", "", ""); err != nil {
+		t.Errorf("insert into ltx_history: %v", err)
+	}
+	if err = MigrateTo(db, 1); err != nil {
+		t.Fatalf("MigrateTo 1: %v", err)
+	}
+	if _, err = db.Exec(SQLInsertHistory, "a/b/c", "", "", "", "", ""); err == nil {
+		t.Error("MigrateTo 1: expected ltx_history to be dropped")
+	}
+	if err = MigrateTo(db, 0); err != nil {
+		t.Fatalf("MigrateTo 0: %v", err)
+	}
+	if v, _ = SchemaVersion(db); v != 0 {
+		t.Errorf("MigrateTo 0: expected version 0, got %d", v)
+	}
+	if err = MigrateTo(db, LatestVersion()+1); err == nil {
+		t.Errorf("MigrateTo %d: expected an error", LatestVersion()+1)
+	}
+}
@@ -0,0 +1,151 @@
+package ltx2sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+)
+
+// The full text search index is an sqlite FTS5 virtual table, ltx_fts, whose
+// content is the value, nnp, and nwp columns of the ltx table.  Triggers keep it
+// in sync with ltx.  FTS5 is only available if doxa is built with the
+// sqlite_fts5 tag, which the Makefile sets, e.g. make build.  Without it, Search falls back
+// to scanning the ltx table, which gives the same results, but slowly, and a database
+// that has the index cannot be opened, since its triggers cannot update the index.
+
+// ErrNoFTS5 is returned by CreateSearchIndex if sqlite was built without FTS5
+var ErrNoFTS5 = errors.New("ltx2sql: sqlite was built without fts5, build with -tags sqlite_fts5")
+
+// ErrSearchIndexWithoutFTS5 is returned by NewLtxMapper for a database that has the full text search index,
+// if sqlite was built without FTS5
+var ErrSearchIndexWithoutFTS5 = errors.New("ltx2sql: the database has a full text search index, but this program was built without fts5; rebuild it with the sqlite_fts5 tag, e.g. go install -tags sqlite_fts5 ./cmd/doxago, or make install")
+
+// SQL to create the full text search index and the triggers that keep it in sync with ltx
+var SQLCreateSearchIndex = `CREATE VIRTUAL TABLE IF NOT EXISTS ltx_fts USING fts5(
+    id UNINDEXED,
+    value,
+    nnp,
+    nwp,
+    content='ltx',
+    tokenize='unicode61 remove_diacritics 2');
+CREATE TRIGGER IF NOT EXISTS ltx_fts_insert AFTER INSERT ON ltx BEGIN
+    INSERT INTO ltx_fts(rowid, id, value, nnp, nwp) VALUES (new.rowid, new.id, new.value, new.nnp, new.nwp);
+END;
+CREATE TRIGGER IF NOT EXISTS ltx_fts_delete AFTER DELETE ON ltx BEGIN
+    INSERT INTO ltx_fts(ltx_fts, rowid, id, value, nnp, nwp) VALUES ('delete', old.rowid, old.id, old.value, old.nnp, old.nwp);
+END;
+CREATE TRIGGER IF NOT EXISTS ltx_fts_update AFTER UPDATE ON ltx BEGIN
+    INSERT INTO ltx_fts(ltx_fts, rowid, id, value, nnp, nwp) VALUES ('delete', old.rowid, old.id, old.value, old.nnp, old.nwp);
+    INSERT INTO ltx_fts(rowid, id, value, nnp, nwp) VALUES (new.rowid, new.id, new.value, new.nnp, new.nwp);
+END;`
+
+// SQL to rebuild the full text search index from the ltx table
+var SQLRebuildSearchIndex = `INSERT INTO ltx_fts(ltx_fts) VALUES ('rebuild');`
+
+// SQL to drop the full text search index and its triggers
+var SQLDropSearchIndex = `DROP TRIGGER IF EXISTS ltx_fts_insert;
+DROP TRIGGER IF EXISTS ltx_fts_delete;
+DROP TRIGGER IF EXISTS ltx_fts_update;
+DROP TABLE IF EXISTS ltx_fts;`
+
+// CreateSearchIndex creates the full text search index if it does not exist
+// and populates it from the ltx table.  For a bulk load, it is faster to load
+// the ltx table first and call this afterwards.
+func CreateSearchIndex(db *sql.DB) error {
+	if hasSearchIndex(db) {
+		return nil
+	}
+	_, err := db.Exec(SQLCreateSearchIndex)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return ErrNoFTS5
+		}
+		return err
+	}
+	_, err = db.Exec(SQLRebuildSearchIndex)
+	return err
+}
+// DropSearchIndex removes the full text search index and its triggers
+func DropSearchIndex(db *sql.DB) error {
+	_, err := db.Exec(SQLDropSearchIndex)
+	return err
+}
+// HasFTS5 reports whether sqlite was built with FTS5
+func HasFTS5(db *sql.DB) bool {
+	var used bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used)
+	return err == nil && used
+}
+// Reports whether the database has a full text search index
+func hasSearchIndex(db *sql.DB) bool {
+	var name string
+	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'ltx_fts'`).Scan(&name)
+	return err == nil
+}
+// Search returns the records matching the full text query, best match first.
+// See ltxstore.ParseQuery for the query syntax.
+func (m *LtxMapper) Search(query string, options ltxstore.SearchOptions) ([]*models.Ltx, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	q, err := ltxstore.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if !hasSearchIndex(m.DB) {
+		return m.scan(q, options)
+	}
+	var sb strings.Builder
+	var args []interface{}
+	sb.WriteString(fmt.Sprintf(`SELECT %s FROM ltx_fts JOIN ltx ON ltx.rowid = ltx_fts.rowid WHERE ltx_fts MATCH $1`, m.qualifiedColumns()))
+	args = append(args, q.FTS5(options.Column))
+	if len(options.Like) > 0 {
+		sb.WriteString(" AND ltx.id LIKE $2")
+		args = append(args, options.Like)
+	}
+	sb.WriteString(" ORDER BY ltx_fts.rank, ltx.id")
+	if options.Limit > 0 {
+		sb.WriteString(fmt.Sprintf(" LIMIT %d", options.Limit))
+	}
+	rows, err := m.DB.Query(sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []*models.Ltx
+	for rows.Next() {
+		r := &models.Ltx{}
+		if err = rows.Scan(m.Fields(r)...); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+// scan searches without the full text index.  It reads the records for the
+// Like option, and scores each of them using the query.
+func (m *LtxMapper) scan(q *ltxstore.Query, options ltxstore.SearchOptions) ([]*models.Ltx, error) {
+	c := "1 = 1"
+	var args []interface{}
+	if len(options.Like) > 0 {
+		c = "id LIKE $1"
+		args = append(args, options.Like)
+	}
+	candidates, err := m.Query(c, true, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ltxstore.Rank(q, options, candidates), nil
+}
+// Columns prefixed with the table name, for use in joins
+func (m *LtxMapper) qualifiedColumns() string {
+	columns := strings.Split(m.Columns(), ", ")
+	for i, c := range columns {
+		columns[i] = "ltx." + c
+	}
+	return strings.Join(columns, ", ")
+}
+
@@ -0,0 +1,37 @@
+// +build !sqlite_fts5
+
+package ltx2sql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that a build without FTS5 refuses a database with the full text search index
+func TestNewLtxMapperWithoutFTS5(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ltx2sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbPath := filepath.Join(dir, "fts5.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HasFTS5(db) {
+		t.Errorf("expected sqlite without fts5")
+	}
+	// a plain table stands for the index, which cannot be created without fts5
+	_, err = db.Exec(`CREATE TABLE ltx_fts (id TEXT)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewLtxMapper(dbPath); err != ErrSearchIndexWithoutFTS5 {
+		t.Errorf("expected ErrSearchIndexWithoutFTS5, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package ltxstore
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"sort"
+	"strings"
+)
+
+// Kinds of changes made by Copy, Move, and Remove
+const (
+	ChangeCreate   = "create"   // a record is created
+	ChangeDelete   = "delete"   // a record is deleted
+	ChangeRedirect = "redirect" // the redirect of a record is changed to point to a moved record
+	ChangeDangling = "dangling" // a record will redirect to a removed record
+)
+
+// Change is a change made by Copy, Move, or Remove, or, in a dry run, that would be made.
+// The changes of an edit are applied in one transaction (see LtxStore.Apply),
+// so if the edit fails, none of them are made, and no changes are returned.
+type Change struct {
+	Kind string // one of the Change kinds
+	ID   string
+	To   string // for create, the id copied from. For redirect and dangling, the id redirected to.
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeCreate:
+		return fmt.Sprintf("create   %s from %s", c.ID, c.To)
+	case ChangeRedirect:
+		return fmt.Sprintf("redirect %s => %s", c.ID, c.To)
+	case ChangeDangling:
+		return fmt.Sprintf("dangling %s => %s", c.ID, c.To)
+	default:
+		return fmt.Sprintf("%-8s %s", c.Kind, c.ID)
+	}
+}
+
+// EditOptions control Copy, Move, and Remove
+type EditOptions struct {
+	DryRun bool // if true, the changes are returned, but not made
+	Force  bool // if true, Remove removes records even if other records redirect to them
+}
+
+// Paths are a library, library/topic, or library/topic/key.
+// pathDepth returns the number of parts of the path, or an error if it is not valid.
+func pathDepth(s LtxStore, path string) (int, error) {
+	parts := strings.Split(path, s.IDDelimiter())
+	for _, p := range parts {
+		if len(p) == 0 || strings.ContainsAny(p, "%") {
+			return 0, fmt.Errorf("ltxstore: %s is not a valid path", path)
+		}
+	}
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("ltxstore: %s has more than library/topic/key", path)
+	}
+	if len(strings.Split(parts[0], "_")) != 3 {
+		return 0, fmt.Errorf("ltxstore: library %s is not language_country_realm", parts[0])
+	}
+	return len(parts), nil
+}
+
+// under reports whether the id is the path, or is in it
+func under(s LtxStore, id, path string) bool {
+	return id == path || strings.HasPrefix(id, path+s.IDDelimiter())
+}
+
+// Under returns the records whose ids are in the path, sorted by id
+func Under(s LtxStore, path string) ([]*models.Ltx, error) {
+	depth, err := pathDepth(s, path)
+	if err != nil {
+		return nil, err
+	}
+	var records []*models.Ltx
+	switch depth {
+	case 1:
+		records, err = Records(s, path)
+	case 2:
+		parts := strings.Split(path, s.IDDelimiter())
+		var all []*models.Ltx
+		all, err = s.ReadByLT(parts[0], parts[1], true)
+		for _, r := range all {
+			if under(s, r.ID, path) {
+				records = append(records, r)
+			}
+		}
+	default:
+		var r *models.Ltx
+		if r, err = s.ReadById(path); r != nil {
+			records = append(records, r)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+// Make creates an empty record for the library/topic/key, unless it exists
+func Make(s LtxStore, id string, options EditOptions) ([]Change, error) {
+	depth, err := pathDepth(s, id)
+	if err != nil {
+		return nil, err
+	}
+	if depth != 3 {
+		return nil, fmt.Errorf("ltxstore: %s is not library/topic/key", id)
+	}
+	rec, err := s.ReadById(id)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		return nil, fmt.Errorf("ltxstore: %s already exists", id)
+	}
+	changes := []Change{{Kind: ChangeCreate, ID: id}}
+	if options.DryRun {
+		return changes, nil
+	}
+	return changes, s.Merge(newRecord(s, id, "", "", ""))
+}
+
+// Copy copies the records in the path from to the path to, which must have the same depth,
+// e.g. a library to a new library to seed a translation.  None of the records copied to may exist.
+// A copied redirect to a record in from is changed to the corresponding record in to.
+func Copy(s LtxStore, from, to string, options EditOptions) ([]Change, error) {
+	records, changes, err := copyChanges(s, from, to)
+	if err != nil || options.DryRun {
+		return changes, err
+	}
+	if err = s.Apply(copyRecords(s, records, from, to), nil); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Move moves (renames) the records in the path from to the path to, which must have the same depth,
+// e.g. a topic to another library.  None of the records moved to may exist.
+// Redirects to moved records, in any library, are changed to point to where they moved.
+func Move(s LtxStore, from, to string, options EditOptions) ([]Change, error) {
+	records, changes, err := copyChanges(s, from, to)
+	if err != nil {
+		return changes, err
+	}
+	referrers, err := referrers(s, from)
+	if err != nil {
+		return nil, err
+	}
+	merges := copyRecords(s, records, from, to)
+	for _, r := range referrers {
+		rec, err := s.ReadById(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			continue
+		}
+		rec.SetRedirect(rename(r.Redirect, from, to))
+		merges = append(merges, rec)
+		changes = append(changes, Change{Kind: ChangeRedirect, ID: r.ID, To: rec.Redirect})
+	}
+	var deletes []string
+	for _, r := range records {
+		deletes = append(deletes, r.ID)
+		changes = append(changes, Change{Kind: ChangeDelete, ID: r.ID})
+	}
+	if options.DryRun {
+		return changes, nil
+	}
+	if err = s.Apply(merges, deletes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Remove deletes the records in the path.  If records outside the path redirect
+// to them, nothing is deleted, unless options.Force is true.
+func Remove(s LtxStore, path string, options EditOptions) ([]Change, error) {
+	records, err := Under(s, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("ltxstore: %s does not exist", path)
+	}
+	referrers, err := referrers(s, path)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for _, r := range records {
+		changes = append(changes, Change{Kind: ChangeDelete, ID: r.ID})
+	}
+	for _, r := range referrers {
+		changes = append(changes, Change{Kind: ChangeDangling, ID: r.ID, To: r.Redirect})
+	}
+	if len(referrers) > 0 && !options.Force {
+		return changes, fmt.Errorf("ltxstore: %d records outside %s redirect to it, e.g. %s", len(referrers), path, referrers[0].ID)
+	}
+	if options.DryRun {
+		return changes, nil
+	}
+	var deletes []string
+	for _, r := range records {
+		deletes = append(deletes, r.ID)
+	}
+	if err = s.Apply(nil, deletes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// copyChanges returns the records to copy from the path from to the path to, and the changes
+func copyChanges(s LtxStore, from, to string) ([]*models.Ltx, []Change, error) {
+	fromDepth, err := pathDepth(s, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	toDepth, err := pathDepth(s, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fromDepth != toDepth {
+		return nil, nil, fmt.Errorf("ltxstore: %s and %s must both be a library, a library/topic, or a library/topic/key", from, to)
+	}
+	if from == to {
+		return nil, nil, fmt.Errorf("ltxstore: %s and %s are the same", from, to)
+	}
+	records, err := Under(s, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("ltxstore: %s does not exist", from)
+	}
+	existing, err := Under(s, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists := make(map[string]bool)
+	for _, r := range existing {
+		exists[r.ID] = true
+	}
+	var changes []Change
+	for _, r := range records {
+		id := rename(r.ID, from, to)
+		if exists[id] {
+			return nil, nil, fmt.Errorf("ltxstore: %s already exists", id)
+		}
+		changes = append(changes, Change{Kind: ChangeCreate, ID: id, To: r.ID})
+	}
+	return records, changes, nil
+}
+
+// copyRecords returns a copy of each record, renamed from the path from to the path to
+func copyRecords(s LtxStore, records []*models.Ltx, from, to string) []*models.Ltx {
+	var copies []*models.Ltx
+	for _, r := range records {
+		redirect := r.Redirect
+		if under(s, redirect, from) {
+			redirect = rename(redirect, from, to)
+		}
+		copies = append(copies, newRecord(s, rename(r.ID, from, to), r.Value, r.Comment, redirect))
+	}
+	return copies
+}
+
+// referrers returns the records outside the path that redirect to a record in it
+func referrers(s LtxStore, path string) ([]models.Redirect, error) {
+	all, err := s.Redirects("%")
+	if err != nil {
+		return nil, err
+	}
+	var result []models.Redirect
+	for _, r := range all {
+		if under(s, r.Redirect, path) && !under(s, r.ID, path) {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// rename changes the start of the id from the path from to the path to
+func rename(id, from, to string) string {
+	return to + strings.TrimPrefix(id, from)
+}
+
+func newRecord(s LtxStore, id, value, comment, redirect string) *models.Ltx {
+	parts := strings.Split(id, s.IDDelimiter())
+	return models.NewLtx(parts[0], parts[1], parts[2], value, comment, redirect)
+}
@@ -0,0 +1,92 @@
+package ltxstore
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+	"time"
+)
+
+// Records returns the records of the library, sorted by id.
+// If library is empty, the records of all libraries are returned.
+// It is used to export a store, e.g. by ltx2json and ltx2csv.
+func Records(s LtxStore, library string) ([]*models.Ltx, error) {
+	libraries := []string{library}
+	if len(library) == 0 {
+		var err error
+		if libraries, err = s.Libraries(); err != nil {
+			return nil, err
+		}
+	}
+	delimiter := s.IDDelimiter()
+	var result []*models.Ltx
+	for _, library := range libraries {
+		topics, err := s.Topics(library + delimiter)
+		if err != nil {
+			return nil, err
+		}
+		for _, topic := range topics {
+			records, err := s.ReadByLT(library, topic, true)
+			if err != nil {
+				return nil, err
+			}
+			// the library and topic are LIKE patterns, so _ matches any character
+			prefix := library + delimiter + topic + delimiter
+			for _, r := range records {
+				if strings.HasPrefix(r.ID, prefix) {
+					result = append(result, r)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// Normalize prepares a record read from a file to be merged into a store.
+// If the library, topic, and key are set, the id is set from them.
+// Otherwise, they are set from the id.  The nnp and nwp are set from the value,
+// and the timestamps are set if they are empty.
+func Normalize(l *models.Ltx) error {
+	if len(l.Library) > 0 || len(l.Topic) > 0 || len(l.Key) > 0 {
+		if len(l.Library) == 0 || len(l.Topic) == 0 || len(l.Key) == 0 {
+			return fmt.Errorf("ltxstore: record %s needs a library, topic, and key", l.ID)
+		}
+		l.ID = strings.Join([]string{l.Library, l.Topic, l.Key}, models.IDDelimiter)
+	}
+	parts := strings.Split(l.ID, models.IDDelimiter)
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 || len(parts[2]) == 0 {
+		return fmt.Errorf("ltxstore: id %s is not library/topic/key", l.ID)
+	}
+	if len(strings.Split(parts[0], "_")) != 3 {
+		return fmt.Errorf("ltxstore: library %s is not language_country_realm", parts[0])
+	}
+	l.Library, l.Topic, l.Key = parts[0], parts[1], parts[2]
+	redirect := l.Redirect
+	l.SetValue(l.Value)
+	l.Redirect = redirect
+	if len(l.Value) > 0 && len(l.Redirect) > 0 {
+		return fmt.Errorf("ltxstore: record %s has both a value and a redirect", l.ID)
+	}
+	now := time.Now().UTC().String()
+	if len(l.CreatedWhen) == 0 {
+		l.CreatedWhen = now
+	}
+	if len(l.ModifiedWhen) == 0 {
+		l.ModifiedWhen = now
+	}
+	return nil
+}
+
+// Import normalizes the records and merges them into the store in one transaction.
+// If any record is not valid, or fails to merge, none are merged.  It returns how many were merged.
+func Import(s LtxStore, records []*models.Ltx) (int, error) {
+	for _, r := range records {
+		if err := Normalize(r); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.Apply(records, nil); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
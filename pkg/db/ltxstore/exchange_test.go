@@ -0,0 +1,31 @@
+package ltxstore
+
+import (
+	"github.com/liturgiko/doxa/pkg/models"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	l := &models.Ltx{ID: "gr_gr_cog/actors/Priest", Value: "ΙΕΡΕΥΣ"}
+	if err := Normalize(l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Library != "gr_gr_cog" || l.Topic != "actors" || l.Key != "Priest" || l.NNP != "ιερευσ" || len(l.CreatedWhen) == 0 {
+		t.Errorf("Normalize, unexpected record: %v", l)
+	}
+	l = &models.Ltx{ID: "ignored", Library: "en_us_dedes", Topic: "actors", Key: "Deacon", Redirect: "en_us_dedes/actors/Priest"}
+	if err := Normalize(l); err != nil || l.ID != "en_us_dedes/actors/Deacon" || l.Redirect != "en_us_dedes/actors/Priest" {
+		t.Errorf("Normalize, unexpected record %v: %v", l, err)
+	}
+	bad := []*models.Ltx{
+		{ID: "gr_gr_cog/actors"},
+		{ID: "gr_cog/actors/Priest"},
+		{Library: "gr_gr_cog", Topic: "actors"},
+		{ID: "gr_gr_cog/actors/Priest", Value: "x", Redirect: "gr_gr_cog/actors/Deacon"},
+	}
+	for _, l := range bad {
+		if err := Normalize(l); err == nil {
+			t.Errorf("Normalize %v, expected an error", l)
+		}
+	}
+}
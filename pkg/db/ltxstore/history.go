@@ -0,0 +1,45 @@
+package ltxstore
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"os/user"
+)
+
+// DefaultUser returns the login name of the user running doxa,
+// which stores use for the history until SetUser is called.
+func DefaultUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return u.Username
+}
+
+// ApplyRevision implements Revert for a store, using its History and Merge methods.
+// The revision number is the one returned by History.
+func ApplyRevision(s LtxStore, id string, revision int) error {
+	revisions, err := s.History(id)
+	if err != nil {
+		return err
+	}
+	if revision < 1 || revision > len(revisions) {
+		return fmt.Errorf("ltxstore: %s has no revision %d", id, revision)
+	}
+	r := revisions[revision-1]
+	rec, err := s.ReadById(id)
+	if err != nil {
+		return err
+	}
+	if rec == nil { // the record was deleted
+		var i models.Id
+		if err = i.Parse(id); err != nil {
+			return err
+		}
+		rec = models.NewLtx(i.Domain.ToNeo(), i.Topic, i.Key, "", "", "")
+	}
+	rec.SetValue(r.Value)
+	rec.Redirect = r.Redirect
+	rec.Comment = r.Comment
+	return s.Merge(rec)
+}
@@ -0,0 +1,116 @@
+/**
+Package ltxstore defines the LtxStore interface, which is the contract
+between code that needs liturgical text records (the shell, the REST api,
+the LML parser, the generators) and the data mapper that persists them.
+Callers should depend on LtxStore rather than on a concrete mapper, so that
+the storage can be swapped without touching every caller.
+
+There are two implementations:
+  ltx2sql.LtxMapper, which stores the records in a sqlite3 database.
+  ltx2mem.LtxMapper, which keeps the records in memory and is intended
+  for tests and small projects.
+
+IDs are library/topic/key, delimited by a forward slash, e.g. gr_gr_cog/actors/Priest.
+Methods that take a like parameter accept a sql LIKE pattern, where % matches
+zero or more characters and _ matches a single character.  As in sqlite, the case
+of ASCII letters is ignored, unless CaseSensitiveLike(true) is called, but not that of others, e.g. Greek.
+
+Search takes a full text query.  See ParseQuery for the syntax.
+ */
+package ltxstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+)
+
+// ErrNotFound is returned by callers of a store when a record does not exist.
+// Note that the read methods of a store return nil, nil when nothing matches.
+var ErrNotFound = errors.New("ltxstore: record not found")
+
+// SearchOptions restricts a full text search
+type SearchOptions struct {
+	Column string // value, nnp, or nwp.  If empty, all three are searched.
+	Like   string // if not empty, only ids like this are searched, e.g. gr_gr_cog/%
+	Limit  int    // maximum number of records to return.  Zero means no limit.
+}
+
+// SearchColumns are the columns that can be searched using full text search
+var SearchColumns = []string{"value", "nnp", "nwp"}
+
+// Validate returns an error if the column is not one of the SearchColumns
+func (o SearchOptions) Validate() error {
+	if len(o.Column) == 0 {
+		return nil
+	}
+	for _, c := range SearchColumns {
+		if c == o.Column {
+			return nil
+		}
+	}
+	return fmt.Errorf("ltxstore: cannot search column %s", o.Column)
+}
+
+// LtxStore provides create, read, update, and delete operations for Ltx records.
+type LtxStore interface {
+	// IDDelimiter returns the delimiter used in IDs
+	IDDelimiter() string
+	// Merge creates the record if it does not exist, otherwise replaces it.
+	// If it replaces it, the old value, redirect, and comment are added to the history.
+	Merge(l *models.Ltx) error
+	// Delete removes the record with the specified id, and adds it to the history
+	Delete(id string) error
+	// Apply merges the records, then deletes the records with the ids, as one transaction:
+	// if any of them fails, none of the changes are made.  The history is added to as by Merge and Delete.
+	Apply(merges []*models.Ltx, deletes []string) error
+	// SetUser sets who is recorded in the history as making subsequent changes
+	SetUser(user string)
+	// History returns the revisions of the record with the specified id, oldest first
+	History(id string) ([]models.LtxRevision, error)
+	// Revert sets the value, redirect, and comment of the record to those of the revision.
+	// The record is recreated if it was deleted.  The revert itself is added to the history.
+	Revert(id string, revision int) error
+	// ReadById returns the record for the id, or nil if not found
+	ReadById(id string) (*models.Ltx, error)
+	// ReadByLTK returns the record for the library, topic, and key, or nil if not found
+	ReadByLTK(library, topic, key string) (*models.Ltx, error)
+	// ReadByLT returns the records for the library and topic
+	ReadByLT(library, topic string, returnEmpty bool) ([]*models.Ltx, error)
+	// ReadByTK returns the records in all libraries for the topic and key
+	ReadByTK(topic, key string, returnEmpty bool) ([]*models.Ltx, error)
+	// ReadByValue returns the records whose id is like id and whose value contains substring
+	ReadByValue(id, substring string) ([]*models.Ltx, error)
+	// ReadByNNP returns the records whose id is like id and whose nnp contains substring
+	ReadByNNP(id, substring string) ([]*models.Ltx, error)
+	// ReadByNWP returns the records whose id is like id and whose nwp contains substring
+	ReadByNWP(id, substring string) ([]*models.Ltx, error)
+	// Search returns the records that match the full text query, best match first
+	Search(query string, options SearchOptions) ([]*models.Ltx, error)
+	// Libraries returns the distinct libraries, sorted
+	Libraries() ([]string, error)
+	// Topics returns the distinct topics for ids like the parameter, sorted ignoring case
+	Topics(like string) ([]string, error)
+	// Keys returns the distinct keys for ids like the parameter, sorted ignoring case
+	Keys(like string) ([]string, error)
+	// Distinct returns the distinct values of the column (library, topic, or key) for ids like the parameter
+	Distinct(column, like string) ([]string, error)
+	// Redirects returns the records with ids like the parameter that have a redirect
+	Redirects(like string) ([]models.Redirect, error)
+	// ReferredTo returns the records that redirect to the specified id
+	ReferredTo(by string) ([]models.Redirect, error)
+	// Empty returns the ids like the parameter whose value and redirect are both blank
+	Empty(like string) ([]string, error)
+	// CountTopics returns the number of distinct topics in the library
+	CountTopics(library string) (int, error)
+	// CountKeys returns the number of records for the library, topic, and key. Topic and key can be empty.
+	CountKeys(library, topic, key string) (int, error)
+	// Exists reports whether a record exists for the library, topic, and key
+	Exists(library, topic, key string) bool
+	// ExistsTK reports whether a record exists in any library for the topic and key
+	ExistsTK(topic, key string) bool
+	// CaseSensitiveLike switches case sensitive matching on or off for the search methods
+	CaseSensitiveLike(on bool) error
+	// Close releases the resources held by the store
+	Close() error
+}
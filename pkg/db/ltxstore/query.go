@@ -0,0 +1,339 @@
+package ltxstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"github.com/liturgiko/doxa/pkg/utils/ltstring"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed full text search query.  The syntax is the subset of
+// the sqlite FTS5 query syntax that is supported by every store:
+//   word            matches records containing the word
+//   word*           matches records containing a word that starts with word
+//   "a phrase"      matches records containing the words in sequence
+//   "a phr"*        the last word of the phrase is a prefix
+//   a b, a AND b    matches records containing both a and b
+//   a OR b          matches records containing either a or b
+//   a NOT b         matches records containing a but not b
+//   ( ... )         groups expressions
+// NOT binds tighter than AND, which binds tighter than OR.
+// Matching ignores case and accents.
+type Query struct {
+	root  queryNode
+	terms []string
+}
+
+type queryNode interface {
+	// score returns the number of hits in tokens, or 0 if there is no match
+	score(tokens []string) int
+	fts5() string
+}
+
+type phraseNode struct {
+	tokens []string
+	prefix bool
+}
+type andNode struct {
+	left, right queryNode
+}
+type orNode struct {
+	left, right queryNode
+}
+type notNode struct {
+	left, right queryNode
+}
+
+// ParseQuery parses a full text search query
+func ParseQuery(q string) (*Query, error) {
+	p := queryParser{}
+	if err := p.lex(q); err != nil {
+		return nil, err
+	}
+	if len(p.items) == 0 {
+		return nil, errors.New("ltxstore: empty search query")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.items) {
+		return nil, fmt.Errorf("ltxstore: unexpected %s in search query", p.items[p.pos].text)
+	}
+	return &Query{root: root, terms: p.terms}, nil
+}
+// Terms returns the phrases of the query that are not negated, in the order they occur
+func (q *Query) Terms() []string {
+	return q.terms
+}
+// FTS5 returns the query in sqlite FTS5 syntax, restricted to the column if it is not empty
+func (q *Query) FTS5(column string) string {
+	if len(column) == 0 {
+		return q.root.fts5()
+	}
+	return fmt.Sprintf("%s : (%s)", column, q.root.fts5())
+}
+// Score returns the number of hits of the query in text, or 0 if text does not match
+func (q *Query) Score(text string) int {
+	return q.root.score(Tokenize(text))
+}
+// Tokenize splits text into lower case words with the accents removed
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(ltstring.ToNwp(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+func (n *phraseNode) score(tokens []string) int {
+	hits := 0
+	for i := 0; i+len(n.tokens) <= len(tokens); i++ {
+		matched := true
+		for j, t := range n.tokens {
+			if tokens[i+j] == t {
+				continue
+			}
+			if n.prefix && j == len(n.tokens)-1 && strings.HasPrefix(tokens[i+j], t) {
+				continue
+			}
+			matched = false
+			break
+		}
+		if matched {
+			hits++
+		}
+	}
+	return hits
+}
+func (n *phraseNode) fts5() string {
+	s := `"` + strings.ReplaceAll(strings.Join(n.tokens, " "), `"`, `""`) + `"`
+	if n.prefix {
+		s = s + " *"
+	}
+	return s
+}
+func (n *andNode) score(tokens []string) int {
+	l := n.left.score(tokens)
+	r := n.right.score(tokens)
+	if l == 0 || r == 0 {
+		return 0
+	}
+	return l + r
+}
+func (n *andNode) fts5() string {
+	return fmt.Sprintf("(%s AND %s)", n.left.fts5(), n.right.fts5())
+}
+func (n *orNode) score(tokens []string) int {
+	return n.left.score(tokens) + n.right.score(tokens)
+}
+func (n *orNode) fts5() string {
+	return fmt.Sprintf("(%s OR %s)", n.left.fts5(), n.right.fts5())
+}
+func (n *notNode) score(tokens []string) int {
+	if n.right.score(tokens) > 0 {
+		return 0
+	}
+	return n.left.score(tokens)
+}
+func (n *notNode) fts5() string {
+	return fmt.Sprintf("(%s NOT %s)", n.left.fts5(), n.right.fts5())
+}
+
+type queryItem struct {
+	text   string
+	quoted bool
+}
+type queryParser struct {
+	items   []queryItem
+	pos     int
+	negated int
+	terms   []string
+}
+
+// lex splits the query into parentheses, operators, quoted phrases, and words.
+// A trailing * is kept as its own item.
+func (p *queryParser) lex(q string) error {
+	r := []rune(q)
+	for i := 0; i < len(r); {
+		switch c := r[i]; {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '*':
+			p.items = append(p.items, queryItem{text: string(c)})
+			i++
+		case c == '"':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(r) {
+				if r[i] == '"' {
+					if i+1 < len(r) && r[i+1] == '"' {
+						sb.WriteRune('"')
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(r[i])
+				i++
+			}
+			if !closed {
+				return errors.New("ltxstore: unterminated phrase in search query")
+			}
+			p.items = append(p.items, queryItem{text: sb.String(), quoted: true})
+		default:
+			start := i
+			for i < len(r) && !unicode.IsSpace(r[i]) && !strings.ContainsRune(`()*"`, r[i]) {
+				i++
+			}
+			p.items = append(p.items, queryItem{text: string(r[start:i])})
+		}
+	}
+	return nil
+}
+func (p *queryParser) peek() (queryItem, bool) {
+	if p.pos < len(p.items) {
+		return p.items[p.pos], true
+	}
+	return queryItem{}, false
+}
+func (p *queryParser) isOperator(item queryItem, op string) bool {
+	return !item.quoted && item.text == op
+}
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		item, ok := p.peek()
+		if !ok || !p.isOperator(item, "OR") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+}
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		item, ok := p.peek()
+		if !ok || p.isOperator(item, ")") || p.isOperator(item, "OR") {
+			return left, nil
+		}
+		if p.isOperator(item, "AND") {
+			p.pos++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+}
+func (p *queryParser) parseNot() (queryNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		item, ok := p.peek()
+		if !ok || !p.isOperator(item, "NOT") {
+			return left, nil
+		}
+		p.pos++
+		p.negated++
+		right, err := p.parsePrimary()
+		p.negated--
+		if err != nil {
+			return nil, err
+		}
+		left = &notNode{left, right}
+	}
+}
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	item, ok := p.peek()
+	if !ok {
+		return nil, errors.New("ltxstore: search query ends unexpectedly")
+	}
+	p.pos++
+	if p.isOperator(item, "(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if item, ok = p.peek(); !ok || !p.isOperator(item, ")") {
+			return nil, errors.New("ltxstore: missing ) in search query")
+		}
+		p.pos++
+		return n, nil
+	}
+	if !item.quoted {
+		switch item.text {
+		case ")", "*", "AND", "OR", "NOT":
+			return nil, fmt.Errorf("ltxstore: unexpected %s in search query", item.text)
+		}
+	}
+	n := &phraseNode{tokens: Tokenize(item.text)}
+	if len(n.tokens) == 0 {
+		return nil, fmt.Errorf("ltxstore: %s has no words to search for", item.text)
+	}
+	if next, ok := p.peek(); ok && p.isOperator(next, "*") {
+		n.prefix = true
+		p.pos++
+	}
+	if p.negated == 0 {
+		p.terms = append(p.terms, strings.Join(n.tokens, " "))
+	}
+	return n, nil
+}
+// Rank returns the records that match the query, best match first.
+// The records are searched in the column specified by the options,
+// or all the SearchColumns if none is specified.  Records with the same
+// score are ordered by id.  The Like option is not applied.
+func Rank(q *Query, options SearchOptions, records []*models.Ltx) []*models.Ltx {
+	type scored struct {
+		ltx   *models.Ltx
+		score int
+	}
+	var matches []scored
+	for _, r := range records {
+		score := 0
+		if len(options.Column) == 0 || options.Column == "value" {
+			score += q.Score(r.Value)
+		}
+		if len(options.Column) == 0 || options.Column == "nnp" {
+			score += q.Score(r.NNP)
+		}
+		if len(options.Column) == 0 || options.Column == "nwp" {
+			score += q.Score(r.NWP)
+		}
+		if score > 0 {
+			matches = append(matches, scored{r, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].ltx.ID < matches[j].ltx.ID
+	})
+	if options.Limit > 0 && len(matches) > options.Limit {
+		matches = matches[:options.Limit]
+	}
+	var result []*models.Ltx
+	for _, m := range matches {
+		result = append(result, m.ltx)
+	}
+	return result
+}
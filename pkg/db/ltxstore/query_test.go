@@ -0,0 +1,85 @@
+package ltxstore
+
+import (
+	"github.com/liturgiko/doxa/pkg/models"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		fts5  string
+		err   bool
+	}{
+		{"mercy", `"mercy"`, false},
+		{"Lord have", `("lord" AND "have")`, false},
+		{`"Lord have mercy"`, `"lord have mercy"`, false},
+		{"merc*", `"merc" *`, false},
+		{"lord OR god NOT mercy", `("lord" OR ("god" NOT "mercy"))`, false},
+		{"(lord OR god) AND mercy", `(("lord" OR "god") AND "mercy")`, false},
+		{"Κύριε ἐλέησον", `("κυριε" AND "ελεησον")`, false},
+		{"", "", true},
+		{"(lord", "", true},
+		{`"lord`, "", true},
+		{"lord OR", "", true},
+		{"NOT lord", "", true},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseQuery(%s): expected an error", test.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %v", test.query, err)
+			continue
+		}
+		if got := q.FTS5(""); got != test.fts5 {
+			t.Errorf("ParseQuery(%s): expected %s, got %s", test.query, test.fts5, got)
+		}
+	}
+}
+func TestQuery_Score(t *testing.T) {
+	text := "Lord, have mercy. Lord, have mercy. Lord, have mercy."
+	tests := []struct {
+		query string
+		score int
+	}{
+		{"mercy", 3},
+		{`"have mercy"`, 3},
+		{`"mercy have"`, 0},
+		{"merc*", 3},
+		{"lord AND mercy", 6},
+		{"lord NOT mercy", 0},
+		{"lord NOT glory", 3},
+		{"glory OR mercy", 3},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %v", test.query, err)
+			continue
+		}
+		if got := q.Score(text); got != test.score {
+			t.Errorf("Score(%s): expected %d, got %d", test.query, test.score, got)
+		}
+	}
+}
+func TestRank(t *testing.T) {
+	records := []*models.Ltx{
+		{ID: "en_us_dedes/actors/Priest", Value: "Priest"},
+		{ID: "en_us_dedes/le.go.me/key1", Value: "Lord, have mercy."},
+		{ID: "en_us_dedes/le.go.me/key2", Value: "Lord, have mercy. Lord, have mercy. Lord, have mercy."},
+	}
+	q, _ := ParseQuery("mercy")
+	ranked := Rank(q, SearchOptions{Column: "value"}, records)
+	if len(ranked) != 2 || ranked[0].ID != "en_us_dedes/le.go.me/key2" {
+		t.Errorf("Rank: expected key2 first, got %v", ranked)
+	}
+	ranked = Rank(q, SearchOptions{Column: "value", Limit: 1}, records)
+	if len(ranked) != 1 {
+		t.Errorf("Rank: expected 1 record, got %d", len(ranked))
+	}
+}
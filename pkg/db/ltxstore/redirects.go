@@ -0,0 +1,174 @@
+package ltxstore
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/models"
+	"sort"
+	"strings"
+)
+
+// MaxRedirects is the longest chain of redirects Resolve will follow
+const MaxRedirects = 32
+
+// Kinds of redirect problems
+const (
+	RedirectDangling = "dangling" // redirects to a record that does not exist
+	RedirectCycle    = "cycle"    // following the redirects returns to a record already visited
+	RedirectSelf     = "self"     // redirects to itself
+	RedirectTooLong  = "too long" // more than MaxRedirects redirects
+)
+
+// RedirectError is returned when a chain of redirects cannot be resolved
+type RedirectError struct {
+	Kind  string   // one of the Redirect kinds
+	Chain []string // the ids followed, starting with the one being resolved
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("ltxstore: %s redirect: %s", e.Kind, strings.Join(e.Chain, " => "))
+}
+
+// Resolve follows the redirects from the record with the id, and returns the record
+// that has no redirect, and the ids followed, starting with id.
+// Returns nil, nil, nil if the record with the id does not exist.
+// If a redirect is dangling, or there is a cycle, the error is a *RedirectError.
+func Resolve(s LtxStore, id string) (*models.Ltx, []string, error) {
+	rec, err := s.ReadById(id)
+	if err != nil || rec == nil {
+		return nil, nil, err
+	}
+	chain := []string{id}
+	visited := map[string]bool{id: true}
+	for len(rec.Redirect) > 0 {
+		next := rec.Redirect
+		chain = append(chain, next)
+		switch {
+		case next == id && len(chain) == 2:
+			return nil, chain, &RedirectError{Kind: RedirectSelf, Chain: chain}
+		case visited[next]:
+			return nil, chain, &RedirectError{Kind: RedirectCycle, Chain: chain}
+		case len(chain) > MaxRedirects+1:
+			return nil, chain, &RedirectError{Kind: RedirectTooLong, Chain: chain}
+		}
+		visited[next] = true
+		if rec, err = s.ReadById(next); err != nil {
+			return nil, chain, err
+		}
+		if rec == nil {
+			return nil, chain, &RedirectError{Kind: RedirectDangling, Chain: chain}
+		}
+	}
+	return rec, chain, nil
+}
+
+// RedirectProblem is a redirect found by CheckRedirects
+type RedirectProblem struct {
+	Library string
+	ID      string
+	Chain   []string // the ids followed, starting with ID
+}
+
+// RedirectReport is the result of CheckRedirects.  Each list is sorted by id.
+type RedirectReport struct {
+	Checked  int               // the number of records with a redirect that were checked
+	Dangling []RedirectProblem // chains that end at a record that does not exist
+	Cyclic   []RedirectProblem // chains that return to a record already visited
+	Self     []RedirectProblem // records that redirect to themselves
+	Chains   []RedirectProblem // chains of more than one redirect that resolve
+}
+
+// OK reports whether there are no dangling, cyclic, or self redirects.
+// Chains are not errors, but each extra redirect costs a read.
+func (r *RedirectReport) OK() bool {
+	return len(r.Dangling) == 0 && len(r.Cyclic) == 0 && len(r.Self) == 0
+}
+
+// Libraries returns the libraries that have problems, sorted
+func (r *RedirectReport) Libraries() []string {
+	seen := make(map[string]bool)
+	var libraries []string
+	for _, list := range [][]RedirectProblem{r.Dangling, r.Cyclic, r.Self, r.Chains} {
+		for _, p := range list {
+			if !seen[p.Library] {
+				seen[p.Library] = true
+				libraries = append(libraries, p.Library)
+			}
+		}
+	}
+	sort.Strings(libraries)
+	return libraries
+}
+
+// CheckRedirects follows the redirects of the records with ids like the parameter,
+// and reports those that are dangling, cyclic, or self referencing, and chains.
+// If like is empty, all records are checked.
+func CheckRedirects(s LtxStore, like string) (*RedirectReport, error) {
+	if len(like) == 0 {
+		like = "%"
+	}
+	all, err := s.Redirects("%")
+	if err != nil {
+		return nil, err
+	}
+	redirects := make(map[string]string, len(all))
+	for _, r := range all {
+		redirects[r.ID] = r.Redirect
+	}
+	sources, err := s.Redirects(like)
+	if err != nil {
+		return nil, err
+	}
+	// a target that does not redirect either exists or is dangling
+	exists := make(map[string]bool)
+	targetExists := func(id string) (bool, error) {
+		if found, ok := exists[id]; ok {
+			return found, nil
+		}
+		rec, err := s.ReadById(id)
+		if err != nil {
+			return false, err
+		}
+		exists[id] = rec != nil
+		return rec != nil, nil
+	}
+	report := &RedirectReport{}
+	delimiter := s.IDDelimiter()
+	for _, source := range sources {
+		report.Checked++
+		problem := RedirectProblem{ID: source.ID, Chain: []string{source.ID}}
+		problem.Library = strings.Split(source.ID, delimiter)[0]
+		visited := map[string]bool{source.ID: true}
+		id := source.ID
+		for {
+			next := redirects[id]
+			problem.Chain = append(problem.Chain, next)
+			if next == source.ID && len(problem.Chain) == 2 {
+				report.Self = append(report.Self, problem)
+				break
+			}
+			if visited[next] || len(problem.Chain) > MaxRedirects+1 {
+				report.Cyclic = append(report.Cyclic, problem)
+				break
+			}
+			visited[next] = true
+			if _, ok := redirects[next]; ok {
+				id = next
+				continue
+			}
+			found, err := targetExists(next)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				report.Dangling = append(report.Dangling, problem)
+			} else if len(problem.Chain) > 2 {
+				report.Chains = append(report.Chains, problem)
+			}
+			break
+		}
+	}
+	for _, list := range [][]RedirectProblem{report.Dangling, report.Cyclic, report.Self, report.Chains} {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	return report, nil
+}
@@ -5,10 +5,12 @@
 // Package modes provides an enum of calendar types for liturgical services
 package calendarTypes
 
+// CalendarType is the calendar of the fixed cycle (Menaion).
+// Pascha and the movable cycle always follow the Julian paschalion.
 type CalendarType int
 const (
-	Gregorian CalendarType = iota
-	Julian
+	Gregorian CalendarType = iota // the Revised Julian (New) calendar: the Menaion date is the civil date
+	Julian                        // the Old calendar: the Menaion date is the Julian date, 13 days behind the civil date
 )
 
 
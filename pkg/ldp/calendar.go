@@ -0,0 +1,81 @@
+package ldp
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"strings"
+	"time"
+)
+
+// The civil date of an LDP (TheDay) is always a Gregorian date.
+// Pascha and the movable cycle are always computed using the Julian paschalion.
+// The fixed cycle (Menaion, Synaxarion, and the fixed feasts) follows the calendar type.
+// For the Revised Julian (New) calendar, calendarTypes.Gregorian, the Menaion date is the civil date.
+// For the Old calendar, calendarTypes.Julian, the Menaion date is the Julian date,
+// which is 13 days behind the civil date from 1 March 1900 through 28 February 2100.
+
+// unixEpochJDN is the Julian Day Number of 1 January 1970
+const unixEpochJDN = 2440588
+
+// jdn returns the Julian Day Number of the civil date
+func jdn(t time.Time) int {
+	return int(NewDate(t.Year(), int(t.Month()), t.Day()).Unix()/86400) + unixEpochJDN
+}
+
+// JulianDate returns the year, month, and day on the Julian calendar of the civil date
+func JulianDate(t time.Time) (year, month, day int) {
+	c := jdn(t) + 32082
+	d := (4*c + 3) / 1461
+	e := c - 1461*d/4
+	m := (5*e + 2) / 153
+	day = e - (153*m+2)/5 + 1
+	month = m + 3 - 12*(m/10)
+	year = d - 4800 + m/10
+	return year, month, day
+}
+
+// JulianToCivil returns the civil date of the year, month, and day on the Julian calendar
+func JulianToCivil(year, month, day int) time.Time {
+	a := (14 - month) / 12
+	y := year + 4800 - a
+	m := month + 12*a - 3
+	n := day + (153*m+2)/5 + 365*y + y/4 - 32083
+	return time.Unix(int64(n-unixEpochJDN)*86400, 0).UTC()
+}
+
+// JulianOffset returns the number of days the Julian calendar is behind the civil calendar on the civil date,
+// e.g. 13 for dates from 1 March 1900 through 28 February 2100.
+func JulianOffset(t time.Time) int {
+	year, month, _ := JulianDate(t)
+	if month < 3 {
+		year--
+	}
+	return year/100 - year/400 - 2
+}
+
+// MenaionDate returns the year, month, and day of the fixed cycle for the civil date
+func MenaionDate(t time.Time, calendarType calendarTypes.CalendarType) (year, month, day int) {
+	if calendarType == calendarTypes.Julian {
+		return JulianDate(t)
+	}
+	return t.Year(), int(t.Month()), t.Day()
+}
+
+// CivilDate returns the civil date on which the year, month, and day of the fixed cycle fall
+func CivilDate(year, month, day int, calendarType calendarTypes.CalendarType) time.Time {
+	if calendarType == calendarTypes.Julian {
+		return JulianToCivil(year, month, day)
+	}
+	return NewDate(year, month, day)
+}
+
+// ParseCalendarType returns the calendar type named by s, e.g. gregorian, julian, new or old
+func ParseCalendarType(s string) (calendarTypes.CalendarType, error) {
+	switch strings.ToLower(s) {
+	case "gregorian", "revised julian", "new":
+		return calendarTypes.Gregorian, nil
+	case "julian", "old":
+		return calendarTypes.Julian, nil
+	}
+	return calendarTypes.Gregorian, fmt.Errorf("invalid calendar type '%s'. Expected one of %v", s, calendarTypes.CalendarTypeValues())
+}
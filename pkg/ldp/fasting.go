@@ -0,0 +1,142 @@
+package ldp
+
+import "time"
+
+// Fasting levels, from the least to the most strict
+const (
+	FastingLevelFastFree   = "fast-free"    // no fasting, even on Wednesday and Friday
+	FastingLevelNone       = "none"         // no fasting
+	FastingLevelDairy      = "dairy"        // no meat
+	FastingLevelFish       = "fish"         // fish, wine, and oil, but no meat or dairy
+	FastingLevelWineAndOil = "wine and oil" // wine and oil, but no fish, meat, or dairy
+	FastingLevelStrict     = "strict"       // no wine, oil, fish, meat, or dairy
+)
+
+// feasts of the fixed cycle on which fish is allowed during a fast, or on a Wednesday or Friday, by month and day
+var fishFeasts = map[int]map[int]bool{
+	2:  {2: true},            // Meeting of the Lord
+	3:  {25: true},           // Annunciation
+	6:  {24: true, 29: true}, // Nativity of the Forerunner, Apostles Peter and Paul
+	8:  {6: true, 15: true},  // Transfiguration, Dormition
+	9:  {8: true},            // Nativity of the Theotokos
+	11: {21: true},           // Entrance of the Theotokos
+}
+
+// strict fast days of the fixed cycle, by month and day
+var strictDays = map[int]map[int]bool{
+	1: {5: true},  // Eve of Theophany
+	8: {29: true}, // Beheading of the Forerunner
+	9: {14: true}, // Elevation of the Cross
+}
+
+// Fasting periods.  The fasts of the fixed cycle follow the calendar type.
+const (
+	FastingPeriodNone      = ""
+	FastingPeriodGreatLent = "Great Lent"     // Clean Monday through the Friday before Lazarus Saturday
+	FastingPeriodHolyWeek  = "Holy Week"      // Lazarus Saturday through Holy Saturday
+	FastingPeriodApostles  = "Apostles' Fast" // the Monday after All Saints through June 28
+	FastingPeriodDormition = "Dormition Fast" // August 1 through August 14
+	FastingPeriodNativity  = "Nativity Fast"  // November 15 through December 24
+)
+
+// FastingPeriod returns the fasting period of the liturgical day, or FastingPeriodNone
+func (ldp *LDP) FastingPeriod() string {
+	lazarusSaturday := ldp.PalmSundayDate.AddDate(0, 0, -1)
+	switch {
+	case onOrBetween(ldp.TheDay, ldp.GreatLentStartDate, lazarusSaturday.AddDate(0, 0, -1)):
+		return FastingPeriodGreatLent
+	case onOrBetween(ldp.TheDay, lazarusSaturday, ldp.PaschaDateThisYear.AddDate(0, 0, -1)):
+		return FastingPeriodHolyWeek
+	case onOrBetween(ldp.TheDay, ldp.AllSaintsDateThisYear.AddDate(0, 0, 1), CivilDate(ldp.MenaionYear, 6, 28, ldp.CalendarType)):
+		return FastingPeriodApostles
+	case ldp.MenaionMonth == 8 && ldp.MenaionDay <= 14:
+		return FastingPeriodDormition
+	case ldp.MenaionMonth == 11 && ldp.MenaionDay >= 15, ldp.MenaionMonth == 12 && ldp.MenaionDay <= 24:
+		return FastingPeriodNativity
+	}
+	return FastingPeriodNone
+}
+
+// onOrBetween reports whether the date is on or between first and last
+func onOrBetween(date, first, last time.Time) bool {
+	return !date.Before(first) && !date.After(last)
+}
+
+// FastingLevel returns the fasting level of the liturgical day, one of the FastingLevel constants.
+// The movable cycle is computed from Pascha, and the fixed cycle from the Menaion date,
+// so the level is correct for both calendar types.
+func (ldp *LDP) FastingLevel() string {
+	d := int(ldp.TheDay.Sub(ldp.PaschaDateThisYear).Hours() / 24) // days since Pascha
+	weekend := ldp.IsSaturday || ldp.IsSunday
+	fishFeast := fishFeasts[ldp.MenaionMonth][ldp.MenaionDay]
+	// the movable cycle
+	switch {
+	case d >= -69 && d <= -64: // the week after the Publican and Pharisee
+		return FastingLevelFastFree
+	case d >= -55 && d <= -49: // Cheesefare week
+		return FastingLevelDairy
+	case d == -8 || d == -7: // Lazarus Saturday, Palm Sunday
+		return FastingLevelFish
+	case d == -3 || d == -1: // Holy Thursday, Holy Saturday
+		return FastingLevelWineAndOil
+	case d >= -6 && d <= -1: // Holy Week
+		return FastingLevelStrict
+	case d >= -48 && d <= -9: // Great Lent
+		if fishFeast {
+			return FastingLevelFish
+		}
+		if weekend {
+			return FastingLevelWineAndOil
+		}
+		return FastingLevelStrict
+	case d >= 0 && d <= 6: // Bright Week
+		return FastingLevelFastFree
+	case d >= 50 && d <= 55: // the week after Pentecost
+		return FastingLevelFastFree
+	case d == 24: // Mid-Pentecost
+		if ldp.IsWednesday {
+			return FastingLevelFish
+		}
+	}
+	// the fixed cycle
+	switch {
+	case ldp.MenaionMonth == 12 && ldp.MenaionDay >= 25, ldp.MenaionMonth == 1 && ldp.MenaionDay <= 4, ldp.MenaionMonth == 1 && ldp.MenaionDay == 6:
+		return FastingLevelFastFree
+	case strictDays[ldp.MenaionMonth][ldp.MenaionDay]:
+		if weekend {
+			return FastingLevelWineAndOil
+		}
+		return FastingLevelStrict
+	}
+	switch ldp.FastingPeriod() {
+	case FastingPeriodApostles, FastingPeriodNativity:
+		if ldp.MenaionMonth == 12 && ldp.MenaionDay >= 20 { // the forefeast of the Nativity
+			if weekend {
+				return FastingLevelWineAndOil
+			}
+			return FastingLevelStrict
+		}
+		switch {
+		case fishFeast, ldp.IsTuesday, ldp.IsThursday, weekend:
+			return FastingLevelFish
+		case ldp.IsMonday:
+			return FastingLevelWineAndOil
+		}
+		return FastingLevelStrict
+	case FastingPeriodDormition:
+		switch {
+		case fishFeast:
+			return FastingLevelFish
+		case weekend:
+			return FastingLevelWineAndOil
+		}
+		return FastingLevelStrict
+	}
+	if ldp.IsWednesday || ldp.IsFriday {
+		if fishFeast {
+			return FastingLevelFish
+		}
+		return FastingLevelStrict
+	}
+	return FastingLevelNone
+}
@@ -0,0 +1,134 @@
+package ldp
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InspectTopics are the books whose topics are resolved by Inspect
+var InspectTopics = []string{"oc", "me", "tr", "pe", "le.ep.mc", "le.ep.me", "le.go.eo", "le.go.lu", "le.go.mc", "le.go.me", "le.pr.me", "le.pr.tr"}
+
+// Inspection holds the liturgical day properties of a date, and the topics they resolve to.
+// It lets template authors see what a date produces without writing Go.
+type Inspection struct {
+	Date          string                     `json:"date"` // the civil date, yyyy-mm-dd
+	Calendar      calendarTypes.CalendarType `json:"calendar"`
+	Overrides     Overrides                  `json:"overrides"`
+	FastingPeriod string                     `json:"fastingPeriod,omitempty"`
+	FastingLevel  string                     `json:"fastingLevel"`
+	LukanWeek     int                        `json:"lukanWeek"`
+	Periods       []Period                   `json:"periods"`
+	Properties    LDP                        `json:"properties"` // with the overrides applied
+	Topics        map[string]string          `json:"topics"`     // InspectTopics resolved for the date, by book
+	Rids          []InspectedRid             `json:"rids,omitempty"`
+}
+
+// InspectedRid is a rid, and the topic/key it resolves to
+type InspectedRid struct {
+	Rid   string `json:"rid"`
+	Mode  int    `json:"mode,omitempty"` // the @Mode of the rid
+	Day   int    `json:"day,omitempty"`  // the @Day of the rid
+	ID    string `json:"id,omitempty"`   // the resolved topic/key
+	Error string `json:"error,omitempty"`
+}
+
+// Inspect computes the liturgical day properties of the date, applies the overrides,
+// and resolves InspectTopics and each of the rids.
+// A rid is written as in a template, but without quotes,
+// e.g. oc.*/ocVE.ApolTheotokionVM @Mode 3 @Day 2.
+// A rid that cannot be resolved has an Error, but does not cause Inspect to fail.
+func Inspect(date time.Time, calendarType calendarTypes.CalendarType, o Overrides, rids []string) (*Inspection, error) {
+	if o.Mode < 0 || o.Mode > 8 {
+		return nil, fmt.Errorf("expected a value between 1 and 8 for mode override, but got %d", o.Mode)
+	}
+	if o.Day < 0 || o.Day > 7 {
+		return nil, fmt.Errorf("expected a value between 1 and 7 for day override, but got %d", o.Day)
+	}
+	if o.MovableCycleDay < 0 {
+		return nil, fmt.Errorf("expected a movable cycle day > 0, but got %d", o.MovableCycleDay)
+	}
+	computed, err := Compute(date, calendarType)
+	if err != nil {
+		return nil, err
+	}
+	l := computed.WithOverrides(o)
+	inspection := &Inspection{
+		Date:          l.TheDay.Format("2006-01-02"),
+		Calendar:      calendarType,
+		Overrides:     o,
+		FastingPeriod: l.FastingPeriod(),
+		FastingLevel:  l.FastingLevel(),
+		LukanWeek:     l.getWeekOfLukanCycle(),
+		Periods:       l.Periods(),
+		Properties:    l,
+		Topics:        make(map[string]string),
+	}
+	for _, book := range InspectTopics {
+		inspection.Topics[book] = l.RelativeTopic(book+".*", 0, 0)
+	}
+	for _, rid := range rids {
+		inspection.Rids = append(inspection.Rids, l.inspectRid(rid))
+	}
+	return inspection, nil
+}
+
+// inspectRid resolves the rid, which may be followed by @Mode N and @Day N
+func (ldp *LDP) inspectRid(rid string) InspectedRid {
+	r := InspectedRid{Rid: rid}
+	fields := strings.Fields(rid)
+	if len(fields) == 0 {
+		r.Error = "empty rid"
+		return r
+	}
+	for i := 1; i < len(fields); i += 2 {
+		if i+1 >= len(fields) {
+			r.Error = fmt.Sprintf("missing value after %s", fields[i])
+			return r
+		}
+		n, err := strconv.Atoi(fields[i+1])
+		if err != nil {
+			r.Error = fmt.Sprintf("%s %s is not a number", fields[i], fields[i+1])
+			return r
+		}
+		switch fields[i] {
+		case "@Mode":
+			if n < 1 || n > 8 {
+				r.Error = fmt.Sprintf("expected a value between 1 and 8 for mode override, but got %d", n)
+				return r
+			}
+			r.Mode = n
+		case "@Day":
+			if n < 1 || n > 7 {
+				r.Error = fmt.Sprintf("expected a value between 1 and 7 for day override, but got %d", n)
+				return r
+			}
+			r.Day = n
+		default:
+			r.Error = fmt.Sprintf("expected @Day or @Mode, but got %s", fields[i])
+			return r
+		}
+	}
+	parts := strings.Split(fields[0], "/")
+	if len(parts) != 2 {
+		r.Error = fmt.Sprintf("expected one forward slash in topic/key path, but got '%s'", fields[0])
+		return r
+	}
+	if (r.Mode > 0 || r.Day > 0) && !strings.HasPrefix(parts[0], "oc") {
+		r.Error = "rid directives (@Mode or @Day) may only be used for topics starting with 'oc' (i.e. Octoechos)"
+		return r
+	}
+	if err := CheckTopic(parts[0]); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	topic := ldp.RelativeTopic(parts[0], r.Mode, r.Day)
+	if strings.HasSuffix(topic, ".") {
+		r.Error = fmt.Sprintf("topic %s is not relative to the liturgical day", parts[0])
+		return r
+	}
+	r.ID = topic + "/" + parts[1]
+	return r
+}
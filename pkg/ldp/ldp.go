@@ -14,7 +14,6 @@ import (
 	"strings"
 	"time"
 )
-var logger log.Logger
 
 // Triodion: 1st day: Sunday of Publican and Pharisee.  9 weeks before Pascha.
 // 1st three Sundays precede Great Lent.
@@ -31,6 +30,7 @@ var logger log.Logger
 type LDP struct {
 	TheDay                                   time.Time
 	CalendarType 							 calendarTypes.CalendarType
+	MenaionYear, MenaionMonth, MenaionDay    int // the date of the fixed cycle, which is the Julian date for the Old calendar
 	AllSaintsDateLastYear                    time.Time
 	AllSaintsDateThisYear                    time.Time
 	DayOfSeason                              int    // return 1..70 (0 if no day set). Valid only when isPentecostarion or isTriodion.
@@ -64,10 +64,6 @@ type LDP struct {
 	NbrModeOfWeek                            string
 	NbrMonth                                 string
 	NumberOfSundaysBeforeStartOfTriodion     int
-	originalYear                             int
-	originalMonth                            int
-	originalDay                              int
-	originalDayOfSeason                      int
 	PalmSundayDate                           time.Time
 	PalmSundayNextDate                       time.Time
 	PaschaDateLast                           time.Time
@@ -114,27 +110,37 @@ func validateYMD(year, month, day int) error {
 	return nil
 }
 
-// Creates a new LDP initialized to the specified date
-func NewLDPYMD(year, month, day int, calendarType calendarTypes.CalendarType) (LDP, error) {
+// Compute returns the liturgical day properties of the date, using the calendar type for the fixed cycle.
+// Only the year, month, and day of the date are used.
+// Compute does not change any shared state, so it is safe to call it from concurrent goroutines.
+// An LDP is a value: to override properties, e.g. the mode of the week, use WithOverrides,
+// which returns a copy.
+func Compute(date time.Time, calendarType calendarTypes.CalendarType) (LDP, error) {
 	var ldp LDP
-	if err := validateYMD(year, month, day); err != nil {
+	if err := validateYMD(date.Year(), int(date.Month()), date.Day()); err != nil {
 		return ldp, err
 	}
-	ldp.TheDay = NewDate(year, month, day)
+	ldp.TheDay = NewDate(date.Year(), int(date.Month()), date.Day())
 	ldp.CalendarType = calendarType
-	ldp.reinitializeOriginalDateTrackers()
-	ldp.SetLiturgicalPropertiesByDate(ldp.TheDay.Year())
-	ldp.SetYesterday()
+	ldp.TheDayBefore = ldp.TheDay.AddDate(0, 0, -1)
+	ldp.setLiturgicalPropertiesByDate(ldp.TheDay.Year())
 	return ldp, nil
 }
 
+// Creates a new LDP initialized to the specified date
+func NewLDPYMD(year, month, day int, calendarType calendarTypes.CalendarType) (LDP, error) {
+	if err := validateYMD(year, month, day); err != nil {
+		return LDP{}, err
+	}
+	return Compute(NewDate(year, month, day), calendarType)
+}
+
 // Returns a new LDP initialized to the specified month and day.  The year is set to the current one.
 func NewLDPMD(month, day int, calendarType calendarTypes.CalendarType) (LDP, error) {
-	var ldp LDP
 	today := time.Now()
 	year := today.Year()
 	if err := validateYMD(year, month, day); err != nil {
-		return ldp, err
+		return LDP{}, err
 	}
 
 	t := NewDate(year, month, day)
@@ -142,12 +148,7 @@ func NewLDPMD(month, day int, calendarType calendarTypes.CalendarType) (LDP, err
 	if t.Before(today) {
 		t = NewDate(year+1, month, day)
 	}
-	ldp.TheDay = t
-	ldp.CalendarType = calendarType
-	ldp.reinitializeOriginalDateTrackers()
-	ldp.SetLiturgicalPropertiesByDate(t.Year())
-	ldp.SetYesterday()
-	return ldp, nil
+	return Compute(t, calendarType)
 }
 
 // Returns a new LDP initialized for today's date and calendarType Gregorian
@@ -269,52 +270,12 @@ var GreekMap = map[string]string{
 	"31":          "λαʹ",
 }
 
-func (ldp *LDP) reinitializeOriginalDateTrackers() {
-	ldp.originalYear = -1
-	ldp.originalMonth = -1
-	ldp.originalDay = -1
-	ldp.originalDayOfSeason = -1
-}
-func (ldp LDP) setDateTo(year, month, day int) {
-	ldp.TheDay = NewDate(year, month, day)
-	//  setLiturgicalPropertiesByDate(theYear)
-	ldp.setYesterday()
-
-	// if not already set, save the date values
-	if ldp.originalYear == -1 {
-		ldp.originalYear = year
-	}
-	if ldp.originalMonth == -1 {
-		ldp.originalMonth = month
-	}
-	if ldp.originalDay == -1 {
-		ldp.originalDay = day
-	}
-	if ldp.originalDayOfSeason == -1 {
-		ldp.originalDayOfSeason = ldp.DayOfSeason
-	}
-}
-func (ldp *LDP) ResetDate() {
-	if ldp.originalMonth == -1 && ldp.originalDay == -1 {
-		ldp.originalYear = int(ldp.TheDay.Year())
-		ldp.originalMonth = int(ldp.TheDay.Month())
-		ldp.originalDay = int(ldp.TheDay.Day())
-		ldp.originalDayOfSeason = ldp.DayOfSeason
-	} else {
-		ldp.TheDay = NewDate(ldp.originalYear, ldp.originalMonth, ldp.originalDay)
-		ldp.SetLiturgicalPropertiesByDate(ldp.originalYear)
-		ldp.SetYesterday()
-	}
-}
-func (ldp *LDP) setYesterday() {
-	ldp.TheDayBefore = ldp.TheDay.AddDate(0, 0, -1)
-}
 func (ldp *LDP) TimeDelta(dateFrom time.Time, days int) time.Time {
 	return dateFrom.AddDate(0, 0, days)
 }
 
-func (ldp *LDP) SetLiturgicalPropertiesByDate(year int) {
-	ldp.SetVariablesToDefaults()
+func (ldp *LDP) setLiturgicalPropertiesByDate(year int) {
+	ldp.setVariablesToDefaults()
 	ldp.PaschaDateLastYear = ComputeDayOfPascha(year-1, ldp.CalendarType)
 	ldp.PaschaDateThisYear = ComputeDayOfPascha(year, ldp.CalendarType)
 	ldp.PaschaDateLast = ldp.lastPaschaDate()
@@ -345,35 +306,40 @@ func (ldp *LDP) SetLiturgicalPropertiesByDate(year int) {
 	}
 
 	// Clean Monday, 7 weeks + a day before Pascha
-	ldp.GreatLentStartDate = ldp.PaschaDateThisYear.AddDate(0, -(7*7)+1, 0)
+	ldp.GreatLentStartDate = ldp.PaschaDateThisYear.AddDate(0, 0, -(7*7)+1)
 	ldp.PalmSundayNextDate = ldp.PaschaDateNext.AddDate(0, 0, -7)
 	ldp.ThomasSundayDate = ldp.PaschaDateLast.AddDate(0, 0, 7) // NewDate(ldp.PaschaDateLast.Year(), 0,7 )
 	ldp.LazarusSaturdayNextDate = ldp.PaschaDateNext.AddDate(0, 0, -8)
 
-	ldp.SetDayOfSeason()
+	ldp.setDayOfSeason()
 	ldp.setDaysSinceStartOfLastTriodion()
-	ldp.SetDayOfWeek()
+	ldp.setDayOfWeek()
 	ldp.setEothinonNumber()
 	ldp.setModeOfWeek()
-	ldp.setNbrDayOfMonth(ldp.TheDay.Day())
-	ldp.setNbrMonth(int(ldp.TheDay.Month()))
+	ldp.MenaionYear, ldp.MenaionMonth, ldp.MenaionDay = MenaionDate(ldp.TheDay, ldp.CalendarType)
+	ldp.setNbrDayOfMonth(ldp.MenaionDay)
+	ldp.setNbrMonth(ldp.MenaionMonth)
 
 	ldp.setDateFirstSundayAfterElevationOfCross()
 	ldp.setDaysSinceSundayAfterLastElevationOfCross()
-	ldp.ElevationOfCrossDateThisYear = NewDate(year, 9, 14)
+	ldp.ElevationOfCrossDateThisYear = ldp.elevationOfCross(year)
 	ldp.setDateFirstSundayAfterElevationOfCross()
-	err := ldp.SetDateStartLukanCycle()
+	err := ldp.setDateStartLukanCycle()
 	if err != nil {
-		logger.Println(err)
+		log.Println(err)
 	}
 	ldp.setDaysSinceStartLukanCycleLast()
-	ldp.setElevationOfCross(NewDate(ldp.SundayAfterElevationOfCrossDateLast.Year(), 9, 14))
-	ldp.SetNumberOfSundaysBeforeStartOfTriodionOnJan15()
+	ldp.setElevationOfCross(ldp.elevationOfCross(ldp.SundayAfterElevationOfCrossDateLast.Year()))
+	ldp.setNumberOfSundaysBeforeStartOfTriodionOnJan15()
+}
+// elevationOfCross returns the civil date of the Elevation of the Cross, September 14 of the fixed cycle, in the year
+func (ldp *LDP) elevationOfCross(year int) time.Time {
+	return CivilDate(year, 9, 14, ldp.CalendarType)
 }
 func (ldp *LDP) setElevationOfCross(date time.Time) {
 	ldp.ElevationOfCrossDateLast = date
 }
-func (ldp *LDP) SetNumberOfSundaysBeforeStartOfTriodionOnJan15() {
+func (ldp *LDP) setNumberOfSundaysBeforeStartOfTriodionOnJan15() {
 	jan15 := NewDate(ldp.TriodionStartDateThisYear.Year(), 0, 15)
 	diffMillis := DiffMillis(ldp.TriodionStartDateThisYear, jan15)
 	// Get difference in days, add 1 to be 1-index based instead of zero.
@@ -381,7 +347,7 @@ func (ldp *LDP) SetNumberOfSundaysBeforeStartOfTriodionOnJan15() {
 	ldp.NumberOfSundaysBeforeStartOfTriodion = ldp.DaysUntilStartOfTriodion / 7
 }
 
-func (ldp *LDP) SetNumberOfSundaysBeforeStartOfTriodion() {
+func (ldp *LDP) setNumberOfSundaysBeforeStartOfTriodion() {
 	diffMillis := DiffMillis(ldp.TriodionStartDateThisYear, ldp.TheDay)
 	ldp.DaysUntilStartOfTriodion = int(diffMillis / (24 * 60 * 60 * 1000))
 	if ldp.DaysUntilStartOfTriodion < 0 {
@@ -409,8 +375,8 @@ func (ldp *LDP) setDateLastTriodionStart() {
 }
 
 func (ldp *LDP) setDateFirstSundayAfterElevationOfCross() error {
-	firstSundayAfterElevationThisYear, err := computeSundayAfterElevationOfCross(NewDate(ldp.TheDay.Year(),9,14))
-	firstSundayAfterElevationLastYear, err := computeSundayAfterElevationOfCross(NewDate(ldp.TheDay.Year()-1,9,14))
+	firstSundayAfterElevationThisYear, err := computeSundayAfterElevationOfCross(ldp.elevationOfCross(ldp.TheDay.Year()))
+	firstSundayAfterElevationLastYear, err := computeSundayAfterElevationOfCross(ldp.elevationOfCross(ldp.TheDay.Year()-1))
 	if ldp.TheDay.Before(firstSundayAfterElevationThisYear) {
 		ldp.SundayAfterElevationOfCrossDateLast = firstSundayAfterElevationLastYear
 	} else {
@@ -458,17 +424,17 @@ func computeSundayAfterElevationOfCross(date time.Time) (time.Time, error) {
 	case time.Saturday:
 		dayOffset = 1
 	}
-	sunday := NewDate(date.Year(), 9, 14+dayOffset)
+	sunday := date.AddDate(0, 0, dayOffset)
 	var err error
 	if sunday.Weekday() != time.Sunday {
-		err = errors.New(fmt.Sprintf("expect weekday for %d/%d/%d to be Sunday, got %s ", date.Year(), 9, 14+dayOffset, sunday.Weekday()))
+		err = errors.New(fmt.Sprintf("expect weekday for %d/%d/%d to be Sunday, got %s ", sunday.Year(), sunday.Month(), sunday.Day(), sunday.Weekday()))
 	}
 	return sunday, err
 }
 
-func (ldp *LDP) SetDateStartLukanCycle() error {
-	firstSundayAfterElevationThisYear, err := computeSundayAfterElevationOfCross(NewDate(ldp.TheDay.Year(), 9, 14))
-	firstSundayAfterElevationLastYear, err := computeSundayAfterElevationOfCross(NewDate(ldp.TheDay.Year()-1, 9, 14))
+func (ldp *LDP) setDateStartLukanCycle() error {
+	firstSundayAfterElevationThisYear, err := computeSundayAfterElevationOfCross(ldp.elevationOfCross(ldp.TheDay.Year()))
+	firstSundayAfterElevationLastYear, err := computeSundayAfterElevationOfCross(ldp.elevationOfCross(ldp.TheDay.Year()-1))
 	startLukanCycleThisYear := firstSundayAfterElevationThisYear.AddDate(0, 0, 1)
 	startLukanCycleLastYear := firstSundayAfterElevationLastYear.AddDate(0, 0, 1)
 	if ldp.TheDay.Before(startLukanCycleThisYear) {
@@ -479,7 +445,9 @@ func (ldp *LDP) SetDateStartLukanCycle() error {
 	return err
 }
 
-// pass in the year and receive the month and day of Pascha.
+// pass in the year and receive the civil date of Pascha.
+// Pascha is always computed using the Julian paschalion, so the date is the same for both calendar types.
+// Use JulianDate to get the date of Pascha on the Julian calendar.
 func ComputeDayOfPascha(year int, calendarType calendarTypes.CalendarType) time.Time {
 	var month, day, r19, r7, r4, n1, n2, n3, cent int
 	r19 = year % 19
@@ -489,11 +457,9 @@ func ComputeDayOfPascha(year int, calendarType calendarTypes.CalendarType) time.
 	n1 = (19*r19 + 16) % 30
 	n2 = (2*r4 + 4*r7 + 6*n1) % 7
 	n3 = n1 + n2
-	if calendarType == calendarTypes.Gregorian {
-		// Then adjust day onto the Gregorian Calendar (only valid from 1583 onwards)
-		cent = year / 100
-		n3 += cent - cent/4 - 2
-	}
+	// Then adjust day onto the Gregorian (civil) Calendar (only valid from 1583 onwards)
+	cent = year / 100
+	n3 += cent - cent/4 - 2
 	if n3 > 40 {
 		month = 5
 		day = n3 - 40
@@ -515,13 +481,32 @@ func (ldp *LDP) GetModeOfWeek() int {
 	}
 }
 
-func (ldp *LDP) SetYesterday() {
-	ldp.TheDayBefore = ldp.TheDay
-	ldp.TheDayBefore.AddDate(0, 0, -1)
+// Overrides are values used instead of the ones computed for the date.
+// A zero value means no override.
+type Overrides struct {
+	Mode            int `json:"mode,omitempty"`            // 1..8, the mode of the week used for Octoechos topics
+	Day             int `json:"day,omitempty"`             // 1..7, the day of the week used for Octoechos topics, Sunday is 1
+	MovableCycleDay int `json:"movableCycleDay,omitempty"` // the day of the movable cycle, i.e. the day since the start of the Triodion
+}
+
+// WithOverrides returns a copy of the LDP with the overrides applied.
+// The LDP itself is not changed, so the same LDP can be shared by goroutines
+// that each use different overrides.  To clear the overrides, use the LDP
+// returned by Compute.
+func (ldp LDP) WithOverrides(o Overrides) LDP {
+	if o.Mode > 0 {
+		ldp.setModeOfTheWeekOverride(strconv.Itoa(o.Mode))
+	}
+	if o.Day > 0 {
+		ldp.setNbrDayOfWeekOverride(strconv.Itoa(o.Day))
+	}
+	if o.MovableCycleDay > 0 {
+		ldp.DayOfSeason = o.MovableCycleDay
+		ldp.DaysSinceStartOfTriodion = o.MovableCycleDay
+	}
+	return ldp
 }
 
-// Sometimes it is necessary to temporarily override the mode of the week
-// It is important to clear the override after using it
 func (ldp *LDP) setModeOfTheWeekOverride(mode string) {
 	m, err := strconv.Atoi(mode)
 	if err != nil {
@@ -543,7 +528,7 @@ func (ldp *LDP) setModeOfWeek() {
 	ldp.ModeOfWeek = (int)((diffMillis/(7*24*60*60*1000))%8 + 1)
 	if ldp.IsPentecostarion {
 		// override for Pascha through the Saturday before the Sunday of Thomas
-		switch ldp.DayOfSeason {
+		switch ldp.pentecostarionDayToMovableDay() {
 		case 1:
 			{
 				ldp.ModeOfWeek = 1
@@ -590,7 +575,7 @@ func (ldp *LDP) setEothinonNumber() {
 	}
 }
 
-func (ldp *LDP) SetDayOfSeason() {
+func (ldp *LDP) setDayOfSeason() {
 	if ldp.IsTriodion || ldp.IsPentecostarion {
 		// Get difference in milliseconds
 		diffMillis := DiffMillis(ldp.TheDay, ldp.TriodionStartDateThisYear)
@@ -601,18 +586,6 @@ func (ldp *LDP) SetDayOfSeason() {
 	}
 }
 
-func (ldp *LDP) OverrideMovableCycleDay(d int) {
-	if d == 0 {
-		// zero means reset back to original day of the season
-		ldp.DayOfSeason = ldp.originalDayOfSeason
-		ldp.DaysSinceStartOfTriodion = ldp.originalDayOfSeason
-	} else {
-		// override to the specified day
-		ldp.DayOfSeason = d
-		ldp.DaysSinceStartOfTriodion = d
-	}
-}
-
 func (ldp *LDP) setDaysSinceStartOfLastTriodion() {
 	diffMillis := DiffMillis(ldp.TheDay, ldp.TriodionStartDateLast)
 	// Get difference in days, add 1 to be 1-index based instead of zero.
@@ -651,7 +624,7 @@ func (ldp *LDP) pentecostarionDayToMovableDay() int {
 	}
 }
 
-func (ldp *LDP) SetDayOfWeek() {
+func (ldp *LDP) setDayOfWeek() {
 	dow := ldp.TheDay.Weekday()
 	switch dow {
 	case time.Sunday:
@@ -754,10 +727,8 @@ func (ldp *LDP) setNbrDayOfWeekOverride(day string) {
 	}
 }
 
-// Because the date can be reset for an instance of this class,
-// it is necessary to reset certain variables to their default value.
-// Otherwise, there value can carry over erroneously to a new date.
-func (ldp *LDP) SetVariablesToDefaults() {
+// Resets the computed variables to their default value, before they are set for the date.
+func (ldp *LDP) setVariablesToDefaults() {
 	ldp.ModeOfWeek = 0
 	ldp.ModeOfWeekOverride = 0
 	ldp.EothinonNumber = 0
@@ -813,7 +784,12 @@ func (ldp *LDP) daysInMonth(month int) int {
 // RelativeTopic computes a new topic relative to liturgical day properties
 // If modeOverride > 0, it will be used instead of the mode of the week for a topic starting with "oc" (Octoechos)
 // If dayOverride > 0, it be used instead of the day of the liturgical date for a topic starting with "oc" (Octoechos)
+// Otherwise, the mode and day of the week honor the overrides of the LDP (see WithOverrides).
+// A topic rejected by CheckTopic is returned as it is.
 func (ldp *LDP) RelativeTopic(topic string, modeOverride, dayOverride int) string {
+	if CheckTopic(topic) != nil {
+		return topic
+	}
 	sb := strings.Builder{}
 	eoNbr := ldp.EothinonNumber
 	var bookAcronymn string
@@ -848,7 +824,7 @@ func (ldp *LDP) RelativeTopic(topic string, modeOverride, dayOverride int) strin
 		sb.WriteString("d")
 		sb.WriteString(fmt.Sprintf("%03d", ldp.DaysSinceStartOfTriodion))
 	// Service Month and Day - Lectionary (Gospel and Epistle), Menaion, Octoechos, Synxarion, Typikon
-	case "le.go.me", "le.ep.me", "me", "sy", "ty":
+	case "le.go.me", "le.ep.me", "le.pr.me", "me", "sy", "ty":
 		sb.WriteString("m")
 		sb.WriteString(ldp.NbrMonth)
 		sb.WriteString(".d")
@@ -858,17 +834,25 @@ func (ldp *LDP) RelativeTopic(topic string, modeOverride, dayOverride int) strin
 		if modeOverride > 0 && modeOverride < 9 {
 			sb.WriteString(strconv.Itoa(modeOverride))
 		} else {
-			sb.WriteString(ldp.NbrModeOfWeek)
+			sb.WriteString(strconv.Itoa(ldp.GetModeOfWeek()))
 		}
 		sb.WriteString(".d")
-		if modeOverride > 0 && modeOverride < 9 {
+		if dayOverride > 0 && dayOverride < 8 {
 			sb.WriteString(strconv.Itoa(dayOverride))
 		} else {
-			sb.WriteString(ldp.NbrDayOfWeek)
+			sb.WriteString(ldp.getNbrDayOfWeek())
 		}
 	}
 	return sb.String()
 }
+// CheckTopic returns an error if the topic cannot be resolved by RelativeTopic,
+// that is, if a topic of the lectionary is not le.book.part, e.g. le.go.*
+func CheckTopic(topic string) error {
+	if parts := strings.Split(topic, "."); parts[0] == "le" && len(parts) < 3 {
+		return fmt.Errorf("a topic of the lectionary must be le.book.part, but got %s", topic)
+	}
+	return nil
+}
 func FormattedDate(date time.Time) string {
 	return fmt.Sprintf("%d-%d-%d",date.Month(), date.Day(),date.Year())
 }
@@ -876,19 +860,25 @@ func (ldp *LDP) getWeekAndDayOfLukanCycle() string {
 	week := ldp.getWeekOfLukanCycle()
 	return fmt.Sprintf("%s of the %d%s week of Luke", ldp.DayOfWeek, week, getNumberDegree(week))
 }
-func (ldp *LDP) IsNativityOfChrist() bool {
-	if ldp.CalendarType == calendarTypes.Gregorian {
-		return ldp.TheDay.Month() == 12 && ldp.TheDay.Day() == 25
-	} else {
-		return ldp.TheDay.Month() == 1 && ldp.TheDay.Day() == 7
+// IsFixedFeast returns true if the month and day of the fixed cycle (Menaion) are those of the liturgical day
+func (ldp *LDP) IsFixedFeast(month, day int) bool {
+	return ldp.MenaionMonth == month && ldp.MenaionDay == day
+}
+// DateFixedFeast returns the civil date on which the month and day of the fixed cycle (Menaion) fall
+// in the civil year of the liturgical day, e.g. for the Old calendar, December 25 falls on January 7.
+func (ldp *LDP) DateFixedFeast(month, day int) time.Time {
+	year := ldp.TheDay.Year()
+	date := CivilDate(year, month, day, ldp.CalendarType)
+	if date.Year() > year {
+		date = CivilDate(year-1, month, day, ldp.CalendarType)
 	}
+	return date
+}
+func (ldp *LDP) IsNativityOfChrist() bool {
+	return ldp.IsFixedFeast(12, 25)
 }
 func (ldp *LDP) DateNativityOfChrist() time.Time {
-	if ldp.CalendarType == calendarTypes.Gregorian {
-		return NewDate(ldp.TheDay.Year(),12,25)
-	} else {
-		return NewDate(ldp.TheDay.Year(),1,7)
-	}
+	return ldp.DateFixedFeast(12, 25)
 }
 func getNumberDegree(i int) string {
 	nbr := strconv.Itoa(i)
@@ -3,6 +3,9 @@ package ldp
 import (
 	"fmt"
 	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -92,6 +95,15 @@ var modes = []ModeData{
 	{2020, 3, 21, 6},
 	{2020, 3, 22, 7},
 	{2020, 3, 23, 7},
+	// Bright Week
+	{2020, 4, 19, 1},
+	{2020, 4, 20, 2},
+	{2020, 4, 21, 3},
+	{2020, 4, 22, 4},
+	{2020, 4, 23, 5},
+	{2020, 4, 24, 6},
+	{2020, 4, 25, 8},
+	{2020, 4, 26, 1},
 }
 
 // Test liturgical dates from the perspective of a
@@ -251,12 +263,31 @@ func TestLDP_RelativeTopic(t *testing.T) {
 		if err != nil {
 			t.Error(err.Error())
 		}
-		rt := ldp.RelativeTopic(d.topic)
+		rt := ldp.RelativeTopic(d.topic, 0, 0)
 		if rt != d.expectedTopic {
 			t.Error(fmt.Sprintf("expected %s, got %s", d.expectedTopic, rt))
 		}
 	}
 }
+func TestCheckTopic(t *testing.T) {
+	ldp, err := NewLDPYMD(2020, 10, 13, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"le", "le.*", "le.go"} {
+		if err = CheckTopic(topic); err == nil {
+			t.Errorf("%s: expected an error", topic)
+		}
+		if rt := ldp.RelativeTopic(topic, 0, 0); rt != topic {
+			t.Errorf("%s: expected the topic as it is, got %s", topic, rt)
+		}
+	}
+	for _, topic := range []string{"le.go.*", "oc.*", "me.*", "actors"} {
+		if err = CheckTopic(topic); err != nil {
+			t.Errorf("%s: unexpected %v", topic, err)
+		}
+	}
+}
 func TestLDP_GetModeOfWeek(t *testing.T) {
 	for _, d := range modes {
 		ldp, err := NewLDPYMD(d.testYear, d.testMonth, d.testDay, calendarTypes.Gregorian)
@@ -269,6 +300,24 @@ func TestLDP_GetModeOfWeek(t *testing.T) {
 		}
 	}
 }
+func TestGreatLentStartDate(t *testing.T) {
+	// Clean Monday is 48 days before Pascha
+	data := []struct{ year, month, day int }{
+		{2020, 3, 2},
+		{2021, 3, 15},
+		{2022, 3, 7},
+	}
+	for _, d := range data {
+		ldp, err := NewLDPYMD(d.year, 1, 10, calendarTypes.Gregorian)
+		if err != nil {
+			t.Error(err.Error())
+		}
+		expected := NewDate(d.year, d.month, d.day)
+		if !ldp.GreatLentStartDate.Equal(expected) {
+			t.Errorf("%d: expected Clean Monday on %s, got %s", d.year, expected.Format("2006-01-02"), ldp.GreatLentStartDate.Format("2006-01-02"))
+		}
+	}
+}
 func TestElevationOfCross(t *testing.T) {
 	var data = []ElevationData{
 		{2007,9,15,
@@ -440,3 +489,304 @@ func TestElevationOfCross(t *testing.T) {
 		}
 	}
 }
+
+type JulianData struct {
+	civilYear, civilMonth, civilDay    int
+	julianYear, julianMonth, julianDay int
+	offset                             int
+}
+
+var julianDates = []JulianData{
+	{1970, 1, 1, 1969, 12, 19, 13},
+	{2020, 1, 7, 2019, 12, 25, 13},
+	{2020, 3, 13, 2020, 2, 29, 13},
+	{2021, 9, 27, 2021, 9, 14, 13},
+	{1900, 3, 13, 1900, 2, 29, 12},
+	{1900, 3, 14, 1900, 3, 1, 13},
+	{2100, 3, 13, 2100, 2, 28, 13},
+	{2100, 3, 15, 2100, 3, 1, 14},
+}
+
+func TestJulianDate(t *testing.T) {
+	for i, d := range julianDates {
+		civil := NewDate(d.civilYear, d.civilMonth, d.civilDay)
+		y, m, day := JulianDate(civil)
+		if y != d.julianYear || m != d.julianMonth || day != d.julianDay {
+			t.Errorf("case %d: expected %d-%d-%d, got %d-%d-%d", i, d.julianYear, d.julianMonth, d.julianDay, y, m, day)
+		}
+		if got := JulianToCivil(d.julianYear, d.julianMonth, d.julianDay); !got.Equal(civil) {
+			t.Errorf("case %d: expected %s, got %s", i, civil, got)
+		}
+		if got := JulianOffset(civil); got != d.offset {
+			t.Errorf("case %d: expected offset %d, got %d", i, d.offset, got)
+		}
+	}
+}
+
+var oldCalendarTopics = []TopicData{
+	// the Menaion date is 13 days behind the civil date
+	{2020, 1, 7, "me.*", "me.m12.d25"},
+	{2020, 3, 22, "me.*", "me.m03.d09"},
+	{2020, 3, 22, "sy.*", "sy.m03.d09"},
+	// Pascha and the movable cycle do not change
+	{2020, 3, 22, "oc.*", "oc.m7.d1"},
+	{2020, 3, 22, "tr.*", "tr.d043"},
+}
+
+func TestLDP_RelativeTopicOldCalendar(t *testing.T) {
+	for _, d := range oldCalendarTopics {
+		ldp, err := NewLDPYMD(d.testYear, d.testMonth, d.testDay, calendarTypes.Julian)
+		if err != nil {
+			t.Error(err.Error())
+		}
+		rt := ldp.RelativeTopic(d.topic, 0, 0)
+		if rt != d.expectedTopic {
+			t.Error(fmt.Sprintf("expected %s, got %s", d.expectedTopic, rt))
+		}
+	}
+}
+
+func TestLDP_OldCalendar(t *testing.T) {
+	for _, d := range paschaDates {
+		p := ComputeDayOfPascha(d.testYear, calendarTypes.Julian)
+		if p.Year() != d.expectedYear || p.Month() != d.expectedMonth || p.Day() != d.expectedDay {
+			t.Error(fmt.Sprintf("expected %d-%d-%d, got %d-%d-%d", d.expectedYear, d.expectedMonth, d.expectedDay, p.Year(), p.Month(), p.Day()))
+		}
+	}
+	ldp, err := NewLDPYMD(2020, 1, 7, calendarTypes.Julian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ldp.IsNativityOfChrist() {
+		t.Error("expected 2020-1-7 to be the Nativity of Christ on the Old calendar")
+	}
+	if n := ldp.DateNativityOfChrist(); !n.Equal(NewDate(2020, 1, 7)) {
+		t.Errorf("expected the Nativity on 2020-1-7, got %s", n)
+	}
+	ldp, err = NewLDPYMD(2020, 12, 25, calendarTypes.Julian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ldp.IsNativityOfChrist() {
+		t.Error("did not expect 2020-12-25 to be the Nativity of Christ on the Old calendar")
+	}
+	if !ldp.ElevationOfCrossDateThisYear.Equal(NewDate(2020, 9, 27)) {
+		t.Errorf("expected the Elevation of the Cross on 2020-9-27, got %s", ldp.ElevationOfCrossDateThisYear)
+	}
+	if !ldp.SundayAfterElevationOfCrossDateLast.Equal(NewDate(2020, 10, 4)) {
+		t.Errorf("expected the Sunday after the Elevation on 2020-10-4, got %s", ldp.SundayAfterElevationOfCrossDateLast)
+	}
+}
+
+func TestNewYearCalendar(t *testing.T) {
+	c, err := NewYearCalendar(2020, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Days) != 366 {
+		t.Fatalf("expected 366 days, got %d", len(c.Days))
+	}
+	// Pascha, April 19, 2020
+	pascha := c.Days[31+29+31+18]
+	if pascha.Date != "2020-04-19" || pascha.DayOfPentecostarion != 1 || pascha.ModeOfWeek != 1 || pascha.Topics["oc"] != "oc.m1.d1" {
+		t.Errorf("unexpected properties for Pascha: %+v", pascha)
+	}
+	march22 := c.Days[31+29+21]
+	if march22.Topics["me"] != "me.m03.d22" || march22.Topics["le.go.eo"] != "le.go.eo.w07" || march22.FastingPeriod != FastingPeriodGreatLent {
+		t.Errorf("unexpected properties for 2020-03-22: %+v", march22)
+	}
+	if _, ok := c.Days[0].Topics["pe"]; ok {
+		t.Errorf("did not expect a Pentecostarion topic on 2020-01-01")
+	}
+	var sb strings.Builder
+	if err = c.WriteICS(&sb); err != nil {
+		t.Fatal(err)
+	}
+	ics := sb.String()
+	if strings.Count(ics, "BEGIN:VEVENT") != 366 || !strings.Contains(ics, "DTSTART;VALUE=DATE:20200419\r\n") {
+		t.Errorf("unexpected ics")
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines to be folded at 75 octets, got %s", line)
+		}
+	}
+}
+
+func TestFastingPeriod(t *testing.T) {
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		expected         string
+	}{
+		{2020, 3, 2, calendarTypes.Gregorian, FastingPeriodGreatLent},
+		{2020, 3, 1, calendarTypes.Gregorian, FastingPeriodNone},
+		{2020, 4, 11, calendarTypes.Gregorian, FastingPeriodHolyWeek},
+		{2020, 6, 15, calendarTypes.Gregorian, FastingPeriodApostles},
+		{2020, 7, 5, calendarTypes.Gregorian, FastingPeriodNone},
+		{2020, 7, 5, calendarTypes.Julian, FastingPeriodApostles},
+		{2020, 8, 14, calendarTypes.Gregorian, FastingPeriodDormition},
+		{2020, 8, 14, calendarTypes.Julian, FastingPeriodDormition},
+		{2020, 8, 28, calendarTypes.Julian, FastingPeriodNone},
+		{2020, 11, 15, calendarTypes.Gregorian, FastingPeriodNativity},
+		{2020, 11, 15, calendarTypes.Julian, FastingPeriodNone},
+		{2021, 1, 6, calendarTypes.Julian, FastingPeriodNativity},
+	}
+	for _, d := range data {
+		ldp, err := NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ldp.FastingPeriod(); got != d.expected {
+			t.Errorf("%d-%d-%d %s: expected '%s', got '%s'", d.year, d.month, d.day, d.calendarType, d.expected, got)
+		}
+	}
+}
+
+func TestFastingLevel(t *testing.T) {
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		expected         string
+	}{
+		// Pascha 2020 is April 19
+		{2020, 2, 12, calendarTypes.Gregorian, FastingLevelFastFree},  // Wednesday after the Publican and Pharisee
+		{2020, 2, 19, calendarTypes.Gregorian, FastingLevelStrict},    // Wednesday
+		{2020, 2, 26, calendarTypes.Gregorian, FastingLevelDairy},     // Wednesday of Cheesefare week
+		{2020, 3, 2, calendarTypes.Gregorian, FastingLevelStrict},     // Clean Monday
+		{2020, 3, 7, calendarTypes.Gregorian, FastingLevelWineAndOil}, // Saturday of Great Lent
+		{2020, 3, 25, calendarTypes.Gregorian, FastingLevelFish},      // Annunciation
+		{2020, 3, 25, calendarTypes.Julian, FastingLevelStrict},       // March 12 on the Old calendar
+		{2020, 4, 7, calendarTypes.Julian, FastingLevelFish},          // Annunciation on the Old calendar
+		{2020, 4, 12, calendarTypes.Gregorian, FastingLevelFish},      // Palm Sunday
+		{2020, 4, 17, calendarTypes.Gregorian, FastingLevelStrict},    // Holy Friday
+		{2020, 4, 22, calendarTypes.Gregorian, FastingLevelFastFree},  // Bright Wednesday
+		{2020, 4, 29, calendarTypes.Gregorian, FastingLevelStrict},    // Wednesday after Thomas Sunday
+		{2020, 5, 13, calendarTypes.Gregorian, FastingLevelFish},      // Mid-Pentecost
+		{2020, 6, 10, calendarTypes.Gregorian, FastingLevelFastFree},  // Wednesday after Pentecost
+		{2020, 6, 16, calendarTypes.Gregorian, FastingLevelFish},      // Tuesday of the Apostles' Fast
+		{2020, 6, 17, calendarTypes.Gregorian, FastingLevelStrict},    // Wednesday of the Apostles' Fast
+		{2020, 8, 3, calendarTypes.Gregorian, FastingLevelStrict},     // Dormition Fast
+		{2020, 8, 6, calendarTypes.Gregorian, FastingLevelFish},       // Transfiguration
+		{2020, 8, 19, calendarTypes.Julian, FastingLevelFish},         // Transfiguration on the Old calendar
+		{2020, 9, 14, calendarTypes.Gregorian, FastingLevelStrict},    // Elevation of the Cross
+		{2020, 12, 23, calendarTypes.Gregorian, FastingLevelStrict},   // forefeast of the Nativity
+		{2020, 12, 25, calendarTypes.Gregorian, FastingLevelFastFree}, // Nativity
+		{2020, 12, 25, calendarTypes.Julian, FastingLevelStrict},      // Friday, December 12 on the Old calendar
+		{2021, 1, 1, calendarTypes.Gregorian, FastingLevelFastFree},   // Friday after the Nativity
+		{2021, 1, 8, calendarTypes.Julian, FastingLevelFastFree},      // Friday after the Nativity on the Old calendar
+		{2020, 7, 8, calendarTypes.Gregorian, FastingLevelStrict},     // Wednesday
+		{2020, 7, 9, calendarTypes.Gregorian, FastingLevelNone},       // Thursday
+	}
+	for _, d := range data {
+		ldp, err := NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ldp.FastingLevel(); got != d.expected {
+			t.Errorf("%d-%d-%d %s: expected '%s', got '%s'", d.year, d.month, d.day, d.calendarType, d.expected, got)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	// computing the days of a year concurrently must give the same results as computing them one by one
+	start := NewDate(2021, 1, 1)
+	expected := make([]CalendarDay, 365)
+	for i := range expected {
+		l, err := Compute(start.AddDate(0, 0, i), calendarTypes.Julian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[i] = l.CalendarDay()
+	}
+	got := make([]CalendarDay, len(expected))
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l, err := Compute(start.AddDate(0, 0, i).Add(15*time.Hour), calendarTypes.Julian)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got[i] = l.CalendarDay()
+		}(i)
+	}
+	wg.Wait()
+	for i := range expected {
+		if !reflect.DeepEqual(expected[i], got[i]) {
+			t.Errorf("%s: expected %v, got %v", expected[i].Date, expected[i], got[i])
+		}
+	}
+	l, err := Compute(NewDate(2021, 1, 1), calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.TheDayBefore.Equal(NewDate(2020, 12, 31)) {
+		t.Errorf("expected the day before to be 2020-12-31, got %s", l.TheDayBefore.Format("2006-01-02"))
+	}
+	if _, err = Compute(NewDate(1500, 1, 1), calendarTypes.Gregorian); err == nil {
+		t.Errorf("expected an error for the year 1500")
+	}
+}
+
+func TestLDP_WithOverrides(t *testing.T) {
+	l, err := NewLDPYMD(2020, 10, 13, calendarTypes.Gregorian) // Tuesday, mode 1
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := l.WithOverrides(Overrides{Mode: 7, Day: 1, MovableCycleDay: 12})
+	data := []struct {
+		ldp      LDP
+		topic    string
+		expected string
+	}{
+		{l, "oc.*", "oc.m1.d3"},
+		{l, "tr.*", "tr.d248"},
+		{o, "oc.*", "oc.m7.d1"},
+		{o, "tr.*", "tr.d012"},
+	}
+	for _, d := range data {
+		if got := d.ldp.RelativeTopic(d.topic, 0, 0); got != d.expected {
+			t.Errorf("%s: expected %s, got %s", d.topic, d.expected, got)
+		}
+	}
+	if got := o.RelativeTopic("oc.*", 2, 5); got != "oc.m2.d5" {
+		t.Errorf("expected the arguments to take precedence, got %s", got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	inspection, err := Inspect(NewDate(2020, 10, 13), calendarTypes.Gregorian, Overrides{Day: 1}, []string{
+		"oc.*/ocVE.ApolTheotokionVM",
+		"oc.*/ocVE.ApolTheotokionVM @Mode 3",
+		"me.*/meVE.Doxastikon",
+		"tr.*/trMA.Kontakion @Mode 3",
+		"oc.*/ocVE.ApolTheotokionVM @Mode 9",
+		"ocVE.ApolTheotokionVM",
+		"le.*/x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.Topics["oc"] != "oc.m1.d1" {
+		t.Errorf("oc: expected oc.m1.d1, got %s", inspection.Topics["oc"])
+	}
+	if inspection.Topics["le.go.lu"] != "le.go.lu.d023" {
+		t.Errorf("le.go.lu: expected le.go.lu.d023, got %s", inspection.Topics["le.go.lu"])
+	}
+	expected := []string{"oc.m1.d1/ocVE.ApolTheotokionVM", "oc.m3.d1/ocVE.ApolTheotokionVM", "me.m10.d13/meVE.Doxastikon", "", "", "", ""}
+	for i, r := range inspection.Rids {
+		if r.ID != expected[i] {
+			t.Errorf("%s: expected %s, got %s", r.Rid, expected[i], r.ID)
+		}
+		if (len(r.ID) == 0) != (len(r.Error) > 0) {
+			t.Errorf("%s: expected an error only when the rid is not resolved, got '%s'", r.Rid, r.Error)
+		}
+	}
+	if _, err = Inspect(NewDate(2020, 10, 13), calendarTypes.Gregorian, Overrides{Mode: 9}, nil); err == nil {
+		t.Errorf("expected an error for mode 9")
+	}
+}
@@ -0,0 +1,147 @@
+package ldp
+
+import "time"
+
+// Periods of the movable cycle.  The weeks of Great Lent and of the weeks after Pentecost
+// run from Monday through Sunday, e.g. the Sunday of the Cross ends the third week of Great Lent.
+// The weeks of the Triodion before Lent, and of Pascha, run from Sunday through Saturday,
+// e.g. Thomas Sunday starts the second week of Pascha.
+const (
+	PeriodPublican        = "publican"        // the week of the Publican and the Pharisee
+	PeriodProdigal        = "prodigal"        // the week of the Prodigal Son
+	PeriodMeatfare        = "meatfare"        // Meatfare Sunday
+	PeriodCheesefare      = "cheesefare"      // the week after Meatfare Sunday, through Cheesefare Sunday
+	PeriodGreatLent       = "greatLent"       // Clean Monday through the Friday before Lazarus Saturday, in weeks
+	PeriodLazarusSaturday = "lazarusSaturday" // Lazarus Saturday
+	PeriodPalmSunday      = "palmSunday"      // Palm Sunday
+	PeriodHolyWeek        = "holyWeek"        // Holy Monday through Holy Saturday
+	PeriodPascha          = "pascha"          // Pascha
+	PeriodBrightWeek      = "brightWeek"      // Bright Monday through Bright Saturday
+	PeriodAfterPascha     = "afterPascha"     // Thomas Sunday through the Saturday before Pentecost, in weeks from 2
+	PeriodPentecost       = "pentecost"       // Pentecost
+	PeriodAfterPentecost  = "afterPentecost"  // the Monday after Pentecost through the Saturday before the Triodion, in weeks
+)
+
+// Suffixes of the keys of the periods of a feast, e.g. theophany.afterfeast
+const (
+	ForefeastSuffix   = ".forefeast"
+	AfterfeastSuffix  = ".afterfeast"
+	LeavetakingSuffix = ".leavetaking"
+)
+
+// Period is a named period of the liturgical year
+type Period struct {
+	Key    string `json:"key"`              // e.g. greatLent, or for a feast, e.g. theophany.afterfeast
+	Week   int    `json:"week,omitempty"`   // the week of the period, from 1, or 0 if the period is not counted in weeks
+	OneDay bool   `json:"oneDay,omitempty"` // the period is a single day, e.g. Pascha
+}
+
+// feast is a great feast, with the days of its forefeast and afterfeast.
+// The leave-taking is the last day of the afterfeast.
+type feast struct {
+	key                   string
+	month, day            int // of the fixed cycle, or 0, 0 for a feast of the movable cycle
+	pascha                int // for a feast of the movable cycle, the days after Pascha
+	forefeast, afterfeast int // the number of days
+}
+
+// feasts are the great feasts that have a forefeast or an afterfeast
+var feasts = []feast{
+	{key: "midPentecost", pascha: 24, afterfeast: 7},
+	{key: "ascension", pascha: 39, afterfeast: 8},
+	{key: "nativityOfTheotokos", month: 9, day: 8, forefeast: 1, afterfeast: 4},
+	{key: "elevationOfCross", month: 9, day: 14, forefeast: 1, afterfeast: 7},
+	{key: "entranceOfTheotokos", month: 11, day: 21, forefeast: 1, afterfeast: 4},
+	{key: "nativityOfChrist", month: 12, day: 25, forefeast: 5, afterfeast: 6},
+	{key: "theophany", month: 1, day: 6, forefeast: 4, afterfeast: 8},
+	{key: "meetingOfLord", month: 2, day: 2, forefeast: 1, afterfeast: 7},
+	{key: "annunciation", month: 3, day: 25, forefeast: 1, afterfeast: 1},
+	{key: "transfiguration", month: 8, day: 6, forefeast: 1, afterfeast: 7},
+	{key: "dormition", month: 8, day: 15, forefeast: 1, afterfeast: 8},
+}
+
+// Periods returns the periods of the liturgical day: first the period of the movable cycle,
+// then, if the day is a great feast or in its forefeast or afterfeast, the period of the feast,
+// e.g. for January 10, the 31st week after Pentecost and the afterfeast of Theophany.
+func (ldp *LDP) Periods() []Period {
+	periods := []Period{ldp.movablePeriod()}
+	d := daysBetween(ldp.PaschaDateThisYear, ldp.TheDay)
+	for _, f := range feasts {
+		var n int // the days from the feast to the liturgical day
+		if f.month == 0 {
+			n = d - f.pascha
+		} else {
+			// the nearest feast, since the forefeast or afterfeast may fall in another year, e.g. the afterfeast of the Nativity
+			n = daysBetween(CivilDate(ldp.MenaionYear, f.month, f.day, ldp.CalendarType), ldp.TheDay)
+			for _, year := range []int{ldp.MenaionYear - 1, ldp.MenaionYear + 1} {
+				if m := daysBetween(CivilDate(year, f.month, f.day, ldp.CalendarType), ldp.TheDay); abs(m) < abs(n) {
+					n = m
+				}
+			}
+		}
+		switch {
+		case n == 0:
+			periods = append(periods, Period{Key: f.key, OneDay: true})
+		case n < 0 && n >= -f.forefeast:
+			periods = append(periods, Period{Key: f.key + ForefeastSuffix})
+		case n > 0 && n == f.afterfeast:
+			periods = append(periods, Period{Key: f.key + LeavetakingSuffix, OneDay: true})
+		case n > 0 && n < f.afterfeast:
+			periods = append(periods, Period{Key: f.key + AfterfeastSuffix})
+		}
+	}
+	return periods
+}
+
+// movablePeriod returns the period of the movable cycle of the liturgical day
+func (ldp *LDP) movablePeriod() Period {
+	d := daysBetween(ldp.PaschaDateThisYear, ldp.TheDay)
+	switch {
+	case d < -70:
+		return Period{Key: PeriodAfterPentecost, Week: (daysBetween(ComputeDayOfPascha(ldp.TheDay.Year()-1, ldp.CalendarType), ldp.TheDay)-50)/7 + 1}
+	case d <= -64:
+		return Period{Key: PeriodPublican}
+	case d <= -57:
+		return Period{Key: PeriodProdigal}
+	case d == -56:
+		return Period{Key: PeriodMeatfare, OneDay: true}
+	case d <= -49:
+		return Period{Key: PeriodCheesefare}
+	case d <= -9:
+		return Period{Key: PeriodGreatLent, Week: (d+48)/7 + 1}
+	case d == -8:
+		return Period{Key: PeriodLazarusSaturday, OneDay: true}
+	case d == -7:
+		return Period{Key: PeriodPalmSunday, OneDay: true}
+	case d < 0:
+		return Period{Key: PeriodHolyWeek}
+	case d == 0:
+		return Period{Key: PeriodPascha, OneDay: true}
+	case d <= 6:
+		return Period{Key: PeriodBrightWeek}
+	case d <= 48:
+		return Period{Key: PeriodAfterPascha, Week: d/7 + 1}
+	case d == 49:
+		return Period{Key: PeriodPentecost, OneDay: true}
+	}
+	return Period{Key: PeriodAfterPentecost, Week: (d-50)/7 + 1}
+}
+
+// LukanCycleWeek returns the week of the Lukan cycle of the liturgical day, from 1
+func (ldp *LDP) LukanCycleWeek() int {
+	return ldp.getWeekOfLukanCycle()
+}
+
+// daysBetween returns the number of days from the date from to the date to, negative if to is before from
+func daysBetween(from, to time.Time) int {
+	from = NewDate(from.Year(), int(from.Month()), from.Day())
+	to = NewDate(to.Year(), int(to.Month()), to.Day())
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
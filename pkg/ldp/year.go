@@ -0,0 +1,188 @@
+package ldp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CalendarTopics are the topics resolved by RelativeTopic for each day of a YearCalendar
+var CalendarTopics = []string{"da", "eo", "le.ep.mc", "le.ep.me", "le.go.eo", "le.go.lu", "le.go.mc", "le.go.me", "le.pr.tr", "me", "oc", "pe", "sy", "tr", "ty"}
+
+// CalendarDay holds the liturgical day properties of a day of a YearCalendar
+type CalendarDay struct {
+	Date                string            `json:"date"`        // the civil date, yyyy-mm-dd
+	MenaionDate         string            `json:"menaionDate"` // the date of the fixed cycle, yyyy-mm-dd
+	DayOfWeek           string            `json:"dayOfWeek"`
+	ModeOfWeek          int               `json:"modeOfWeek"`
+	Eothinon            int               `json:"eothinon,omitempty"`            // Sundays only
+	DayOfTriodion       int               `json:"dayOfTriodion,omitempty"`       // 1..70
+	DayOfPentecostarion int               `json:"dayOfPentecostarion,omitempty"` // 1..57, Pascha is 1
+	DayOfMovableCycle   int               `json:"dayOfMovableCycle"`             // days since the start of the last Triodion
+	LukanWeek           int               `json:"lukanWeek"`                     // week since the start of the last Lukan cycle
+	FastingPeriod       string            `json:"fastingPeriod,omitempty"`
+	FastingLevel        string            `json:"fastingLevel"`
+	Topics              map[string]string `json:"topics"` // CalendarTopics resolved for the day, by book
+}
+
+// YearCalendar holds the liturgical day properties of each day of a civil year
+type YearCalendar struct {
+	Year     int                        `json:"year"`
+	Calendar calendarTypes.CalendarType `json:"calendar"`
+	Days     []CalendarDay              `json:"days"`
+}
+
+// NewYearCalendar computes the liturgical day properties of each day of the year
+func NewYearCalendar(year int, calendarType calendarTypes.CalendarType) (*YearCalendar, error) {
+	if err := validateYMD(year, 1, 1); err != nil {
+		return nil, err
+	}
+	c := &YearCalendar{Year: year, Calendar: calendarType}
+	for d := NewDate(year, 1, 1); d.Year() == year; d = d.AddDate(0, 0, 1) {
+		l, err := NewLDPYMD(year, int(d.Month()), d.Day(), calendarType)
+		if err != nil {
+			return nil, err
+		}
+		c.Days = append(c.Days, l.CalendarDay())
+	}
+	return c, nil
+}
+
+// CalendarDay returns the properties of the liturgical day used by a YearCalendar
+func (ldp *LDP) CalendarDay() CalendarDay {
+	day := CalendarDay{
+		Date:              ldp.TheDay.Format("2006-01-02"),
+		MenaionDate:       fmt.Sprintf("%04d-%02d-%02d", ldp.MenaionYear, ldp.MenaionMonth, ldp.MenaionDay),
+		DayOfWeek:         ldp.DayOfWeek,
+		ModeOfWeek:        ldp.ModeOfWeek,
+		Eothinon:          ldp.EothinonNumber,
+		DayOfMovableCycle: ldp.DaysSinceStartOfTriodion,
+		LukanWeek:         ldp.getWeekOfLukanCycle(),
+		FastingPeriod:     ldp.FastingPeriod(),
+		FastingLevel:      ldp.FastingLevel(),
+		Topics:            make(map[string]string),
+	}
+	if ldp.IsTriodion {
+		day.DayOfTriodion = ldp.DayOfSeason
+	}
+	if ldp.IsPentecostarion {
+		day.DayOfPentecostarion = ldp.DayOfSeason - 70
+	}
+	for _, topic := range CalendarTopics {
+		switch topic {
+		case "eo", "le.go.eo":
+			if !ldp.IsSunday {
+				continue
+			}
+		case "tr", "le.pr.tr":
+			if !ldp.IsTriodion {
+				continue
+			}
+		case "pe":
+			if !ldp.IsPentecostarion {
+				continue
+			}
+		}
+		day.Topics[topic] = ldp.RelativeTopic(topic+".*", 0, 0)
+	}
+	return day
+}
+
+// Summary returns a one line description of the day, e.g. Mode 3, Eothinon 5, Great Lent, wine and oil
+func (d *CalendarDay) Summary() string {
+	var parts []string
+	if d.DayOfPentecostarion == 1 {
+		parts = append(parts, "Pascha")
+	}
+	parts = append(parts, fmt.Sprintf("Mode %d", d.ModeOfWeek))
+	if d.Eothinon > 0 {
+		parts = append(parts, fmt.Sprintf("Eothinon %d", d.Eothinon))
+	}
+	if d.DayOfTriodion > 0 {
+		parts = append(parts, fmt.Sprintf("Triodion day %d", d.DayOfTriodion))
+	}
+	if d.DayOfPentecostarion > 0 {
+		parts = append(parts, fmt.Sprintf("Pentecostarion day %d", d.DayOfPentecostarion))
+	}
+	if len(d.FastingPeriod) > 0 {
+		parts = append(parts, d.FastingPeriod)
+	}
+	if d.FastingLevel != FastingLevelNone {
+		parts = append(parts, d.FastingLevel)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteJSON writes the calendar as indented json
+func (c *YearCalendar) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// WriteICS writes the calendar in iCalendar (RFC 5545) form, with an all day event for each day.
+// The summary of an event is CalendarDay.Summary, and the description lists the
+// menaion date, the week of Luke, the fasting level, and the topics.
+func (c *YearCalendar) WriteICS(w io.Writer) error {
+	var sb strings.Builder
+	writeICSLine(&sb, "BEGIN:VCALENDAR")
+	writeICSLine(&sb, "VERSION:2.0")
+	writeICSLine(&sb, "PRODID:-//liturgiko//doxa//EN")
+	writeICSLine(&sb, "CALSCALE:GREGORIAN")
+	writeICSLine(&sb, "X-WR-CALNAME:"+escapeICS(fmt.Sprintf("Liturgical Calendar %d (%s)", c.Year, c.Calendar)))
+	for _, d := range c.Days {
+		date, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			return err
+		}
+		var description []string
+		description = append(description, "Menaion date: "+d.MenaionDate)
+		description = append(description, fmt.Sprintf("Week of Luke: %d", d.LukanWeek))
+		description = append(description, "Fasting: "+d.FastingLevel)
+		var books []string
+		for book := range d.Topics {
+			books = append(books, book)
+		}
+		sort.Strings(books)
+		for _, book := range books {
+			description = append(description, d.Topics[book])
+		}
+		writeICSLine(&sb, "BEGIN:VEVENT")
+		writeICSLine(&sb, fmt.Sprintf("UID:%s-%s@doxa", date.Format("20060102"), strings.ToLower(c.Calendar.String())))
+		writeICSLine(&sb, "DTSTAMP:"+date.Format("20060102")+"T000000Z")
+		writeICSLine(&sb, "DTSTART;VALUE=DATE:"+date.Format("20060102"))
+		writeICSLine(&sb, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+		writeICSLine(&sb, "SUMMARY:"+escapeICS(d.Summary()))
+		writeICSLine(&sb, "DESCRIPTION:"+escapeICS(strings.Join(description, "\n")))
+		writeICSLine(&sb, "TRANSP:TRANSPARENT")
+		writeICSLine(&sb, "END:VEVENT")
+	}
+	writeICSLine(&sb, "END:VCALENDAR")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeICSLine writes the content line, folded at 75 octets, ending with CRLF
+func writeICSLine(sb *strings.Builder, line string) {
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(r)
+		n += size
+	}
+	sb.WriteString("\r\n")
+}
+
+// escapeICS escapes the text value of an iCalendar property
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,216 @@
+/**
+Package lectionary resolves the readings appointed for a date.
+
+A reading is identified by the topic of its pericope, as computed by ldp.RelativeTopic,
+and the service it is read at, e.g. le.go.mc.d071/liturgy or le.go.eo.w03/orthros.
+
+The daily readings follow the movable cycle (le.ep.mc and le.go.mc), except that from
+the Monday after the Sunday after the Elevation of the Cross until the Triodion,
+the Gospel follows the Lukan cycle (le.go.lu).  The Lukan cycle has LukanCycleDays days of
+readings.  After Theophany, the Lukan day is counted back from the start of the Triodion,
+so that the cycle ends when the Triodion starts (the Lukan jump).  Depending on the year,
+this skips or repeats weeks of Luke.
+
+The readings of a day of the Menaion (le.ep.me, le.go.me, le.pr.me) are appointed only if
+they exist in the store.  They take priority over the daily readings as follows:
+  RuleGreatFeast:      a great feast displaces the daily readings, even on a Sunday.
+  RuleMovableAndFeast: in Holy Week and Bright Week, the readings of the Menaion are read after the daily readings.
+  RuleSundayAndFeast:  on a Sunday, the readings of the Menaion are read after the daily readings.
+  RuleFeast:           on other days, the readings of the Menaion displace the daily readings.
+If the Menaion has no readings for the day, RuleDaily applies, or, on the weekdays of
+Great Lent, when there is no Liturgy, RuleLenten.
+ */
+package lectionary
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"time"
+)
+
+// Services, which are also the keys of the readings in a lectionary topic
+const (
+	Orthros = "orthros"
+	Liturgy = "liturgy"
+	Vespers = "vespers"
+)
+
+// Kinds of readings
+const (
+	Epistle  = "epistle"
+	Gospel   = "gospel"
+	Prophecy = "prophecy"
+)
+
+// Sources of readings
+const (
+	SourceMovable  = "movable"  // the movable cycle
+	SourceLukan    = "lukan"    // the Lukan cycle
+	SourceEothinon = "eothinon" // the eleven Resurrection Gospels of Orthros
+	SourceTriodion = "triodion" // the prophecies of the Triodion
+	SourceMenaion  = "menaion"  // the fixed cycle
+)
+
+// Priority rules
+const (
+	RuleDaily           = "daily"
+	RuleLenten          = "lenten"
+	RuleGreatFeast      = "great feast"
+	RuleMovableAndFeast = "movable and feast"
+	RuleSundayAndFeast  = "sunday and feast"
+	RuleFeast           = "feast"
+)
+
+// LukanCycleDays is the number of days of readings of the Lukan cycle (le.go.lu.d001 through le.go.lu.d119)
+const LukanCycleDays = 17 * 7
+
+// GreatFeasts are the feasts of the fixed cycle that displace the daily readings, even on a Sunday, by month and day
+var GreatFeasts = map[int]map[int]bool{
+	1:  {1: true, 6: true},  // Circumcision, Theophany
+	2:  {2: true},           // Meeting of the Lord
+	3:  {25: true},          // Annunciation
+	6:  {29: true},          // Apostles Peter and Paul
+	8:  {6: true, 15: true}, // Transfiguration, Dormition
+	9:  {8: true, 14: true}, // Nativity of the Theotokos, Elevation of the Cross
+	11: {21: true},          // Entrance of the Theotokos
+	12: {25: true},          // Nativity of Christ
+}
+
+// Reading is a reading appointed for a service
+type Reading struct {
+	ID     string `json:"id"` // topic/key, where the key is the service
+	Kind   string `json:"kind"`
+	Source string `json:"source"`
+}
+
+// Readings are the readings appointed for a date, in the order they are read
+type Readings struct {
+	Date      string    `json:"date"`
+	Rule      string    `json:"rule"` // the priority rule that was applied
+	Orthros   []Reading `json:"orthros"`
+	Liturgy   []Reading `json:"liturgy"`
+	Vespers   []Reading `json:"vespers"`
+	Displaced []Reading `json:"displaced,omitempty"` // daily readings that are not read because of a feast
+}
+
+// Resolver resolves the readings for a date
+type Resolver struct {
+	store ltxstore.LtxStore
+}
+
+// NewResolver returns a resolver that reads the readings of the Menaion from the store
+func NewResolver(store ltxstore.LtxStore) *Resolver {
+	return &Resolver{store: store}
+}
+
+// Resolve returns the readings appointed for the liturgical day
+func (r *Resolver) Resolve(l *ldp.LDP) *Readings {
+	readings := &Readings{Date: l.TheDay.Format("2006-01-02"), Rule: RuleDaily}
+	d := daysSince(l.TheDay, l.PaschaDateThisYear)
+	daily := r.daily(l, d)
+	menaion := r.menaion(l)
+	switch {
+	case len(menaion.Orthros)+len(menaion.Liturgy)+len(menaion.Vespers) == 0:
+		readings.Orthros, readings.Liturgy, readings.Vespers = daily.Orthros, daily.Liturgy, daily.Vespers
+		if d >= -48 && d <= -9 && !l.IsSaturday && !l.IsSunday {
+			readings.Rule = RuleLenten
+		}
+	case d >= -6 && d <= 6: // Holy Week and Bright Week
+		readings.Rule = RuleMovableAndFeast
+		readings.Orthros = append(daily.Orthros, menaion.Orthros...)
+		readings.Liturgy = append(daily.Liturgy, menaion.Liturgy...)
+		readings.Vespers = append(daily.Vespers, menaion.Vespers...)
+	case GreatFeasts[l.MenaionMonth][l.MenaionDay]:
+		readings.Rule = RuleGreatFeast
+		readings.Orthros, readings.Liturgy, readings.Vespers = menaion.Orthros, menaion.Liturgy, menaion.Vespers
+		readings.Displaced = append(append(daily.Orthros, daily.Liturgy...), daily.Vespers...)
+	case l.IsSunday:
+		readings.Rule = RuleSundayAndFeast
+		readings.Orthros = append(daily.Orthros, menaion.Orthros...)
+		readings.Liturgy = append(daily.Liturgy, menaion.Liturgy...)
+		readings.Vespers = append(daily.Vespers, menaion.Vespers...)
+	default:
+		readings.Rule = RuleFeast
+		readings.Orthros, readings.Liturgy, readings.Vespers = menaion.Orthros, menaion.Liturgy, menaion.Vespers
+		// the prophecies of Lent are still read at Vespers
+		for _, reading := range daily.Vespers {
+			if reading.Source == SourceTriodion {
+				readings.Vespers = append([]Reading{reading}, readings.Vespers...)
+			}
+		}
+		readings.Displaced = append(daily.Orthros, daily.Liturgy...)
+	}
+	return readings
+}
+
+// daily returns the readings of the movable and Lukan cycles, where d is the number of days since Pascha
+func (r *Resolver) daily(l *ldp.LDP, d int) *Readings {
+	readings := &Readings{}
+	if l.IsSunday {
+		// the Eothina are read through the Fifth Sunday of Lent, but Palm Sunday has its own Gospel
+		if l.IsPentecostarion || d == -7 {
+			readings.Orthros = append(readings.Orthros, reading(l.RelativeTopic("le.go.mc.*", 0, 0), Orthros, Gospel, SourceMovable))
+		} else {
+			readings.Orthros = append(readings.Orthros, reading(l.RelativeTopic("le.go.eo.*", 0, 0), Orthros, Gospel, SourceEothinon))
+		}
+	}
+	if d >= -48 && d <= -9 && !l.IsSaturday && !l.IsSunday {
+		// there is no Liturgy on the weekdays of Great Lent, but there are prophecies at Vespers
+		readings.Vespers = append(readings.Vespers, reading(l.RelativeTopic("le.pr.tr.*", 0, 0), Vespers, Prophecy, SourceTriodion))
+		return readings
+	}
+	readings.Liturgy = append(readings.Liturgy, reading(l.RelativeTopic("le.ep.mc.*", 0, 0), Liturgy, Epistle, SourceMovable))
+	if day, ok := LukanDay(l); ok {
+		readings.Liturgy = append(readings.Liturgy, reading(fmt.Sprintf("le.go.lu.d%03d", day), Liturgy, Gospel, SourceLukan))
+	} else {
+		readings.Liturgy = append(readings.Liturgy, reading(l.RelativeTopic("le.go.mc.*", 0, 0), Liturgy, Gospel, SourceMovable))
+	}
+	return readings
+}
+
+// menaion returns the readings of the fixed cycle that exist in the store
+func (r *Resolver) menaion(l *ldp.LDP) *Readings {
+	readings := &Readings{}
+	add := func(service string, list *[]Reading, topic, kind string) {
+		topic = l.RelativeTopic(topic, 0, 0)
+		if r.store != nil && r.store.ExistsTK(topic, service) {
+			*list = append(*list, reading(topic, service, kind, SourceMenaion))
+		}
+	}
+	add(Orthros, &readings.Orthros, "le.go.me.*", Gospel)
+	add(Liturgy, &readings.Liturgy, "le.ep.me.*", Epistle)
+	add(Liturgy, &readings.Liturgy, "le.go.me.*", Gospel)
+	add(Vespers, &readings.Vespers, "le.pr.me.*", Prophecy)
+	return readings
+}
+
+// LukanDay returns the day of the Lukan cycle whose Gospel is read, and true,
+// or false if the Gospel of the day is not from the Lukan cycle.
+func LukanDay(l *ldp.LDP) (int, bool) {
+	if l.IsTriodion || l.IsPentecostarion || !l.StartDateOfLukanCycleLast.After(l.TriodionStartDateLast) {
+		return 0, false
+	}
+	day := l.DaysSinceStartLastLukanCycle
+	if l.MenaionMonth == 1 && l.MenaionDay > 6 || l.MenaionMonth == 2 || l.MenaionMonth == 3 {
+		// after Theophany, count back from the start of the Triodion, which falls on the last day
+		// of the cycle, the Sunday of the 17th week, so that a day of the cycle keeps its day of the week
+		day = LukanCycleDays - daysSince(l.TriodionStartDateThisYear, l.TheDay)
+	}
+	if day < 1 {
+		day = 1
+	}
+	if day > LukanCycleDays {
+		day = LukanCycleDays
+	}
+	return day, true
+}
+
+func reading(topic, service, kind, source string) Reading {
+	return Reading{ID: topic + "/" + service, Kind: kind, Source: source}
+}
+
+// daysSince returns the number of days from the date since to the date
+func daysSince(date, since time.Time) int {
+	return int(date.Sub(since).Hours() / 24)
+}
@@ -0,0 +1,94 @@
+package lectionary
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	for _, id := range []string{
+		"le.ep.me.m08.d06/liturgy", "le.go.me.m08.d06/liturgy", "le.go.me.m08.d06/orthros", "le.pr.me.m08.d06/vespers",
+		"le.ep.me.m10.d18/liturgy", "le.go.me.m10.d18/liturgy",
+		"le.ep.me.m03.d25/liturgy", "le.go.me.m03.d25/liturgy",
+	} {
+		parts := strings.Split(id, "/")
+		store.Merge(models.NewLtx("gr_gr_cog", parts[0], parts[1], "text", "", ""))
+	}
+	resolver := NewResolver(store)
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		rule             string
+		orthros          string
+		liturgy          string
+		vespers          string
+	}{
+		// Sunday during the Lukan cycle
+		{2020, 10, 11, calendarTypes.Gregorian, RuleDaily, "le.go.eo.w07/orthros", "le.ep.mc.d246/liturgy le.go.lu.d021/liturgy", ""},
+		// Monday after Pentecost, Matthew
+		{2020, 6, 8, calendarTypes.Gregorian, RuleDaily, "", "le.ep.mc.d121/liturgy le.go.mc.d121/liturgy", ""},
+		// Sunday of the Publican and the Pharisee, the first day of the Triodion
+		{2020, 2, 9, calendarTypes.Gregorian, RuleDaily, "le.go.eo.w01/orthros", "le.ep.mc.d001/liturgy le.go.mc.d001/liturgy", ""},
+		// Palm Sunday
+		{2020, 4, 12, calendarTypes.Gregorian, RuleDaily, "le.go.mc.d064/orthros", "le.ep.mc.d064/liturgy le.go.mc.d064/liturgy", ""},
+		// Wednesday of Great Lent
+		{2020, 3, 11, calendarTypes.Gregorian, RuleLenten, "", "", "le.pr.tr.d032/vespers"},
+		// Transfiguration, a great feast
+		{2020, 8, 6, calendarTypes.Gregorian, RuleGreatFeast, "le.go.me.m08.d06/orthros", "le.ep.me.m08.d06/liturgy le.go.me.m08.d06/liturgy", "le.pr.me.m08.d06/vespers"},
+		// Transfiguration on the Old calendar
+		{2020, 8, 19, calendarTypes.Julian, RuleGreatFeast, "le.go.me.m08.d06/orthros", "le.ep.me.m08.d06/liturgy le.go.me.m08.d06/liturgy", "le.pr.me.m08.d06/vespers"},
+		// Apostle Luke on a Sunday
+		{2020, 10, 18, calendarTypes.Gregorian, RuleSundayAndFeast, "le.go.eo.w08/orthros", "le.ep.mc.d253/liturgy le.go.lu.d028/liturgy le.ep.me.m10.d18/liturgy le.go.me.m10.d18/liturgy", ""},
+		// Apostle Luke on a Monday
+		{2021, 10, 18, calendarTypes.Gregorian, RuleFeast, "", "le.ep.me.m10.d18/liturgy le.go.me.m10.d18/liturgy", ""},
+		// Annunciation on a Wednesday of Great Lent
+		{2020, 3, 25, calendarTypes.Gregorian, RuleGreatFeast, "", "le.ep.me.m03.d25/liturgy le.go.me.m03.d25/liturgy", ""},
+	}
+	for _, d := range data {
+		l, err := ldp.NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readings := resolver.Resolve(&l)
+		if readings.Rule != d.rule {
+			t.Errorf("%s: expected rule %s, got %s", readings.Date, d.rule, readings.Rule)
+		}
+		for _, s := range []struct {
+			service  string
+			expected string
+			got      []Reading
+		}{{Orthros, d.orthros, readings.Orthros}, {Liturgy, d.liturgy, readings.Liturgy}, {Vespers, d.vespers, readings.Vespers}} {
+			var ids []string
+			for _, r := range s.got {
+				ids = append(ids, r.ID)
+			}
+			if got := strings.Join(ids, " "); got != s.expected {
+				t.Errorf("%s %s: expected '%s', got '%s'", readings.Date, s.service, s.expected, got)
+			}
+		}
+	}
+}
+
+func TestLukanDay(t *testing.T) {
+	// the Lukan cycle ends the day before the Triodion starts, February 9, 2020,
+	// on the Saturday of the 17th week
+	l, err := ldp.NewLDPYMD(2020, 2, 8, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if day, ok := LukanDay(&l); !ok || day != LukanCycleDays-1 {
+		t.Errorf("expected day %d, got %d", LukanCycleDays-1, day)
+	}
+	l, err = ldp.NewLDPYMD(2020, 2, 9, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LukanDay(&l); ok {
+		t.Errorf("expected the Triodion to end the Lukan cycle")
+	}
+}
@@ -0,0 +1,210 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// The parts of the Language Server Protocol used by the server.
+// See https://microsoft.github.io/language-server-protocol/specification
+
+// Error codes of JSON-RPC
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// Severities of diagnostics
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Kinds of completion items
+const (
+	CompletionKindFile   = 17
+	CompletionKindModule = 9
+	CompletionKindText   = 1
+)
+
+// request is a request or a notification from the client.  A notification has no ID.
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   responseError    `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Position is zero based.  The character is the offset in the line.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type TextDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// DidChangeTextDocumentParams has the full text of the document in each change, since the server syncs full documents
+type DidChangeTextDocumentParams struct {
+	TextDocument   TextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// TextDocumentPositionParams are the params of completion, hover, and definition
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type CompletionItem struct {
+	Label    string    `json:"label"`
+	Kind     int       `json:"kind,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	TextEdit *TextEdit `json:"textEdit,omitempty"`
+}
+
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// maxContentLength is the length of the largest message that is read, far more than that of any template
+const maxContentLength = 16 << 20
+
+// headerError is returned by readMessage for a header that is not valid.
+// The server replies with a parse error and reads the next message.
+type headerError struct {
+	message string
+}
+
+func (e *headerError) Error() string {
+	return e.message
+}
+
+// readMessage reads the next message, which has a header with its Content-Length, a blank line, and the content.
+// The content of a message longer than maxContentLength is skipped, and a headerError returned.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if _, ok := err.(textproto.ProtocolError); ok {
+			return nil, &headerError{err.Error()}
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil {
+		return nil, &headerError{fmt.Sprintf("invalid Content-Length: %v", err)}
+	}
+	if length < 0 {
+		return nil, &headerError{fmt.Sprintf("invalid Content-Length: %d", length)}
+	}
+	if length > maxContentLength {
+		if _, err = io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+			return nil, err
+		}
+		return nil, &headerError{fmt.Sprintf("Content-Length %d is more than %d", length, maxContentLength)}
+	}
+	content := make([]byte, length)
+	if _, err = io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeMessage writes v as JSON with a header of its Content-Length
+func writeMessage(w io.Writer, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
@@ -0,0 +1,529 @@
+/**
+Package lsp provides a language server for LML templates, which an editor runs as doxago lsp,
+and talks to using the Language Server Protocol over stdin and stdout.
+
+The server provides:
+  diagnostics, the errors and warnings found by validating a template when it is opened or changed,
+    including those in the templates it inserts
+  completion of the topic and key of a sid or rid from the database, and of the ID of an insert from the templates directory
+  hover, showing the text of a sid or rid in each library, with redirects resolved
+  definition, the file of the template of an insert
+
+The server syncs full documents, and handles the requests one at a time.
+ */
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/parser"
+	lml "gitlab.com/ocmc/liturgiko/lml-go/parser"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Source is the source of the diagnostics
+const Source = "doxago"
+
+// Server is a language server for LML templates
+type Server struct {
+	store        ltxstore.LtxStore
+	templatesDir string
+	documents    map[string]string // the text of the open documents, by URI
+	out          io.Writer
+}
+
+// NewServer returns a server that reads liturgical texts from the store, and inserted templates from the templates directory
+func NewServer(store ltxstore.LtxStore, templatesDir string) *Server {
+	s := new(Server)
+	s.store = store
+	s.templatesDir = templatesDir
+	s.documents = make(map[string]string)
+	return s
+}
+
+// Serve reads requests from in and writes responses and notifications to out until the client sends exit,
+// or in is closed
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		content, err := readMessage(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if _, ok := err.(*headerError); ok {
+				if err = s.replyError(nil, codeParseError, err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		var req request
+		if err = json.Unmarshal(content, &req); err != nil {
+			if err = s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err = s.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches the request to the method that handles it.  The error is that of writing the response.
+// A panic while handling the request is replied to as an internal error, so that one bad document
+// does not stop the server.
+func (s *Server) handle(req *request) (err error) {
+	defer func() {
+		if r := recover(); r != nil && req.ID != nil {
+			err = s.replyError(req.ID, codeInternalError, fmt.Sprintf("%s: %v", req.Method, r))
+		}
+	}()
+	switch req.Method {
+	case "initialize":
+		return s.reply(req.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full documents
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"\"", "/"}},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "doxago"},
+		})
+	case "shutdown":
+		return s.reply(req.ID, nil)
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(req.Params, &params) != nil {
+			return nil
+		}
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		return s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(req.Params, &params) != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(req.Params, &params) != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req.ID, codeInvalidParams, err.Error())
+		}
+		switch req.Method {
+		case "textDocument/completion":
+			return s.reply(req.ID, s.Completion(params.TextDocument.URI, params.Position))
+		case "textDocument/hover":
+			return s.reply(req.ID, s.Hover(params.TextDocument.URI, params.Position))
+		default:
+			return s.reply(req.ID, s.Definition(params.TextDocument.URI, params.Position))
+		}
+	}
+	if req.ID == nil { // a notification the server does not handle, e.g. initialized
+		return nil
+	}
+	return s.replyError(req.ID, codeMethodNotFound, fmt.Sprintf("method %s not found", req.Method))
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}) error {
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// publishDiagnostics parses the document and sends its errors to the client
+func (s *Server) publishDiagnostics(uri string) error {
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: s.Diagnostics(uri)})
+}
+
+// Diagnostics returns the errors and warnings found by validating the document.  An error in an inserted template
+// is reported at the start of the document, with the ID of the template and the line and column in it.
+func (s *Server) Diagnostics(uri string) []Diagnostic {
+	text := s.documents[uri]
+	id := s.templateID(uri)
+	l := s.parse(id, text)
+	lines := strings.Split(text, "\n")
+	diagnostics := []Diagnostic{}
+	for _, e := range l.Validate() {
+		d := Diagnostic{Severity: SeverityError, Code: e.Code, Source: Source, Message: e.Message}
+		if e.Severity == parser.SeverityWarning {
+			d.Severity = SeverityWarning
+		}
+		if e.TemplateID == id {
+			d.Range = wordRange(lines, e.Line-1, e.Column)
+		} else {
+			d.Message = e.StringVerbose()
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// Completion returns the topics or keys, or the IDs of templates, that complete the string being typed
+// after sid, rid, or insert
+func (s *Server) Completion(uri string, pos Position) CompletionList {
+	list := CompletionList{Items: []CompletionItem{}}
+	line := lineAt(s.documents[uri], pos.Line)
+	if pos.Character > utf16Column(line, len(line)) {
+		return list
+	}
+	before := line[:byteOffset(line, pos.Character)]
+	quote := strings.LastIndex(before, "\"")
+	if quote < 0 || strings.Count(before, "\"")%2 == 0 {
+		return list // not in a string
+	}
+	fields := strings.Fields(before[:quote])
+	if len(fields) == 0 {
+		return list
+	}
+	prefix := before[quote+1:]
+	edit := Range{Start: Position{pos.Line, utf16Column(line, quote+1)}, End: pos}
+	add := func(label, text string, kind int) {
+		if strings.HasPrefix(text, prefix) {
+			list.Items = append(list.Items, CompletionItem{Label: label, Kind: kind, TextEdit: &TextEdit{Range: edit, NewText: text}})
+		}
+	}
+	switch fields[len(fields)-1] {
+	case "sid", "rid":
+		if slash := strings.Index(prefix, "/"); slash < 0 {
+			topics, _ := s.store.Topics("")
+			for _, topic := range topics {
+				add(topic, topic+"/", CompletionKindModule)
+			}
+		} else {
+			topic := prefix[:slash]
+			like := topic
+			if fields[len(fields)-1] == "rid" && strings.HasSuffix(topic, "*") && ldp.CheckTopic(topic) == nil {
+				var dated bool
+				if like, dated = s.relativeTopic(uri, topic, 0, 0); !dated {
+					like = strings.TrimSuffix(topic, "*") + "%" // the keys of the topic on any day
+				}
+			}
+			delimiter := s.store.IDDelimiter()
+			keys, _ := s.store.Keys("%" + delimiter + like + delimiter)
+			for _, key := range keys {
+				add(key, topic+"/"+key, CompletionKindText)
+			}
+		}
+	case "insert":
+		for _, id := range s.templateIDs() {
+			add(id, id, CompletionKindFile)
+		}
+	}
+	return list
+}
+
+// Hover returns the text in each library of the sid or rid at the position,
+// or the file of the template of an insert, or nil
+func (s *Server) Hover(uri string, pos Position) *Hover {
+	tokens := s.tokens(uri)
+	i := tokenAt(tokens, s.documents[uri], pos)
+	if i < 1 {
+		return nil
+	}
+	token := tokens[i]
+	id, err := strconv.Unquote(token.GetText())
+	if err != nil {
+		return nil
+	}
+	var value string
+	switch tokens[i-1].GetText() {
+	case "sid", "rid":
+		parts := strings.Split(id, "/")
+		if len(parts) != 2 {
+			return nil
+		}
+		topic := parts[0]
+		if err = ldp.CheckTopic(topic); err != nil {
+			value = err.Error()
+			break
+		}
+		if tokens[i-1].GetText() == "rid" {
+			mode, day := overrides(tokens[i+1:])
+			var dated bool
+			if topic, dated = s.relativeTopic(uri, topic, mode, day); !dated {
+				value = fmt.Sprintf("%s is relative to the liturgical day, and the template has no Month and Day", parts[0])
+				break
+			}
+		}
+		value = s.texts(topic, parts[1])
+	case "insert":
+		if path := s.templatePath(id); fileExists(path) {
+			value = path
+		} else {
+			value = fmt.Sprintf("%s not found", path)
+		}
+	default:
+		return nil
+	}
+	r := tokenRange(token, s.documents[uri])
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// Definition returns the location of the file of the template of the insert at the position, or nil
+func (s *Server) Definition(uri string, pos Position) *Location {
+	tokens := s.tokens(uri)
+	i := tokenAt(tokens, s.documents[uri], pos)
+	if i < 1 || tokens[i-1].GetText() != "insert" {
+		return nil
+	}
+	id, err := strconv.Unquote(tokens[i].GetText())
+	if err != nil {
+		return nil
+	}
+	path := s.templatePath(id)
+	if !fileExists(path) {
+		return nil
+	}
+	return &Location{URI: pathToURI(path)}
+}
+
+// relativeTopic returns the topic of a rid resolved with the liturgical day properties of the document,
+// and whether the document has a date to resolve it with
+func (s *Server) relativeTopic(uri, topic string, mode, day int) (string, bool) {
+	l := s.parse(s.templateID(uri), s.documents[uri])
+	l.WalkTemplate()
+	if l.Listener.ALT.LDP.TheDay.IsZero() {
+		return topic, false
+	}
+	return l.Listener.ALT.LDP.RelativeTopic(topic, mode, day), true
+}
+
+// texts returns the value of the topic and key in each library, one per line
+func (s *Server) texts(topic, key string) string {
+	records, err := s.store.ReadByTK(topic, key, true)
+	if err != nil {
+		return err.Error()
+	}
+	if len(records) == 0 {
+		return fmt.Sprintf("%s/%s not found", topic, key)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Library < records[j].Library })
+	var sb strings.Builder
+	for _, record := range records {
+		value := record.Value
+		if len(record.Redirect) > 0 {
+			if to, _, err := ltxstore.Resolve(s.store, record.ID); err == nil {
+				value = to.Value
+			} else {
+				value = err.Error()
+			}
+		}
+		sb.WriteString(fmt.Sprintf("**%s** %s  \n", record.Library, value))
+	}
+	return sb.String()
+}
+
+// parse returns a parser for the text, whose inserts are read from the templates directory
+func (s *Server) parse(id, text string) *parser.LML {
+	l := parser.NewLMLParserWithStore(id, text, s.store)
+	l.Listener.Templates = parser.TemplateDir(s.templatesDir)
+	return l
+}
+
+// tokens returns the tokens of the document, without those of the hidden channel
+func (s *Server) tokens(uri string) []antlr.Token {
+	var tokens []antlr.Token
+	for _, t := range s.parse(s.templateID(uri), s.documents[uri]).Tokens() {
+		if t.GetChannel() == antlr.TokenDefaultChannel {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// templateID returns the ID of the template of the document, its path in the templates directory
+// without the extension, or if it is not in the directory, its file name without the extension
+func (s *Server) templateID(uri string) string {
+	path := uriToPath(uri)
+	if rel, err := filepath.Rel(s.templatesDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	} else {
+		path = filepath.Base(path)
+	}
+	return strings.TrimSuffix(filepath.ToSlash(path), parser.Extension)
+}
+
+func (s *Server) templatePath(id string) string {
+	return filepath.Join(s.templatesDir, filepath.FromSlash(id)+parser.Extension)
+}
+
+// templateIDs returns the IDs of the templates in the templates directory, sorted
+func (s *Server) templateIDs() []string {
+	var ids []string
+	filepath.Walk(s.templatesDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, parser.Extension) {
+			if rel, err := filepath.Rel(s.templatesDir, path); err == nil {
+				ids = append(ids, strings.TrimSuffix(filepath.ToSlash(rel), parser.Extension))
+			}
+		}
+		return nil
+	})
+	sort.Strings(ids)
+	return ids
+}
+
+// tokenAt returns the index of the string token at the position in the text, or -1
+func tokenAt(tokens []antlr.Token, text string, pos Position) int {
+	line := lineAt(text, pos.Line)
+	column := utf8.RuneCountInString(line[:byteOffset(line, pos.Character)])
+	for i, t := range tokens {
+		if t.GetTokenType() != lml.LMLLexerSTRING || t.GetLine()-1 != pos.Line {
+			continue
+		}
+		if column >= t.GetColumn() && column <= t.GetColumn()+utf8.RuneCountInString(t.GetText()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// overrides returns the values of the @Mode and @Day that follow a rid
+func overrides(tokens []antlr.Token) (mode, day int) {
+	for i := 0; i+1 < len(tokens); i += 2 {
+		n, err := strconv.Atoi(tokens[i+1].GetText())
+		if err != nil {
+			return
+		}
+		switch tokens[i].GetText() {
+		case "@Mode":
+			mode = n
+		case "@Day":
+			day = n
+		default:
+			return
+		}
+	}
+	return
+}
+
+// tokenRange returns the range of the token, which is on one line of the text
+func tokenRange(t antlr.Token, text string) Range {
+	line := lineAt(text, t.GetLine()-1)
+	start := runeOffset(line, t.GetColumn())
+	end := start + len(t.GetText())
+	if end > len(line) {
+		end = len(line)
+	}
+	return Range{Start: Position{t.GetLine() - 1, utf16Column(line, start)}, End: Position{t.GetLine() - 1, utf16Column(line, end)}}
+}
+
+// wordRange returns the range from the column, in runes, to the end of the word there
+func wordRange(lines []string, line, column int) Range {
+	if line < 0 || line >= len(lines) {
+		return Range{Start: Position{line, column}, End: Position{line, column}}
+	}
+	text := strings.TrimSuffix(lines[line], "\r")
+	start := runeOffset(text, column)
+	end := start
+	if end < len(text) {
+		end = start + 1
+		for end < len(text) && !strings.ContainsRune(" \t", rune(text[end])) {
+			end++
+		}
+	}
+	return Range{Start: Position{line, utf16Column(text, start)}, End: Position{line, utf16Column(text, end)}}
+}
+
+// The character of a Position is in UTF-16 code units, and the column of an antlr token is in runes.
+// runeOffset, byteOffset, and utf16Column convert them to and from byte offsets in a line.
+
+// runeOffset returns the byte offset of the column in runes
+func runeOffset(line string, column int) int {
+	for offset := range line {
+		if column == 0 {
+			return offset
+		}
+		column--
+	}
+	return len(line)
+}
+
+// byteOffset returns the byte offset of the character in UTF-16 code units
+func byteOffset(line string, character int) int {
+	n := 0
+	for offset, r := range line {
+		if n >= character {
+			return offset
+		}
+		n += utf16Len(r)
+	}
+	return len(line)
+}
+
+// utf16Column returns the character in UTF-16 code units of the byte offset
+func utf16Column(line string, offset int) int {
+	n := 0
+	for _, r := range line[:offset] {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// utf16Len returns the number of UTF-16 code units of the rune
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func lineAt(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line], "\r")
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,295 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type message struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// serve has the server handle the messages of in, and returns the messages it writes
+func serve(t *testing.T, s *Server, in *bytes.Buffer) []message {
+	var out bytes.Buffer
+	if err := s.Serve(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	var messages []message
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var m message
+		if err = json.Unmarshal(content, &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestServe(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "Ιερεύς", "", ""))
+	store.Merge(models.NewLtx("en_us_goa", "actors", "Priest", "Priest", "", ""))
+	store.Merge(models.NewLtx("en_us_dedes", "actors", "Priest", "", "", "en_us_goa/actors/Priest"))
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "People", "Λαός", "", ""))
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.MkdirAll(filepath.Join(dir, "blocks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	amen := filepath.Join(dir, "blocks", "amen.lml")
+	if err = ioutil.WriteFile(amen, []byte("ID = \"blocks/amen\"\nType = \"block\"\nStatus = \"draft\"\n{ p.amen sid \"actors/People\" }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathToURI(filepath.Join(dir, "a", "b.lml"))
+	text := "ID = \"a/b\"\nType = \"service\"\nStatus = \"draft\"\nMonth = 4\nDay = 7\nYear = 2021\n{\n" +
+		"p.actor sid \"actors/Priest\"\n" +
+		"p.actor sid \"actors/Deacon\"\n" +
+		"insert \"blocks/amen\"\n" +
+		"p.actor sid \"actors/P\n" +
+		"}"
+	position := func(method string, id, line, character int) map[string]interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     map[string]int{"line": line, "character": character},
+		}}
+	}
+	var in bytes.Buffer
+	for _, m := range []interface{}{
+		map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "initialized", "params": map[string]interface{}{}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "languageId": "lml", "text": text},
+		}},
+		position("textDocument/completion", 2, 10, 21),
+		position("textDocument/hover", 3, 7, 16),
+		position("textDocument/definition", 4, 9, 10),
+		map[string]interface{}{"jsonrpc": "2.0", "id": 5, "method": "shutdown"},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "exit"},
+	} {
+		if err = writeMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := serve(t, NewServer(store, dir), &in)
+	if len(messages) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(messages))
+	}
+	if !strings.Contains(string(messages[0].Result), `"hoverProvider":true`) {
+		t.Errorf("unexpected capabilities %s", messages[0].Result)
+	}
+
+	var diagnostics PublishDiagnosticsParams
+	if err = json.Unmarshal(messages[1].Params, &diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range diagnostics.Diagnostics {
+		if strings.Contains(d.Message, "actors/Deacon") {
+			found = true
+			if d.Range.Start != (Position{8, 12}) {
+				t.Errorf("expected the error for actors/Deacon at 8:12, got %v", d.Range.Start)
+			}
+		}
+	}
+	if messages[1].Method != "textDocument/publishDiagnostics" || !found {
+		t.Errorf("expected a diagnostic for actors/Deacon, got %s", messages[1].Params)
+	}
+
+	var completion CompletionList
+	if err = json.Unmarshal(messages[2].Result, &completion); err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, item := range completion.Items {
+		labels = append(labels, item.Label)
+	}
+	if strings.Join(labels, " ") != "People Priest" || completion.Items[0].TextEdit.NewText != "actors/People" {
+		t.Errorf("expected completions People Priest, got %s", messages[2].Result)
+	}
+
+	var hover Hover
+	if err = json.Unmarshal(messages[3].Result, &hover); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"**en_us_dedes** Priest", "**en_us_goa** Priest", "**gr_gr_cog** Ιερεύς"} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("expected hover to contain %s, got %s", expected, hover.Contents.Value)
+		}
+	}
+
+	var location Location
+	if err = json.Unmarshal(messages[4].Result, &location); err != nil {
+		t.Fatal(err)
+	}
+	if location.URI != pathToURI(amen) {
+		t.Errorf("expected definition %s, got %s", pathToURI(amen), messages[4].Result)
+	}
+	if messages[5].ID != 5 || string(messages[5].Result) != "null" {
+		t.Errorf("expected a null result for shutdown, got %s", messages[5].Result)
+	}
+}
+
+func TestServeBadHeaders(t *testing.T) {
+	var in bytes.Buffer
+	in.WriteString("Content-Length: -1\r\n\r\n")
+	in.WriteString("Content-Length: x\r\n\r\n")
+	in.WriteString(fmt.Sprintf("Content-Length: %d\r\n\r\n", maxContentLength+1))
+	in.Write(make([]byte, maxContentLength+1))
+	if err := writeMessage(&in, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "shutdown"}); err != nil {
+		t.Fatal(err)
+	}
+	messages := serve(t, NewServer(ltx2mem.NewLtxMapper(), ""), &in)
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(messages))
+	}
+	for _, m := range messages[:3] {
+		if m.Error == nil || m.Error.Code != codeParseError {
+			t.Errorf("expected a parse error, got %+v", m)
+		}
+	}
+	if messages[3].ID != 1 || string(messages[3].Result) != "null" {
+		t.Errorf("expected a null result for shutdown, got %+v", messages[3])
+	}
+}
+
+// panicStore panics when its topics are read
+type panicStore struct {
+	ltxstore.LtxStore
+}
+
+func (s panicStore) Topics(like string) ([]string, error) {
+	panic("topics")
+}
+
+func TestServeRecovers(t *testing.T) {
+	uri := "file:///templates/a/b.lml"
+	text := "ID = \"a/b\"\nType = \"block\"\nStatus = \"draft\"\n{\np.a rid \"le.*/x\"\np.b sid \"\n}"
+	position := func(method string, id, line, character int) map[string]interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     map[string]int{"line": line, "character": character},
+		}}
+	}
+	var in bytes.Buffer
+	for _, m := range []interface{}{
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "languageId": "lml", "text": text},
+		}},
+		position("textDocument/hover", 1, 4, 10),
+		position("textDocument/completion", 2, 5, 9),
+		map[string]interface{}{"jsonrpc": "2.0", "id": 3, "method": "shutdown"},
+	} {
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := serve(t, NewServer(panicStore{ltx2mem.NewLtxMapper()}, ""), &in)
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(messages))
+	}
+	var hover Hover
+	if err := json.Unmarshal(messages[1].Result, &hover); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(hover.Contents.Value, "le.book.part") {
+		t.Errorf("expected hover to report the topic of the lectionary, got %s", messages[1].Result)
+	}
+	if messages[2].ID != 2 || messages[2].Error == nil || messages[2].Error.Code != codeInternalError {
+		t.Errorf("expected an internal error for the completion, got %+v", messages[2])
+	}
+	if messages[3].ID != 3 {
+		t.Errorf("expected the server to reply to shutdown, got %+v", messages[3])
+	}
+}
+
+func TestPositions(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "Ιερεύς", "", ""))
+	s := NewServer(store, "")
+	uri := "file:///templates/a/b.lml"
+	// Λαός is 4 runes of 2 bytes, and 𝔸 is 1 rune of 4 bytes and 2 UTF-16 code units,
+	// so the string "actors/Deacon" starts at rune 21, byte 28, and UTF-16 character 22 of its line
+	s.documents[uri] = "ID = \"a/b\"\nType = \"block\"\nStatus = \"draft\"\n{\n" +
+		"/* Λαός 𝔸 */ p.a sid \"actors/Deacon\"\n" +
+		"/* Λαός 𝔸 */ p.b sid \"actors/Pr\n" +
+		"}"
+	found := false
+	for _, d := range s.Diagnostics(uri) {
+		if strings.Contains(d.Message, "actors/Deacon") {
+			found = true
+			if d.Range != (Range{Position{4, 22}, Position{4, 37}}) {
+				t.Errorf("expected the error for actors/Deacon at 4:22-4:37, got %v", d.Range)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected a diagnostic for actors/Deacon")
+	}
+	completion := s.Completion(uri, Position{5, 32})
+	if len(completion.Items) != 1 || completion.Items[0].TextEdit.Range != (Range{Position{5, 23}, Position{5, 32}}) {
+		t.Errorf("expected the completion of actors/Priest from 5:23 to 5:32, got %+v", completion.Items)
+	}
+	hover := s.Hover(uri, Position{4, 30})
+	if hover == nil || *hover.Range != (Range{Position{4, 22}, Position{4, 37}}) {
+		t.Errorf("expected a hover from 4:22 to 4:37, got %+v", hover)
+	}
+}
+
+func TestRidCompletion(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	l, err := ldp.NewLDPYMD(2021, 4, 7, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Merge(models.NewLtx("gr_gr_cog", l.RelativeTopic("me.*", 0, 0), "meVE.Apolytikion", "Ἀπολυτίκιον", "", ""))
+	store.Merge(models.NewLtx("gr_gr_cog", "me.m01.d01", "meVE.Kontakion", "Κοντάκιον", "", ""))
+	s := NewServer(store, "")
+	header := "ID = \"a/b\"\nType = \"block\"\nStatus = \"draft\"\n"
+	data := []struct {
+		properties string
+		expected   string
+	}{
+		{"Month = 4\nDay = 7\nYear = 2021\n", "meVE.Apolytikion"},
+		{"", "meVE.Apolytikion meVE.Kontakion"},
+	}
+	for _, d := range data {
+		uri := "file:///templates/a/b.lml"
+		s.documents[uri] = header + d.properties + "{\np.a rid \"me.*/\n}"
+		line := strings.Count(header+d.properties, "\n") + 1
+		var labels []string
+		for _, item := range s.Completion(uri, Position{line, 14}).Items {
+			labels = append(labels, item.Label)
+			if !strings.HasPrefix(item.TextEdit.NewText, "me.*/") {
+				t.Errorf("expected the completion to keep the relative topic, got %s", item.TextEdit.NewText)
+			}
+		}
+		if strings.Join(labels, " ") != d.expected {
+			t.Errorf("%q: expected keys %s, got %v", d.properties, d.expected, labels)
+		}
+	}
+}
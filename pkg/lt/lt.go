@@ -8,12 +8,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
-	"github.com/jmoiron/sqlx"
+	"github.com/liturgiko/doxa/pkg/commemorations"
 	"github.com/liturgiko/doxa/pkg/css"
+	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
 	"github.com/liturgiko/doxa/pkg/ldp"
 	"github.com/liturgiko/doxa/pkg/models"
+	"github.com/liturgiko/doxa/pkg/periods"
+	"github.com/liturgiko/doxa/pkg/typikon"
 	"github.com/liturgiko/doxa/pkg/utils/ltfile"
 	"html/template"
 	"log"
@@ -23,16 +26,13 @@ import (
 	"strings"
 )
 
-var TemplateDir string
-var doc *template.Template
-
 type docProps struct {
-	Ldp   ldp.LDP
-	error string
+	Ldp       ldp.LDP       // the liturgical day properties, with the overrides applied
+	computed  ldp.LDP       // the liturgical day properties computed for the date
+	overrides ldp.Overrides // set by the template
+	error     string
 }
 
-var DocProps docProps
-
 type Span struct {
 	Class string
 	Id    string
@@ -64,11 +64,28 @@ type Data struct {
 	Rows  []Row
 }
 
-var Table Data
-
-type Command string
+// Generator holds the state of the generation of a document from a template.
+// Its methods are the commands used in liturgical templates.
+// Each generation has its own Generator, so documents can be generated by concurrent goroutines.
+type Generator struct {
+	Store       ltxstore.LtxStore // the store used to read liturgical texts
+	Domains     []string          // the domains (libraries) to generate for, one column each
+	TemplateDir string            // the directory of templates that can be inserted
+	Table       Data              // the rows generated so far
+	DocProps    docProps
+	// stores the Ltx records that have already been retrieved from the database so we do not do another call to the db.
+	retrieved map[string]models.Ltx
+}
 
-var Domains []string
+// NewGenerator returns a Generator that reads from the store and generates for the domains
+func NewGenerator(store ltxstore.LtxStore, templateDir string, domains []string) *Generator {
+	g := new(Generator)
+	g.Store = store
+	g.TemplateDir = templateDir
+	g.Domains = domains
+	g.retrieved = make(map[string]models.Ltx)
+	return g
+}
 
 // The following commands are used in liturgical templates to set properties for the
 // document to be generated.
@@ -76,7 +93,8 @@ var Domains []string
 // Sets the date for the generation of a document.
 // If the values are all equal to zero, the date is set to today's date.
 // If the year is 0 and month and day are > 0, the current year is used.
-func (p Command) SetDate(year, month, day int) {
+// Overrides set by the template are kept.
+func (p *Generator) SetDate(year, month, day int) {
 	var theLdp ldp.LDP
 	var err error
 	if year == 0 && month == 0 && day == 0 {
@@ -90,23 +108,24 @@ func (p Command) SetDate(year, month, day int) {
 			err = errors.New("year must be 0 or > 1583, month > 0, and day > 0")
 		}
 	}
-	DocProps.Ldp = theLdp
+	p.DocProps.computed = theLdp
+	p.DocProps.Ldp = theLdp.WithOverrides(p.DocProps.overrides)
 	if err != nil {
-		DocProps.error = err.Error()
+		p.DocProps.error = err.Error()
 	} else {
-		DocProps.error = ""
+		p.DocProps.error = ""
 	}
 }
 
 // This is the generic version of template commands used to format liturgical texts.
-func (p Command) Generic(class string, a []string, f []css.SpanCss) string {
+func (p *Generator) Generic(class string, a []string, f []css.SpanCss) string {
 	var row Row
-	for d, domain := range Domains {
+	for d, domain := range p.Domains {
 		var sb strings.Builder
 		var cell Cell
 		cell.Class = class
 		cell.Parentheses = strings.HasSuffix(class, "P")
-		switch len(Domains) {
+		switch len(p.Domains) {
 		case 1:
 			cell.Col = LEFT
 		case 2:
@@ -135,11 +154,10 @@ func (p Command) Generic(class string, a []string, f []css.SpanCss) string {
 			}
 			id := domain + "~" + tk
 			hasError := false
-			ltx, err := GetRecord(id)
+			ltx, err := p.GetRecord(id)
 			if err != nil {
 				hasError = true
-				msg := err.Error()
-				if strings.HasPrefix(msg, "sql: no rows") {
+				if err == ltxstore.ErrNotFound {
 					ltx.Value = fmt.Sprintf("No record exists in database for ID %s.", id)
 				} else {
 					ltx.Value = fmt.Sprintf("Bad ID %s. %s", id, err.Error())
@@ -166,14 +184,14 @@ func (p Command) Generic(class string, a []string, f []css.SpanCss) string {
 		}
 		row.Cells = append(row.Cells, cell)
 	}
-	Table.Rows = append(Table.Rows, row)
+	p.Table.Rows = append(p.Table.Rows, row)
 	// we have to return a string in order to make this work
 	// but an empty string will do the trick.
 	return ""
 }
 
 // Liturgical template command for Actor
-func (p Command) Actor(a ...string) string {
+func (p *Generator) Actor(a ...string) string {
 	// TODO: this should only accept a single parameter.
 	// But, we can't change the call signature since it attaches to Command.
 	fmtArray := css.NewCssSpanArray(len(a))
@@ -181,19 +199,19 @@ func (p Command) Actor(a ...string) string {
 	return p.Generic("Actor", a, fmtArray)
 }
 // Liturgical template command for ActorDialog
-func (p Command) ActorDialog(a ...string) string {
+func (p *Generator) ActorDialog(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	fmtArray[0].Set(css.RED, css.NORMALStyle, css.NORMALWeight)
 	return p.Generic("ActorDialog", a, fmtArray)
 }
 // Liturgical template command for ActorRubric
-func (p Command) ActorRubric(a ...string) string {
+func (p *Generator) ActorRubric(a ...string) string {
 	fmtArray := css.NewCssSpanArrayCSW(len(a), css.RED, css.NORMALStyle, css.NORMALWeight)
 	fmtArray[0].Set(css.BLACK, css.NORMALStyle, css.NORMALWeight)
 	return p.Generic("ActorRubric", a, fmtArray)
 }
 // Liturgical template command for Designation
-func (p Command) Designation(a ...string) string {
+func (p *Generator) Designation(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	for i := 0; i < len(a); i++ {
 		fmtArray[i].Set(css.RED, css.ITALIC, css.NORMALWeight)
@@ -201,106 +219,203 @@ func (p Command) Designation(a ...string) string {
 	return p.Generic("Designation", a, fmtArray)
 }
 // Liturgical template command for Dialog
-func (p Command) Dialog(a ...string) string {
+func (p *Generator) Dialog(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Dialog", a, fmtArray)
 }
 
 // Liturgical template command for DialogP
-func (p Command) DialogP(a ...string) string {
+func (p *Generator) DialogP(a ...string) string {
 	fmtArray := css.NewCssSpanArrayStyle(len(a), css.ITALIC)
 	return p.Generic("DialogP", a, fmtArray)
 }
 
 // Liturgical template command for Heirmos
-func (p Command) Heirmos(a ...string) string {
+func (p *Generator) Heirmos(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Heirmos", a, fmtArray)
 }
 // Liturgical template command for Hymn
-func (p Command) Hymn(a ...string) string {
+func (p *Generator) Hymn(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Hymn", a, fmtArray)
 }
 // Liturgical template command for HymnLastLine
-func (p Command) HymnLastLine(a ...string) string {
+func (p *Generator) HymnLastLine(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("HymnLastLine", a, fmtArray)
 }
 // Liturgical template command for Inaudible
-func (p Command) Inaudible(a ...string) string {
+func (p *Generator) Inaudible(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Inaudible", a, fmtArray)
 }
 // Liturgical template command to Insert another template
-func (p Command) Insert(a ...string) string {
-	tmpl, err := template.ParseFiles(TemplateDir + "/" + a[0] + ".gohtml")
+func (p *Generator) Insert(a ...string) string {
+	tmpl, err := template.ParseFiles(p.TemplateDir + "/" + a[0] + ".gohtml")
 	if err != nil {
 		log.Fatalf("Parse: %v", err)
 	}
 	var rows bytes.Buffer
-	tmpl.Execute(&rows, Command("insert"))
+	tmpl.Execute(&rows, p)
 	return ""
 }
 // Liturgical template command for Melody
-func (p Command) Melody(a ...string) string {
+func (p *Generator) Melody(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Melody", a, fmtArray)
 }
 // Liturgical template command for Mixed
-func (p Command) Mixed(a ...string) string {
+func (p *Generator) Mixed(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Mixed", a, fmtArray)
 }
 // Liturgical template command for Mode
-func (p Command) Mode(a ...string) string {
+func (p *Generator) Mode(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Mode", a, fmtArray)
 }
 // Liturgical template command for Reading
-func (p Command) Reading(a ...string) string {
+func (p *Generator) Reading(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Reading", a, fmtArray)
 }
 // Liturgical template command for Rubric
-func (p Command) Rubric(a ...string) string {
+func (p *Generator) Rubric(a ...string) string {
 	fmtArray := css.NewCssSpanArrayCSW(len(a), css.RED, css.NORMALStyle, css.NORMALWeight)
 	return p.Generic("Reading", a, fmtArray)
 }
 // Liturgical template command for Title
-func (p Command) Title(a ...string) string {
+func (p *Generator) Title(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Title", a, fmtArray)
 }
 // Liturgical template command for Verse
-func (p Command) Verse(a ...string) string {
+func (p *Generator) Verse(a ...string) string {
 	fmtArray := css.NewCssSpanArray(len(a))
 	return p.Generic("Verse", a, fmtArray)
 }
 
 // Liturgical template command to temporarily override
-// the movable cycle day.
-func (p Command) SetMCDay(d int) {
-	DocProps.Ldp.OverrideMovableCycleDay(d)
+// the movable cycle day.  Zero resets it to the day computed for the date.
+func (p *Generator) SetMCDay(d int) {
+	p.DocProps.overrides.MovableCycleDay = d
+	p.DocProps.Ldp = p.DocProps.computed.WithOverrides(p.DocProps.overrides)
+}
+
+// Liturgical template command that returns the fasting level
+// of the date, e.g. strict, wine and oil, fish, or fast-free
+func (p *Generator) FastingLevel() string {
+	return p.DocProps.Ldp.FastingLevel()
+}
+
+// Liturgical template command that returns the fasting period
+// of the date, e.g. Great Lent, or an empty string
+func (p *Generator) FastingPeriod() string {
+	return p.DocProps.Ldp.FastingPeriod()
+}
+
+// Liturgical template command that returns the titles of the commemorations
+// of the date in the library, separated by semicolons (see package commemorations).
+// It is how a gohtml template puts the commemorations in a header or footer,
+// e.g. {{.Commemoration "en_us_dedes"}}, since LML has no directive for them.
+func (p *Generator) Commemoration(library string) string {
+	day, err := commemorations.NewService(p.Store).Lookup(&p.DocProps.Ldp, library)
+	if err != nil {
+		p.DocProps.error = err.Error()
+		return ""
+	}
+	var titles []string
+	for _, c := range day.Commemorations {
+		titles = append(titles, c.Title)
+	}
+	return strings.Join(titles, "; ")
+}
+
+// Liturgical template command that returns the name of the period of the date
+// in the language of the library, e.g. Fourth Week of Great Lent,
+// followed by the name of the feast period, if any, e.g. Afterfeast of Theophany,
+// separated by semicolons (see package periods).
+func (p *Generator) NameOfPeriod(library string) string {
+	names := p.names(library, periods.NamePeriodNames)
+	if names == nil {
+		return ""
+	}
+	return strings.Join(names.PeriodNames, "; ")
+}
+
+// Liturgical template command that returns the name of the day of the date
+// in the language of the library, e.g. Wednesday of the Fourth Week of Great Lent
+func (p *Generator) NameOfDay(library string) string {
+	names := p.names(library, periods.NameDay)
+	if names == nil {
+		return ""
+	}
+	return names.Day
+}
+
+// Liturgical template command that returns the day and week of the Lukan cycle
+// of the date in the language of the library, e.g. Wednesday of the Fourth Week of Luke
+func (p *Generator) LukanCycleWeekDay(library string) string {
+	names := p.names(library, periods.NameLukanCycleWeekDay)
+	if names == nil {
+		return ""
+	}
+	return names.LukanCycleWeekDay
 }
 
-// stores the Ltx records that have already been retrieved from the database so we do not do another call to the db.
-var Retrieved map[string]models.Ltx
+// names returns the names of the periods and day of the date in the library, or nil if there is an error.
+// The keys of the name (e.g. periods.NameDay) that the library does not have are reported as an error.
+func (p *Generator) names(library, name string) *periods.Names {
+	names, err := periods.NewService(p.Store).Names(&p.DocProps.Ldp, library)
+	if err != nil {
+		p.DocProps.error = err.Error()
+		return nil
+	}
+	if missing := names.MissingFor(name); len(missing) > 0 {
+		p.DocProps.error = fmt.Sprintf("library %s has no names for the keys %s of topic %s", library, strings.Join(missing, ", "), periods.Topic)
+	}
+	return names
+}
+
+// Liturgical template command that returns the variant of the services
+// of the date, as chosen by the rules of the typikon in the library
+// (see package typikon), or an empty string if no rule chooses one.
+func (p *Generator) Variant(library string) string {
+	rules, err := typikon.ReadRules(p.Store, library)
+	if err != nil {
+		p.DocProps.error = err.Error()
+		return ""
+	}
+	return rules.Evaluate(&p.DocProps.Ldp).Variant
+}
 
 // get the record with the specified id.  If it has been already retrieved from the database
 // we will get it from the retrieved map.  Otherwise, we will read it from the database.
-func GetRecord(id string) (models.Ltx, error) {
-	if ltx, ok := Retrieved[id]; ok {
+// If the record redirects, the value is the one at the end of the chain of redirects.
+func (p *Generator) GetRecord(id string) (models.Ltx, error) {
+	if ltx, ok := p.retrieved[id]; ok {
 		return ltx, nil
 	} else {
-		ltx = models.Ltx{}
-		err := Db.Get(&ltx, "SELECT * FROM ltx WHERE id=$1", id)
-		return ltx, err
+		rec, err := p.Store.ReadById(id)
+		if err != nil {
+			return models.Ltx{}, err
+		}
+		if rec == nil {
+			return models.Ltx{}, ltxstore.ErrNotFound
+		}
+		if len(rec.Redirect) > 0 {
+			to, _, err := ltxstore.Resolve(p.Store, id)
+			if err != nil {
+				return models.Ltx{}, err
+			}
+			rec.Value, rec.NNP, rec.NWP = to.Value, to.NNP, to.NWP
+		}
+		p.retrieved[id] = *rec
+		return *rec, nil
 	}
 }
 
-var Db *sqlx.DB
-
 // For each domain, generate files of specified types whose names match one of the patterns
 func Build(templatesDir string,
 	dbPath string, // path to the sqlite database
@@ -313,7 +428,6 @@ func Build(templatesDir string,
 	if err != nil {
 		return err
 	}
-	TemplateDir = templatesDir
 	for _, template := range templates {
 		err = GenerateFromTemplate(templatesDir, dbPath, template, siteDir, domains)
 		if err != nil {
@@ -328,16 +442,15 @@ func GenerateFromTemplate(templatesDir string,
 	outputPath string,
 	domains []string) error {
 
-	var err error
 	// open the database
-	Db, err = sqlx.Open("sqlite3", dbPath)
+	store, err := ltx2sql.NewLtxMapper(dbPath)
 	if err != nil {
 		return err
 	}
-	// set up the domains we will process
-	Domains = domains
+	defer store.Close()
+	g := NewGenerator(store, templatesDir, domains)
 
-	doc, err = template.ParseGlob(filepath.Join(templatesDir, "layout", "*.gohtml"))
+	doc, err := template.ParseGlob(filepath.Join(templatesDir, "layout", "*.gohtml"))
 	if err != nil {
 		return err
 	}
@@ -348,28 +461,29 @@ func GenerateFromTemplate(templatesDir string,
 	}
 	// rows is a dummy variable.
 	var rows bytes.Buffer
-	tmpl.Execute(&rows, Command("rows"))
-	Table.Title = "Divine Liturgy"
+	tmpl.Execute(&rows, g)
+	g.Table.Title = "Divine Liturgy"
 	f, err := os.Create(filepath.Join(outputPath, "index.html"))
 	if err != nil {
 		return err
 	}
-	doc.ExecuteTemplate(f, "doc", Table)
+	doc.ExecuteTemplate(f, "doc", g.Table)
 	return err
 }
 func Serve(port, home string) {
-	var err error
 	// open the database
-	Db, err = sqlx.Open("sqlite3", filepath.Join(home, "data", "sql", "liturgical.db"))
+	store, err := ltx2sql.NewLtxMapper(filepath.Join(home, "data", "sql", "liturgical.db"))
 	if err != nil {
 		panic(err)
 	}
 	// set up the domains we will process
-	Domains = append(Domains, "gr_gr_cog")
-	Domains = append(Domains, "en_us_dedes")
-	//	Domains = append(Domains, "gr_gr_cog")
+	var domains []string
+	domains = append(domains, "gr_gr_cog")
+	domains = append(domains, "en_us_dedes")
+	//	domains = append(domains, "gr_gr_cog")
+	g := NewGenerator(store, filepath.Join(home, "templates"), domains)
 
-	doc, err = template.ParseGlob(filepath.Join(home, "templates", "layout", "*.gohtml"))
+	doc, err := template.ParseGlob(filepath.Join(home, "templates", "layout", "*.gohtml"))
 	if err != nil {
 		panic(err)
 	}
@@ -380,15 +494,14 @@ func Serve(port, home string) {
 	}
 	// rows is a dummy variable.
 	var rows bytes.Buffer
-	tmpl.Execute(&rows, Command("rows"))
-	Table.Title = "Divine Liturgy"
+	tmpl.Execute(&rows, g)
+	g.Table.Title = "Divine Liturgy"
 
 	fs := http.FileServer(http.Dir(filepath.Join(home, "http", "static")))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
-	http.HandleFunc("/", handler)
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		doc.ExecuteTemplate(w, "doc", g.Table)
+	})
 
 	http.ListenAndServe(":"+port, nil)
 }
-func handler(w http.ResponseWriter, r *http.Request) {
-	doc.ExecuteTemplate(w, "doc", Table)
-}
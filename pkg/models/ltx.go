@@ -41,6 +41,25 @@ type Ltx struct {
 // An array of liturgical text records
 type LtxArray []Ltx
 
+// Redirect holds the id of a record and the id it redirects to
+type Redirect struct {
+	ID       string
+	Redirect string
+}
+
+// LtxRevision holds the value, redirect, and comment that a record had
+// before it was changed, and who changed it and when.
+// Revisions are numbered from 1 for each record id, oldest first.
+type LtxRevision struct {
+	Revision    int    `json:"revision"`
+	ID          string `json:"id"`
+	Value       string `json:"value"`
+	Redirect    string `json:"redirect"`
+	Comment     string `json:"comment"`
+	ChangedBy   string `json:"changedBy"`
+	ChangedWhen string `json:"changedWhen"`
+}
+
 // Prefix for generating SQL for db read
 var ReadPrefix = `PRAGMA foreign_keys=OFF;
 BEGIN TRANSACTION;
@@ -48,21 +67,6 @@ BEGIN TRANSACTION;
 var ReadSuffix = `
 COMMIT;`
 
-// Schema to create Ltx
-var LtxSchema = `CREATE TABLE IF NOT EXISTS ltx (
-    id            TEXT PRIMARY KEY,
-    library       TEXT,
-    topic         TEXT,
-    key           TEXT,
-    value         TEXT,
-    nnp           TEXT,
-    nwp           TEXT,
-    comment       TEXT,
-    redirect      TEXT,
-    createdWhen   TEXT,
-    modifiedWhen  TEXT,
-    FOREIGN KEY(redirect) REFERENCES ltx(id));`
-
 // SQL to insert Ltx into database.
 //  This is used for insertions in an existing database.
 var LtxSQLInsert = `INSERT OR REPLACE INTO ltx (id, topic, key, value, nnp, nwp, comment, redirect) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
@@ -226,7 +230,8 @@ func NewLtx(library, topic, key, value, comment, redirect string) *Ltx {
 	id.Topic = topic
 	id.Key = key
 	l := Ltx{}
-	l.ID = id.ToNeoId()
+	l.ID = id.ToSQLId()
+	l.Library = library
 	l.Topic = topic
 	l.Key = key
 	l.Comment = comment
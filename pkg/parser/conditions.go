@@ -0,0 +1,359 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/lectionary"
+	lml "gitlab.com/ocmc/liturgiko/lml-go/parser"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+The conditional statements of a template, if and switch, are evaluated against
+the liturgical day properties of the template (ALT.LDP) as the walk enters them.
+The blocks and switch groups that are not chosen are added to the skipped set,
+and while the walk is inside one of them, its paragraphs are not added to the ATEM.
+
+  if ModeOfWeek == 1 && NameOfDay != Sun { ... } else { ... }
+  switch MovableCycleDay { case 1 thru 7: ... case 8, 15: ... default: ... }
+  switch Date { case Jan 1 thru 6: ... case Dec 24, 25: ... }
+  switch NameOfDay { case Mon thru Fri: ... case Sat, Sun: ... }
+
+The grammar has some limits:
+else if is not followed by a condition, so it is the same as else.
+For a condition, use an if statement inside the else block.
+The lexer reads >= as a token that the grammar does not accept, so write > = instead.
+The months Apr and May, and Aug and Sep, can only be written as a pair, e.g. case Apr May 1:,
+which does not match any date.  For a date in those months, compare with the dates
+of the months before and after, e.g. if Date > Mar 31 && Date < Jun 1.
+A switch chooses the first group with a matching case, or the group with default.
+There is no fall through from one group to the next.
+
+The integer properties are:
+  ModeOfWeek                   the mode of the week, 1..8, with the override, if any
+  MovableCycleDay              the day of the Triodion or Pentecostarion, or 0 outside them
+  LukanCycleDay                the day of the Lukan cycle whose Gospel is read, or 0
+  SundaysBeforeTriodion        the Sundays after Theophany before the Triodion
+  SundayAfterElevationOfCross  the day of the month of the Sunday after the Elevation of the Cross,
+                               or, in a switch, its month and day
+Dates are those of the fixed cycle, so they follow the calendar type of the template.
+ */
+
+var dowNames = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+var monthNames = map[string]int{
+	"Jan": 1, "Feb": 2, "Mar": 3, "Apr": 4, "May": 5, "Jun": 6,
+	"Jul": 7, "Aug": 8, "Sep": 9, "Oct": 10, "Nov": 11, "Dec": 12,
+}
+
+// EnterStatement is called when production statement is entered.
+// If the statement is an if or a switch, it chooses the blocks or group to walk.
+func (l *LMLListener) EnterStatement(ctx *lml.StatementContext) {
+	switch {
+	case ctx.IF() != nil:
+		condition := l.evaluate(ctx.Expression())
+		for i, block := range ctx.AllBlock() {
+			if (i == 0) != condition { // the first block is walked if the condition is true, the others if not
+				l.skipped[block] = true
+			}
+		}
+	case ctx.SWITCH() != nil:
+		l.chooseSwitchGroup(ctx)
+	}
+}
+
+// EnterBlock is called when production block is entered.
+func (l *LMLListener) EnterBlock(ctx *lml.BlockContext) {
+	if l.skipped[ctx] {
+		l.skipping++
+	}
+}
+
+// ExitBlock is called when production block is exited.
+func (l *LMLListener) ExitBlock(ctx *lml.BlockContext) {
+	if l.skipped[ctx] {
+		l.skipping--
+	}
+}
+
+// EnterSwitchBlockStatementGroup is called when production switchBlockStatementGroup is entered.
+func (l *LMLListener) EnterSwitchBlockStatementGroup(ctx *lml.SwitchBlockStatementGroupContext) {
+	if l.skipped[ctx] {
+		l.skipping++
+	}
+}
+
+// ExitSwitchBlockStatementGroup is called when production switchBlockStatementGroup is exited.
+func (l *LMLListener) ExitSwitchBlockStatementGroup(ctx *lml.SwitchBlockStatementGroupContext) {
+	if l.skipped[ctx] {
+		l.skipping--
+	}
+}
+
+// EnterExpression is called when production expression is entered.
+// The expression is evaluated by the statement that has it.
+func (l *LMLListener) EnterExpression(ctx *lml.ExpressionContext) {
+	l.inExpression++
+}
+
+// ExitExpression is called when production expression is exited.
+func (l *LMLListener) ExitExpression(ctx *lml.ExpressionContext) {
+	l.inExpression--
+}
+
+// kinds of switch values
+const (
+	switchInteger = iota
+	switchDate
+	switchDow
+)
+
+// switchValue is the value of the property of a switch statement
+type switchValue struct {
+	name       string
+	kind       int          // one of the switch kinds
+	n          int          // an integer property
+	month, day int          // Date or SundayAfterElevationOfCross
+	weekday    time.Weekday // NameOfDay
+}
+
+// chooseSwitchGroup adds the groups of the switch statement, except the chosen one, to the skipped set
+func (l *LMLListener) chooseSwitchGroup(ctx *lml.StatementContext) {
+	var v switchValue
+	switch {
+	case ctx.LdpInt() != nil:
+		v.name = ctx.LdpInt().GetText()
+		v.n = l.ldpInt(ctx.LdpInt())
+		if ctx.LdpInt().GetStart().GetTokenType() == lml.LMLParserSUNDAY_AFTER_ELEVATION_OF_CROSS {
+			v.month, v.day = l.sundayAfterElevationOfCross()
+		}
+		v.kind = switchInteger
+	case ctx.DATE() != nil:
+		v.name = ctx.DATE().GetText()
+		v.month, v.day = l.ALT.LDP.MenaionMonth, l.ALT.LDP.MenaionDay
+		v.kind = switchDate
+	case ctx.NAME_OF_DAY() != nil:
+		v.name = ctx.NAME_OF_DAY().GetText()
+		v.weekday = l.ALT.LDP.TheDay.Weekday()
+		v.kind = switchDow
+	}
+	block, ok := ctx.SwitchBlock().(*lml.SwitchBlockContext)
+	if !ok { // a syntax error, which has been reported
+		return
+	}
+	var chosen, byDefault antlr.Tree
+	for _, g := range block.AllSwitchBlockStatementGroup() {
+		group := g.(*lml.SwitchBlockStatementGroupContext)
+		for _, s := range group.AllSwitchLabel() {
+			label := s.(*lml.SwitchLabelContext)
+			if label.CASE() == nil {
+				if byDefault == nil {
+					byDefault = group
+				}
+			} else if l.matches(label, v) && chosen == nil {
+				chosen = group
+			}
+		}
+	}
+	if chosen == nil {
+		chosen = byDefault
+	}
+	for _, group := range block.AllSwitchBlockStatementGroup() {
+		if group != chosen {
+			l.skipped[group] = true
+		}
+	}
+}
+
+// matches reports whether the case of the label matches the value of the switch.
+// A case of the wrong kind, e.g. case Mon: in switch ModeOfWeek, is reported as an error.
+func (l *LMLListener) matches(label *lml.SwitchLabelContext, v switchValue) bool {
+	switch {
+	case label.MonthName() != nil:
+		if v.month == 0 {
+			break
+		}
+		return monthNames[label.MonthName().GetText()] == v.month && matchesInteger(label.IntegerExpression(), v.day)
+	case label.DowExpression() != nil:
+		if v.kind != switchDow {
+			break
+		}
+		return matchesDow(label.DowExpression(), v.weekday)
+	case label.IntegerExpression() != nil:
+		if v.kind != switchInteger {
+			break
+		}
+		return matchesInteger(label.IntegerExpression(), v.n)
+	}
+	msg := fmt.Sprintf("case %s does not match the values of switch %s", strings.TrimSuffix(strings.TrimPrefix(label.GetText(), "case"), ":"), v.name)
+	label.GetParser().NotifyErrorListeners(msg, label.GetStart(), nil)
+	return false
+}
+
+// matchesInteger reports whether n is one of the integers, or in the range, of the expression
+func matchesInteger(e lml.IIntegerExpressionContext, n int) bool {
+	ctx, ok := e.(*lml.IntegerExpressionContext)
+	if !ok {
+		return false
+	}
+	if ctx.IntegerList() != nil {
+		for _, i := range ctx.IntegerList().(*lml.IntegerListContext).AllINTEGER() {
+			if atoi(i) == n {
+				return true
+			}
+		}
+		return false
+	}
+	if ctx.THRU() != nil {
+		return atoi(ctx.INTEGER(0)) <= n && n <= atoi(ctx.INTEGER(1))
+	}
+	return ctx.INTEGER(0) != nil && atoi(ctx.INTEGER(0)) == n
+}
+
+// matchesDow reports whether the weekday is one of the days, or in the range, of the expression
+func matchesDow(e lml.IDowExpressionContext, weekday time.Weekday) bool {
+	ctx, ok := e.(*lml.DowExpressionContext)
+	if !ok {
+		return false
+	}
+	if ctx.DowList() != nil {
+		for _, d := range ctx.DowList().(*lml.DowListContext).AllDowName() {
+			if dowNames[d.GetText()] == weekday {
+				return true
+			}
+		}
+		return false
+	}
+	if ctx.THRU() != nil {
+		return dowNames[ctx.DowName(0).GetText()] <= weekday && weekday <= dowNames[ctx.DowName(1).GetText()]
+	}
+	return ctx.DowName(0) != nil && dowNames[ctx.DowName(0).GetText()] == weekday
+}
+
+// evaluate returns the value of the condition of an if statement
+func (l *LMLListener) evaluate(e lml.IExpressionContext) bool {
+	ctx, ok := e.(*lml.ExpressionContext)
+	if !ok { // a syntax error, which has been reported
+		return false
+	}
+	switch {
+	case ctx.AND() != nil:
+		return l.evaluate(ctx.Expression(0)) && l.evaluate(ctx.Expression(1))
+	case ctx.OR() != nil:
+		return l.evaluate(ctx.Expression(0)) || l.evaluate(ctx.Expression(1))
+	case ctx.LPAREN() != nil:
+		return l.evaluate(ctx.Expression(0))
+	case ctx.EXISTS() != nil:
+		return l.exists(ctx.Rid())
+	case ctx.NAME_OF_DAY() != nil:
+		is := ctx.DowName() != nil && dowNames[ctx.DowName().GetText()] == l.ALT.LDP.TheDay.Weekday()
+		return is == (ctx.INEQUALITY() == nil)
+	case ctx.DATE() != nil:
+		monthDay, ok := ctx.MonthDay().(*lml.MonthDayContext)
+		if !ok || monthDay.INTEGER() == nil {
+			return false
+		}
+		date := l.ALT.LDP.MenaionMonth*100 + l.ALT.LDP.MenaionDay
+		return compare(ctx, date, monthNames[monthDay.MonthName().GetText()]*100+atoi(monthDay.INTEGER()))
+	case ctx.LdpInt() != nil && ctx.INTEGER() != nil:
+		return compare(ctx, l.ldpInt(ctx.LdpInt()), atoi(ctx.INTEGER()))
+	}
+	return false
+}
+
+// compare returns the result of comparing a and b with the operator of the expression
+func compare(ctx *lml.ExpressionContext, a, b int) bool {
+	switch {
+	case ctx.EQUALITY() != nil:
+		return a == b
+	case ctx.INEQUALITY() != nil:
+		return a != b
+	case ctx.LT() != nil && ctx.ASSIGNMENT() != nil:
+		return a <= b
+	case ctx.GT() != nil && ctx.ASSIGNMENT() != nil:
+		return a >= b
+	case ctx.LT() != nil:
+		return a < b
+	case ctx.GT() != nil:
+		return a > b
+	}
+	return false
+}
+
+// ldpInt returns the value of the integer property of the liturgical day
+func (l *LMLListener) ldpInt(ctx lml.ILdpIntContext) int {
+	switch ctx.GetStart().GetTokenType() {
+	case lml.LMLParserMODE_OF_WEEK:
+		return l.ALT.LDP.GetModeOfWeek()
+	case lml.LMLParserMOVABLE_CYCLE_DAY:
+		return l.ALT.LDP.DayOfSeason
+	case lml.LMLParserLUKAN_CYCLE_DAY:
+		day, _ := lectionary.LukanDay(&l.ALT.LDP)
+		return day
+	case lml.LMLParserSUNDAY_AFTER_ELEVATION_OF_CROSS:
+		_, day := l.sundayAfterElevationOfCross()
+		return day
+	case lml.LMLParserSUNDAYS_BEFORE_TRIODION:
+		return l.ALT.LDP.NumberOfSundaysBeforeStartOfTriodion
+	}
+	return 0
+}
+
+// sundayAfterElevationOfCross returns the month and day of the fixed cycle of the Sunday after the last Elevation of the Cross
+func (l *LMLListener) sundayAfterElevationOfCross() (int, int) {
+	_, month, day := ldp.MenaionDate(l.ALT.LDP.SundayAfterElevationOfCrossDateLast, l.ALT.LDP.CalendarType)
+	return month, day
+}
+
+// exists reports whether the topic/key of the rid, resolved for the liturgical day, is in the database
+func (l *LMLListener) exists(r lml.IRidContext) bool {
+	ctx, ok := r.(*lml.RidContext)
+	if !ok || ctx.STRING() == nil {
+		return false
+	}
+	id, err := strconv.Unquote(ctx.STRING().GetText())
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(id, "/")
+	if len(parts) != 2 {
+		ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("mismatched input '%s' expecting one forward slash in topic/key path", id), ctx.STRING().GetSymbol(), nil)
+		return false
+	}
+	if err = ldp.CheckTopic(parts[0]); err != nil {
+		ctx.GetParser().NotifyErrorListeners(err.Error(), ctx.STRING().GetSymbol(), nil)
+		return false
+	}
+	var modeOverride, dayOverride int
+	for _, o := range ctx.AllOverride() {
+		override := o.(*lml.OverrideContext)
+		if mode, ok := override.OverrideMode().(*lml.OverrideModeContext); ok && mode.INTEGER() != nil {
+			modeOverride = atoi(mode.INTEGER())
+		}
+		if day, ok := override.OverrideDay().(*lml.OverrideDayContext); ok && day.INTEGER() != nil {
+			dayOverride = atoi(day.INTEGER())
+		}
+	}
+	topic := parts[0]
+	if strings.HasSuffix(topic, "*") {
+		topic = l.ALT.LDP.RelativeTopic(topic, modeOverride, dayOverride)
+	}
+	return l.LtxMapper.ExistsTK(topic, parts[1])
+}
+
+// atoi returns the value of an INTEGER token
+func atoi(node antlr.TerminalNode) int {
+	i, _ := strconv.Atoi(node.GetText())
+	return i
+}
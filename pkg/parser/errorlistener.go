@@ -5,11 +5,28 @@ import (
 	"github.com/antlr/antlr4/runtime/Go/antlr"
 )
 
+// Severity is the severity of a ParseError
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
 type ParseError struct {
 	TemplateID string
 	Line int
 	Column int
 	Message string
+	Severity Severity
+	Code string // see the Code constants in validate.go.  Empty for the errors reported by the listener.
 }
 // String returns an error formatted as line:column:message
 func (e *ParseError) String() string {
@@ -31,7 +48,7 @@ func NewLMLErrorListener(templateID string) *LMLErrorListener {
 	return l
 }
 func (l *LMLErrorListener) AddError(templateID string, line, column int, msg string) {
-	theError := ParseError{l.TemplateID, line,column, msg}
+	theError := ParseError{TemplateID: l.TemplateID, Line: line, Column: column, Message: msg}
 	l.Errors = append(l.Errors, theError)
 }
 func (l *LMLErrorListener) SyntaxError(recognizer antlr.Recognizer, offendingSymbol interface{}, line, column int, msg string, e antlr.RecognitionException) {
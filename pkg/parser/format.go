@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	lml "gitlab.com/ocmc/liturgiko/lml-go/parser"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+Format returns a template in canonical form, so that templates written by different
+people look the same and their diffs show only changes of content:
+
+  ID, Type, and Status first, then the other properties, one per line, in the order of propertyOrder,
+    without the braces that may be put around them
+  one statement per line, e.g. one para per line, with the words separated by one space
+  a tab of indentation for each block, if, switch, and case, with { at the end of the line
+    that opens it, and } on its own line, followed by else if there is one
+  strings quoted with double quotes, e.g. sid "actors/Priest"
+  at most one blank line between statements, where the template has one or more
+
+Comments are kept: a comment at the end of a line stays at the end of the line,
+and a comment on its own line stays before the statement or property that follows it.
+A template with syntax errors is returned as it is, with the errors.
+ */
+
+// propertyOrder is the order of the properties after ID, Type, and Status, by their first token
+var propertyOrder = []string{
+	"Calendar", "Title", "HtmlCss", "PdfCss", "Month", "Day", "Year",
+	"PageHeader", "PageHeaderEven", "PageHeaderOdd", "PageFooter", "PageFooterEven", "PageFooterOdd",
+	"SetPageNumber",
+}
+
+// Format returns the template in canonical form, or if it has syntax errors, the template as it is and the errors
+func Format(templateID, input string) (string, []ParseError) {
+	lexer := lml.NewLMLLexer(antlr.NewInputStream(input))
+	errorListener := NewLMLErrorListener(templateID)
+	lexer.RemoveErrorListeners()
+	lexer.AddErrorListener(errorListener)
+	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
+	p := lml.NewLMLParser(stream)
+	p.RemoveErrorListeners()
+	p.AddErrorListener(errorListener)
+	tree := p.Template()
+	if len(errorListener.Errors) > 0 {
+		return input, errorListener.Errors
+	}
+	f := &formatter{stream: stream, emitted: make(map[int]bool)}
+	f.node(tree)
+	f.newline()
+	return f.sb.String(), nil
+}
+
+// formatter writes a parse tree in canonical form.  The words of the current line are
+// written when the line ends, indented by the number of blocks they are in.
+type formatter struct {
+	stream    *antlr.CommonTokenStream
+	sb        strings.Builder
+	line      []string
+	last      string // the last line written, without the indentation, empty if it is blank
+	indent    int
+	lastLine  int          // the line in the template of the last token or comment written
+	keepBlank bool         // keep a blank line before a statement, which is not done for the reordered properties
+	emitted   map[int]bool // the indexes of the comments written
+}
+
+func (f *formatter) node(t antlr.Tree) {
+	switch n := t.(type) {
+	case antlr.TerminalNode:
+		f.token(n.GetSymbol())
+	case *lml.TmplIDContext, *lml.TmplTypeContext, *lml.TmplStatusContext, *lml.PropertyContext:
+		f.newline()
+		f.children(t)
+		f.newline()
+	case *lml.PropertyBlockContext:
+		f.properties(n)
+		f.lastLine = n.GetStop().GetLine()
+		f.keepBlank = true
+	case *lml.StatementContext:
+		f.newline()
+		f.blankLine(f.firstLine(n.GetStart()))
+		f.children(t)
+	case *lml.SwitchLabelContext:
+		f.newline()
+		f.children(t)
+	case *lml.SwitchBlockStatementGroupContext:
+		f.group(n)
+	default:
+		f.children(t)
+	}
+}
+
+func (f *formatter) children(t antlr.Tree) {
+	for _, child := range t.GetChildren() {
+		f.node(child)
+	}
+}
+
+// properties writes the properties in the order of propertyOrder, and drops the braces around them
+func (f *formatter) properties(ctx *lml.PropertyBlockContext) {
+	var properties []antlr.Tree
+	for _, child := range ctx.GetChildren() {
+		if terminal, ok := child.(antlr.TerminalNode); ok {
+			f.comments(terminal.GetSymbol())
+			continue
+		}
+		properties = append(properties, child)
+	}
+	rank := func(t antlr.Tree) int {
+		first := t.(*lml.PropertyContext).GetStart().GetText()
+		for i, name := range propertyOrder {
+			if name == first {
+				return i
+			}
+		}
+		return len(propertyOrder)
+	}
+	sort.SliceStable(properties, func(i, j int) bool { return rank(properties[i]) < rank(properties[j]) })
+	for _, property := range properties {
+		f.node(property)
+	}
+}
+
+// group writes the labels of a case each on its own line, and its statements indented
+func (f *formatter) group(ctx *lml.SwitchBlockStatementGroupContext) {
+	children := ctx.GetChildren()
+	i := 0
+	for ; i < len(children); i++ {
+		if _, ok := children[i].(*lml.SwitchLabelContext); !ok {
+			break
+		}
+		f.node(children[i])
+	}
+	if i < len(children) {
+		if terminal, ok := children[i].(antlr.TerminalNode); ok && terminal.GetSymbol().GetTokenType() == lml.LMLLexerLBRACE {
+			for ; i < len(children); i++ { // the braces indent the statements
+				f.node(children[i])
+			}
+			return
+		}
+	}
+	f.newline()
+	f.indent++
+	for ; i < len(children); i++ {
+		f.node(children[i])
+	}
+	f.newline()
+	f.indent--
+}
+
+// token writes the comments before the token, the token, and a comment after it on the same line
+func (f *formatter) token(t antlr.Token) {
+	f.comments(t)
+	switch t.GetTokenType() {
+	case antlr.TokenEOF:
+		return
+	case lml.LMLLexerLBRACE:
+		f.word("{")
+		f.newline()
+		f.indent++
+	case lml.LMLLexerRBRACE:
+		f.newline()
+		f.indent--
+		f.word("}") // the line is left open for an else
+	case lml.LMLLexerSTRING:
+		text := t.GetText()
+		if value, err := strconv.Unquote(text); err == nil {
+			text = strconv.Quote(value)
+		}
+		f.word(text)
+	default:
+		f.word(t.GetText())
+	}
+	f.lastLine = t.GetLine()
+	for _, c := range f.stream.GetHiddenTokensToRight(t.GetTokenIndex(), antlr.TokenHiddenChannel) {
+		if !isComment(c) || f.emitted[c.GetTokenIndex()] || c.GetLine() != t.GetLine() {
+			continue
+		}
+		f.emitted[c.GetTokenIndex()] = true
+		f.word(strings.TrimRight(c.GetText(), "\r\n"))
+		f.lastLine = c.GetLine() + strings.Count(strings.TrimRight(c.GetText(), "\r\n"), "\n")
+		if c.GetTokenType() == lml.LMLLexerLINE_COMMENT {
+			f.newline()
+		}
+	}
+}
+
+// comments writes the comments before the token that have not been written.
+// A comment on the line of the token stays in the line, and the others are written on their own line.
+func (f *formatter) comments(t antlr.Token) {
+	for _, c := range f.stream.GetHiddenTokensToLeft(t.GetTokenIndex(), antlr.TokenHiddenChannel) {
+		if !isComment(c) || f.emitted[c.GetTokenIndex()] {
+			continue
+		}
+		f.emitted[c.GetTokenIndex()] = true
+		text := strings.TrimRight(c.GetText(), "\r\n")
+		if c.GetTokenType() == lml.LMLLexerCOMMENT && c.GetLine() == t.GetLine() && !strings.Contains(text, "\n") {
+			f.word(text)
+		} else {
+			f.newline()
+			f.blankLine(c.GetLine())
+			f.word(text)
+			f.newline()
+		}
+		f.lastLine = c.GetLine() + strings.Count(text, "\n")
+	}
+}
+
+// firstLine returns the line of the first comment before the token that has not been written, or else of the token
+func (f *formatter) firstLine(t antlr.Token) int {
+	for _, c := range f.stream.GetHiddenTokensToLeft(t.GetTokenIndex(), antlr.TokenHiddenChannel) {
+		if isComment(c) && !f.emitted[c.GetTokenIndex()] {
+			return c.GetLine()
+		}
+	}
+	return t.GetLine()
+}
+
+func isComment(t antlr.Token) bool {
+	return t.GetTokenType() == lml.LMLLexerCOMMENT || t.GetTokenType() == lml.LMLLexerLINE_COMMENT
+}
+
+// word adds the word to the line, separated by a space, except around parentheses and before : and ,
+func (f *formatter) word(w string) {
+	if n := len(f.line); n > 0 && w != ")" && w != ":" && w != "," && f.line[n-1] != "(" {
+		f.line = append(f.line, " ")
+	}
+	f.line = append(f.line, w)
+}
+
+// newline writes the line, if it has words
+func (f *formatter) newline() {
+	if len(f.line) == 0 {
+		return
+	}
+	f.last = strings.Join(f.line, "")
+	f.sb.WriteString(strings.Repeat("\t", f.indent))
+	f.sb.WriteString(f.last)
+	f.sb.WriteString("\n")
+	f.line = nil
+}
+
+// blankLine writes a blank line if the template has one before the line, except after a line that opens a block
+func (f *formatter) blankLine(line int) {
+	if f.keepBlank && len(f.line) == 0 && line > f.lastLine+1 && f.sb.Len() > 0 && len(f.last) > 0 && !strings.HasSuffix(f.last, "{") {
+		f.sb.WriteString("\n")
+		f.last = ""
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+/**
+An insert statement, e.g.
+
+  insert "blocks/litany"
+
+splices the paragraphs of another template into the template at the position of the insert.
+The ID of the inserted template is its path in the templates directory, without the extension .lml,
+or its ID in a database.  The inserted template is parsed with the same liturgical day properties
+and the same store as the template that inserts it, so its conditions are evaluated against the
+day of that template, and its own Month, Day, and Year, if any, are ignored.  It may insert other templates.
+
+The listener reports as ParseErrors, at the line and column of the insert:
+  an insert whose template cannot be read, e.g. because the file does not exist, and
+  an insert that would cycle, e.g. a template that inserts itself, or a inserts b which inserts a.
+The errors in an inserted template are reported with the ID of the inserted template and their line and column in it.
+
+An insert in a block whose condition is false is read and parsed, so that its errors are reported,
+but its paragraphs are not spliced.
+ */
+
+// Extension is the file extension of LML templates
+const Extension = ".lml"
+
+// TemplateReader reads the LML of a template by its ID
+type TemplateReader interface {
+	ReadTemplate(id string) (string, error)
+}
+
+// TemplateDir reads templates from a directory.  The ID of a template is its path in the directory without the extension.
+type TemplateDir string
+
+// ReadTemplate returns the contents of the file of the template
+func (d TemplateDir) ReadTemplate(id string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(id)+Extension))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// TemplateReaderFunc adapts a function to a TemplateReader, e.g. to read templates from a database
+type TemplateReaderFunc func(id string) (string, error)
+
+// ReadTemplate calls f(id)
+func (f TemplateReaderFunc) ReadTemplate(id string) (string, error) {
+	return f(id)
+}
+
+// insert parses the template with the id, and splices its paragraphs unless the insert is skipped
+func (l *LMLListener) insert(parser antlr.Parser, token antlr.Token, id string) {
+	id = strings.TrimSuffix(id, Extension)
+	for i, inserting := range l.inserting {
+		if inserting == id {
+			cycle := append(append([]string{}, l.inserting[i:]...), id)
+			parser.NotifyErrorListeners(fmt.Sprintf("insert cycle %s", strings.Join(cycle, " -> ")), token, nil)
+			return
+		}
+	}
+	if l.Templates == nil {
+		parser.NotifyErrorListeners(fmt.Sprintf("cannot insert %s: no templates directory or database", id), token, nil)
+		return
+	}
+	input, err := l.Templates.ReadTemplate(id)
+	if err != nil {
+		parser.NotifyErrorListeners(fmt.Sprintf("cannot insert %s: %v", id, err), token, nil)
+		return
+	}
+	child := NewLMLListenerWithStore(l.LtxMapper)
+	child.Templates = l.Templates
+	child.inserting = append([]string{}, l.inserting...)
+	child.inserted = true
+	child.ALT.Calendar = l.ALT.Calendar
+	child.ALT.LDP = l.ALT.LDP
+	c := newLML(id, input, child)
+	l.errors.Errors = append(l.errors.Errors, c.WalkTemplate()...)
+	if l.skipping == 0 {
+		l.ALT.Paragraphs = append(l.ALT.Paragraphs, child.ALT.Paragraphs...)
+	}
+}
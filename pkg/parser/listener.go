@@ -1,11 +1,11 @@
 package parser
 
 import (
-	SQL "database/sql"
 	"fmt"
 	"github.com/antlr/antlr4/runtime/Go/antlr"
 	"github.com/emirpasic/gods/stacks/arraystack"
 	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
 	"github.com/liturgiko/doxa/pkg/enums/idTypes"
 	"github.com/liturgiko/doxa/pkg/enums/positions"
@@ -20,19 +20,52 @@ import (
 type LMLListener struct {
 	lml.BaseLMLListener
 	ALT template.ATEM
-	LtxMapper ltx2sql.LtxMapper
+	LtxMapper ltxstore.LtxStore
+	closeStore bool // the listener opened the store, so closes it at the end of the walk
+	// the state of the walk.  It belongs to the listener,
+	// so that templates can be parsed by concurrent goroutines.
+	pageHeader *template.Header
+	pageFooter *template.Footer
+	lookupDirective *template.PDFLookupDirective
+	paragraph *template.Paragraph
+	span *template.Span
+	pspan *template.Span
+	spans *arraystack.Stack
+	pspans *arraystack.Stack
+	buildingHeader, buildingFooter, buildingLeft, buildingCenter, buildingRight, buildingLookup bool
+	// the blocks and switch groups whose conditions are false, the number of them being walked,
+	// and the number of expressions being walked (see conditions.go)
+	skipped map[antlr.Tree]bool
+	skipping int
+	inExpression int
+	// the reader of inserted templates, the IDs of the templates being inserted, from the outermost,
+	// whether this template is inserted in another, and the error listener of the template (see insert.go)
+	Templates TemplateReader
+	inserting []string
+	inserted bool
+	errors *LMLErrorListener
 	// Emitters []Channel
 }
 func NewLMLListener(dbPath string) (*LMLListener, error) {
-	l := new(LMLListener)
-	db, err := SQL.Open("sqlite3", dbPath)
+	mapper, err := ltx2sql.NewLtxMapper(dbPath)
 	if err != nil {
 		return nil, err
 	}
-	l.LtxMapper.DB = db
+	l := NewLMLListenerWithStore(mapper)
+	l.closeStore = true
+	return l, nil
+}
+// NewLMLListenerWithStore returns a listener that reads the liturgical texts from the store.
+// The store belongs to the caller, and is not closed when the walk exits the template.
+func NewLMLListenerWithStore(store ltxstore.LtxStore) *LMLListener {
+	l := new(LMLListener)
+	l.LtxMapper = store
 	l.ALT.Calendar = calendarTypes.Gregorian // can be overridden if set explicitly in template
 	l.ALT.PDF = new(template.PDF)
-	return l, nil
+	l.spans = arraystack.New()
+	l.pspans = arraystack.New()
+	l.skipped = make(map[antlr.Tree]bool)
+	return l
 }
 func (l *LMLListener) VisitErrorNode(node antlr.ErrorNode) {
 	fmt.Print("")
@@ -59,7 +92,9 @@ func (l *LMLListener) EnterTemplate(ctx *lml.TemplateContext) {
 
 // ExitTemplate is called when production template is exited.
 func (l *LMLListener) ExitTemplate(ctx *lml.TemplateContext) {
-	l.LtxMapper.DB.Close()
+	if l.closeStore {
+		l.LtxMapper.Close()
+	}
 }
 
 // EnterProperty is called when production property is entered.
@@ -82,11 +117,6 @@ func (l *LMLListener) ExitPropertyBlock(ctx *lml.PropertyBlockContext) {
 	fmt.Print("")
 }
 
-// EnterStatement is called when production statement is entered.
-func (l *LMLListener) EnterStatement(ctx *lml.StatementContext) {
-	fmt.Print("")
-}
-
 // ExitStatement is called when production statement is exited.
 func (l *LMLListener) ExitStatement(ctx *lml.StatementContext) {
 	fmt.Print("")
@@ -98,9 +128,9 @@ func (l *LMLListener) EnterInsert(ctx *lml.InsertContext) {
 		id,err := strconv.Unquote(ctx.STRING().GetText())
 		if err != nil {
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("%s",err),ctx.STRING().GetSymbol(),nil)
+			return
 		}
-		// TODO: add check to ensure the id is a valid path to a file (if using file based templates) or is a valid database ID if storing templates in a database.
-		l.ALT.ID = id
+		l.insert(ctx.GetParser(), ctx.STRING().GetSymbol(), id)
 	}
 }
 
@@ -115,21 +145,23 @@ para: PARA_STYLE ( nid | rid | sid | span )+ INSERT_VER?;
 span: SPAN_STYLE ( nid | rid | sid | span )+;
  */
 func (l *LMLListener) EnterPara(ctx *lml.ParaContext) {
-	paragraph = new(template.Paragraph)
-	paragraph.Class = ctx.PARA_STYLE().GetText()
+	l.paragraph = new(template.Paragraph)
+	l.paragraph.Class = ctx.PARA_STYLE().GetText()
 	if ctx.INSERT_VER() != nil {
-		paragraph.AddVersion()
+		l.paragraph.AddVersion()
 	}
-	span = nil
+	l.span = nil
 }
 
 // ExitPara is called when production para is exited.
 func (l *LMLListener) ExitPara(ctx *lml.ParaContext) {
-	if span != nil {
-		paragraph.AddSpan(*span)
+	if l.span != nil {
+		l.paragraph.AddSpan(*l.span)
+	}
+	if l.skipping == 0 {
+		l.ALT.AddParagraph(*l.paragraph)
 	}
-	l.ALT.AddParagraph(*paragraph)
-	span = nil
+	l.span = nil
 	fmt.Print("")
 }
 
@@ -145,18 +177,18 @@ Ideas:
 	the span to the para.
  */
 func (l *LMLListener) EnterSpan(ctx *lml.SpanContext) {
-	span = new(template.Span)
-	span.Class = ctx.SPAN_STYLE().GetText()
+	l.span = new(template.Span)
+	l.span.Class = ctx.SPAN_STYLE().GetText()
 	fmt.Print("")
 }
 // ExitSpan is called when production span is exited.
 func (l *LMLListener) ExitSpan(ctx *lml.SpanContext) {
-	if pspan != nil {
-		pspan.AddChildSpan(*span)
+	if l.pspan != nil {
+		l.pspan.AddChildSpan(*l.span)
 	} else {
-		paragraph.AddSpan(*span)
+		l.paragraph.AddSpan(*l.span)
 	}
-	span = nil
+	l.span = nil
 	fmt.Print("")
 }
 
@@ -177,14 +209,14 @@ func (l *LMLListener) EnterNid(ctx *lml.NidContext) {
 	} else {
 		if value, err := strconv.Unquote(ctx.STRING().GetText()); err == nil  {
 			nid := template.NewNid(value)
-			if span == nil {
-				if pspan == nil {
-					paragraph.AddSpan(*nid)
+			if l.span == nil {
+				if l.pspan == nil {
+					l.paragraph.AddSpan(*nid)
 				} else {
-					pspan.AddChildSpan(*nid)
+					l.pspan.AddChildSpan(*nid)
 				}
 			} else {
-				span.AddChildSpan(*nid)
+				l.span.AddChildSpan(*nid)
 			}
 			//if pspan == nil {
 			//	if span == nil {
@@ -216,38 +248,38 @@ Enter 3
  */
 // EnterPspan is called when production pspan is entered.
 func (l *LMLListener) EnterPspan(ctx *lml.PspanContext) {
-	if span != nil {
-		spans.Push(span)
+	if l.span != nil {
+		l.spans.Push(l.span)
 	}
-	if pspan != nil {
-		pspans.Push(pspan)
+	if l.pspan != nil {
+		l.pspans.Push(l.pspan)
 	}
-	pspan = new(template.Span)
+	l.pspan = new(template.Span)
 }
 // ExitPspan is called when production pspan is exited.
 func (l *LMLListener) ExitPspan(ctx *lml.PspanContext) {
-	if item, ok := spans.Pop(); ok {
+	if item, ok := l.spans.Pop(); ok {
 		popped := item.(*template.Span)
-		for _, s := range pspan.ChildSpans {
+		for _, s := range l.pspan.ChildSpans {
 			popped.AddChildSpan(s)
 		}
-		span = popped
+		l.span = popped
 	}
-	if pspans.Empty() {
-		pspan = nil
+	if l.pspans.Empty() {
+		l.pspan = nil
 	} else {
-		if item, ok := pspans.Pop(); ok {
+		if item, ok := l.pspans.Pop(); ok {
 			popped := item.(*template.Span)
-			pspan = popped
+			l.pspan = popped
 		}
 	}
 }
 
 // EnterPosition is called when production position is entered.
 func (l *LMLListener) EnterPosition(ctx *lml.PositionContext) {
-	buildingLeft = false
-	buildingCenter = false
-	buildingRight =false
+	l.buildingLeft = false
+	l.buildingCenter = false
+	l.buildingRight =false
 
 	if ctx.PositionType() == nil {
 		ctx.GetParser().NotifyErrorListeners("nil position error",ctx.GetStart(),nil)
@@ -261,11 +293,11 @@ func (l *LMLListener) EnterPosition(ctx *lml.PositionContext) {
 		} else {
 			switch slotPosition {
 			case positions.Left:
-				buildingLeft = true
+				l.buildingLeft = true
 			case positions.Center:
-				buildingCenter = true
+				l.buildingCenter = true
 			case positions.Right:
-				buildingRight = true
+				l.buildingRight = true
 			}
 		}
 	}
@@ -273,28 +305,29 @@ func (l *LMLListener) EnterPosition(ctx *lml.PositionContext) {
 
 // ExitPosition is called when production position is exited.
 func (l *LMLListener) ExitPosition(ctx *lml.PositionContext) {
-	buildingLeft = false
-	buildingCenter = false
-	buildingRight = false
-}
-func AddDirective(d template.PDFDecorator) {
-	if buildingLeft {
-		if buildingHeader {
-			pageHeader.AddLeftDirective(d)
+	l.buildingLeft = false
+	l.buildingCenter = false
+	l.buildingRight = false
+}
+// AddDirective adds the directive to the position of the page header or footer being built
+func (l *LMLListener) AddDirective(d template.PDFDecorator) {
+	if l.buildingLeft {
+		if l.buildingHeader {
+			l.pageHeader.AddLeftDirective(d)
 		} else {
-			pageFooter.AddLeftDirective(d)
+			l.pageFooter.AddLeftDirective(d)
 		}
-	} else if buildingCenter {
-		if buildingHeader {
-			pageHeader.AddCenterDirective(d)
+	} else if l.buildingCenter {
+		if l.buildingHeader {
+			l.pageHeader.AddCenterDirective(d)
 		} else {
-			pageFooter.AddCenterDirective(d)
+			l.pageFooter.AddCenterDirective(d)
 		}
 	} else { // buildingRight
-		if buildingHeader {
-			pageHeader.AddRightDirective(d)
+		if l.buildingHeader {
+			l.pageHeader.AddRightDirective(d)
 		} else {
-			pageFooter.AddRightDirective(d)
+			l.pageFooter.AddRightDirective(d)
 		}
 	}
 
@@ -304,10 +337,10 @@ func AddDirective(d template.PDFDecorator) {
 func (l *LMLListener) EnterDirective(ctx *lml.DirectiveContext) {
 	if ctx.INSERT_DATE() != nil {
 		dir := template.NewDateDirective("span.date", l.ALT.LDP.TheDay)
-		AddDirective(dir)
+		l.AddDirective(dir)
 	}
 	if ctx.INSERT_PAGE_NUMBER() != nil {
-		AddDirective(template.NewPageNbrDirective("span.pageNbr"))
+		l.AddDirective(template.NewPageNbrDirective("span.pageNbr"))
 	}
 }
 
@@ -318,42 +351,45 @@ func (l *LMLListener) ExitDirective(ctx *lml.DirectiveContext) {
 
 // EnterLookup is called when production lookup is entered.
 func (l *LMLListener) EnterLookup(ctx *lml.LookupContext) {
-	buildingLookup = true
+	l.buildingLookup = true
 	lib, err := strconv.Atoi(ctx.INTEGER().GetText())
 	if err != nil || (lib == 0 || lib > 3) {
 		msg := fmt.Sprintf("invalid language number %s, expected 1, 2, or 3", ctx.INTEGER().GetText())
 		ctx.GetParser().NotifyErrorListeners(msg,ctx.GetStart(),nil)
-		lookupDirective = template.NewLookupDirective(-1)
+		l.lookupDirective = template.NewLookupDirective(-1)
 	} else {
-		lookupDirective = template.NewLookupDirective(lib)
+		l.lookupDirective = template.NewLookupDirective(lib)
 	}
 }
 
 // ExitLookup is called when production lookup is exited.
 func (l *LMLListener) ExitLookup(ctx *lml.LookupContext) {
-	if buildingFooter {
-		if buildingLeft {
-			pageFooter.AddLeftDirective(lookupDirective)
-		} else if buildingCenter {
-			pageFooter.AddCenterDirective(lookupDirective)
+	if l.buildingFooter {
+		if l.buildingLeft {
+			l.pageFooter.AddLeftDirective(l.lookupDirective)
+		} else if l.buildingCenter {
+			l.pageFooter.AddCenterDirective(l.lookupDirective)
 		} else {
-			pageFooter.AddRightDirective(lookupDirective)
+			l.pageFooter.AddRightDirective(l.lookupDirective)
 		}
 	}
-	if buildingHeader {
-		if buildingLeft {
-			pageHeader.AddLeftDirective(lookupDirective)
-		} else if buildingCenter {
-			pageHeader.AddCenterDirective(lookupDirective)
+	if l.buildingHeader {
+		if l.buildingLeft {
+			l.pageHeader.AddLeftDirective(l.lookupDirective)
+		} else if l.buildingCenter {
+			l.pageHeader.AddCenterDirective(l.lookupDirective)
 		} else {
-			pageHeader.AddRightDirective(lookupDirective)
+			l.pageHeader.AddRightDirective(l.lookupDirective)
 		}
 	}
-	buildingLookup = false
+	l.buildingLookup = false
 }
 
 // EnterRid is called when production rid is entered.
 func (l *LMLListener) EnterRid(ctx *lml.RidContext) {
+	if l.inExpression > 0 { // the rid of Exists, which is evaluated with the expression
+		return
+	}
 	var dayOverride, modeOverride int
 	var err error
 	for _, override := range ctx.AllOverride() {
@@ -394,25 +430,31 @@ func (l *LMLListener) EnterRid(ctx *lml.RidContext) {
 					ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("rid directives (@Mode or @Day) may only be used for topics starting with 'oc' (i.e. Octoechos)"),ctx.STRING().GetSymbol(),nil)
 				}
 			}
-			relativeTopic := l.ALT.LDP.RelativeTopic(parts[0], modeOverride, dayOverride)
-			if ! l.LtxMapper.ExistsTK(relativeTopic,parts[1]) {
-				ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("not found topic/key '%s' does not exist in topic-key rings",id),ctx.STRING().GetSymbol(),nil)
+			// in a skipped block, the rid may be for another day (see Validate, which checks it for any day)
+			if l.skipping == 0 {
+				relativeTopic := l.ALT.LDP.RelativeTopic(parts[0], modeOverride, dayOverride)
+				if ! l.LtxMapper.ExistsTK(relativeTopic,parts[1]) {
+					ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("not found topic/key '%s' does not exist in topic-key rings",id),ctx.STRING().GetSymbol(),nil)
+				}
 			}
 		default:
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("mismatched input '%s' expecting only one forward slash in topic/key path",id),ctx.STRING().GetSymbol(),nil)
 		}
-		if buildingLookup {
-			lookupDirective.AddLookupTK(idTypes.RID, "", id)
+		if l.skipping > 0 {
+			return
+		}
+		if l.buildingLookup {
+			l.lookupDirective.AddLookupTK(idTypes.RID, "", id)
 		} else {
 			rid := template.NewRid(id, modeOverride, dayOverride)
-			if span == nil {
-				if pspan == nil {
-					paragraph.AddSpan(*rid)
+			if l.span == nil {
+				if l.pspan == nil {
+					l.paragraph.AddSpan(*rid)
 				} else {
-					pspan.AddChildSpan(*rid)
+					l.pspan.AddChildSpan(*rid)
 				}
 			} else {
-				span.AddChildSpan(*rid)
+				l.span.AddChildSpan(*rid)
 			}
 			//if pspan == nil {
 			//	if span == nil {
@@ -454,18 +496,18 @@ func (l *LMLListener) EnterSid(ctx *lml.SidContext) {
 		default:
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("mismatched input '%s' expecting only one forward slash in topic/key path",id),ctx.STRING().GetSymbol(),nil)
 		}
-		if buildingLookup {
-			lookupDirective.AddLookupTK(idTypes.SID, "", id)
+		if l.buildingLookup {
+			l.lookupDirective.AddLookupTK(idTypes.SID, "", id)
 		} else {
 			sid := template.NewSid(id)
-			if span == nil {
-				if pspan == nil {
-					paragraph.AddSpan(*sid)
+			if l.span == nil {
+				if l.pspan == nil {
+					l.paragraph.AddSpan(*sid)
 				} else {
-					pspan.AddChildSpan(*sid)
+					l.pspan.AddChildSpan(*sid)
 				}
 			} else {
-				span.AddChildSpan(*sid)
+				l.span.AddChildSpan(*sid)
 			}
 			//if pspan == nil {
 			//	if span == nil {
@@ -496,9 +538,9 @@ func (l *LMLListener) EnterTmplCalendar(ctx *lml.TmplCalendarContext) {
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("%v ",err),ctx.GetStart(),nil)
 		} else {
 			switch 	strings.ToLower(value) {
-			case "gregorian":
+			case "gregorian", "revised julian", "new":
 				l.ALT.Calendar = calendarTypes.Gregorian
-			case "julian":
+			case "julian", "old":
 				l.ALT.Calendar = calendarTypes.Julian
 			default:
 				ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("invalid calendar type '%s'. Expected one of %v",value,calendarTypes.CalendarTypeValues()),ctx.STRING().GetSymbol(),nil)
@@ -548,7 +590,9 @@ func (l *LMLListener) EnterTmplDay(ctx *lml.TmplDayContext) {
 		}
 		if value > 0 && value < 32 {
 			l.ALT.Day = value
-			l.ALT.SetLDP()
+			if !l.inserted {
+				l.ALT.SetLDP()
+			}
 		} else {
 			msg := fmt.Sprintf("invalid Day %d, expected value between 1 and 31", value)
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("%s", msg), ctx.INTEGER().GetSymbol(), nil)
@@ -601,31 +645,31 @@ func (l *LMLListener) ExitTmplMonth(ctx *lml.TmplMonthContext) {
 }
 
 func (l *LMLListener) EnterTmplPageHeader(ctx *lml.TmplPageHeaderContext) {
-	buildingHeader = true
-	buildingFooter = false
-	pageHeader = new(template.Header)
-	pageHeader.Parity = template.Both
-	buildingCenter = false
-	buildingLeft = false
-	buildingRight = false
+	l.buildingHeader = true
+	l.buildingFooter = false
+	l.pageHeader = new(template.Header)
+	l.pageHeader.Parity = template.Both
+	l.buildingCenter = false
+	l.buildingLeft = false
+	l.buildingRight = false
 }
 
 func (l *LMLListener) ExitTmplPageHeader(ctx *lml.TmplPageHeaderContext) {
-	l.ALT.PDF.AddHeader(*pageHeader)
+	l.ALT.PDF.AddHeader(*l.pageHeader)
 }
 
 func (l *LMLListener) EnterTmplPageFooter(ctx *lml.TmplPageFooterContext) {
-	buildingHeader = false
-	buildingFooter = true
-	pageFooter = new(template.Footer)
-	pageFooter.Parity = template.Both
-	buildingCenter = false
-	buildingLeft = false
-	buildingRight = false
+	l.buildingHeader = false
+	l.buildingFooter = true
+	l.pageFooter = new(template.Footer)
+	l.pageFooter.Parity = template.Both
+	l.buildingCenter = false
+	l.buildingLeft = false
+	l.buildingRight = false
 }
 
 func (l *LMLListener) ExitTmplPageFooter(ctx *lml.TmplPageFooterContext) {
-	l.ALT.PDF.AddFooter(*pageFooter)
+	l.ALT.PDF.AddFooter(*l.pageFooter)
 }
 
 func (l *LMLListener) EnterTmplPageHeaderEven(ctx *lml.TmplPageHeaderEvenContext) {
@@ -738,7 +782,9 @@ func (l *LMLListener) EnterTmplYear(ctx *lml.TmplYearContext) {
 			ctx.GetParser().NotifyErrorListeners(fmt.Sprintf("%s",err),ctx.INTEGER().GetSymbol(),nil)
 		}
 		l.ALT.Year = value
-		l.ALT.SetLDP()
+		if !l.inserted {
+			l.ALT.SetLDP()
+		}
 	}
 }
 
@@ -746,16 +792,6 @@ func (l *LMLListener) ExitTmplYear(ctx *lml.TmplYearContext) {
 	fmt.Print("")
 }
 
-// EnterBlock is called when production block is entered.
-func (l *LMLListener) EnterBlock(ctx *lml.BlockContext) {
-	fmt.Print("")
-}
-
-// ExitBlock is called when production block is exited.
-func (l *LMLListener) ExitBlock(ctx *lml.BlockContext) {
-	fmt.Print("")
-}
-
 // EnterSwitchBlock is called when production switchBlock is entered.
 func (l *LMLListener) EnterSwitchBlock(ctx *lml.SwitchBlockContext) {
 	fmt.Print("")
@@ -766,16 +802,6 @@ func (l *LMLListener) ExitSwitchBlock(ctx *lml.SwitchBlockContext) {
 	fmt.Print("")
 }
 
-// EnterSwitchBlockStatementGroup is called when production switchBlockStatementGroup is entered.
-func (l *LMLListener) EnterSwitchBlockStatementGroup(ctx *lml.SwitchBlockStatementGroupContext) {
-	fmt.Print("")
-}
-
-// ExitSwitchBlockStatementGroup is called when production switchBlockStatementGroup is exited.
-func (l *LMLListener) ExitSwitchBlockStatementGroup(ctx *lml.SwitchBlockStatementGroupContext) {
-	fmt.Print("")
-}
-
 // EnterSwitchLabel is called when production switchLabel is entered.
 func (l *LMLListener) EnterSwitchLabel(ctx *lml.SwitchLabelContext) {
 	fmt.Print("")
@@ -846,22 +872,3 @@ func (l *LMLListener) ExitMonthDay(ctx *lml.MonthDayContext) {
 	fmt.Print("")
 }
 
-// EnterExpression is called when production expression is entered.
-func (l *LMLListener) EnterExpression(ctx *lml.ExpressionContext) {
-	fmt.Println(ctx)
-}
-
-// ExitExpression is called when production expression is exited.
-func (l *LMLListener) ExitExpression(ctx *lml.ExpressionContext) {
-	fmt.Print("")
-}
-
-var pageHeader *template.Header
-var pageFooter *template.Footer
-var lookupDirective *template.PDFLookupDirective
-var paragraph *template.Paragraph
-var span *template.Span
-var pspan *template.Span
-var spans = arraystack.New()
-var pspans = arraystack.New()
-var buildingHeader, buildingFooter, buildingLeft, buildingCenter, buildingRight, buildingLookup bool
\ No newline at end of file
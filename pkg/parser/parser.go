@@ -2,7 +2,9 @@ package parser
 
 import (
 	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	lml "gitlab.com/ocmc/liturgiko/lml-go/parser"
+	"strings"
 )
 
 /**
@@ -20,26 +22,36 @@ type LML struct {
 // NewLMLParser provides an LML instance with a lexer and parser initialized for the input stream.
 // Returns an error if the database path is invalid or there is an error opening the database
 func NewLMLParser(templateID, input, dbPath string) (*LML, error) {
+	listener, err := NewLMLListener(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return newLML(templateID, input, listener), nil
+}
+// NewLMLParserWithStore provides an LML instance whose listener reads the liturgical texts from the store
+func NewLMLParserWithStore(templateID, input string, store ltxstore.LtxStore) *LML {
+	return newLML(templateID, input, NewLMLListenerWithStore(store))
+}
+func newLML(templateID, input string, listener *LMLListener) *LML {
 	l := new(LML)
-	var err error
 	l.TemplateID = templateID
 	l.Input = input
 	l.Lexer = lml.NewLMLLexer(antlr.NewInputStream(input))
 	stream := antlr.NewCommonTokenStream(l.Lexer, antlr.TokenDefaultChannel)
 	l.Parser = lml.NewLMLParser(stream)
-	l.Listener, err = NewLMLListener(dbPath)
-	if err != nil {
-		return nil, err
-	}
+	l.Listener = listener
+	l.Listener.inserting = append(l.Listener.inserting, strings.TrimSuffix(templateID, Extension))
 	l.ErrorListener = NewLMLErrorListener(templateID)
 	l.Parser.RemoveErrorListeners()
 	l.Parser.AddErrorListener(l.ErrorListener)
-	return l, nil
+	l.Listener.errors = l.ErrorListener
+	return l
 }
 // Performs a walk on the template parse tree starting at the root and going down recursively with depth-first search. On each node, EnterRule is called before recursively walking down into child nodes, then ExitRule is called after the recursive call to wind up.
 // Returns the Errors found in the input stream by the parser.
 // Note that antlr only returns an error of a specify type once.
 // So, there may be more errors than are reported by this function.
+// Use Validate instead to get all the errors and warnings of a template.
 func (l *LML) WalkTemplate()  []ParseError {
 	return l.walk(l.Parser.Template())
 }
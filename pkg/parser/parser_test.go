@@ -3,9 +3,14 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
 	"github.com/liturgiko/doxa/pkg/enums/statuses"
 	"github.com/liturgiko/doxa/pkg/enums/templateTypes"
+	"github.com/liturgiko/doxa/pkg/models"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -139,3 +144,251 @@ func TestLML_Tokens(t *testing.T) {
 		fmt.Println(e)
 	}
 }
+func TestConditions(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "Ιερεύς", "", ""))
+	// Wednesday, April 7, 2021 is in the fourth week of Great Lent, the 46th day of the Triodion
+	header := "ID = \"a/b\"\nType = \"service\"\nStatus = \"draft\"\nMonth = 4\nDay = 7\nYear = 2021\n"
+	data := []struct {
+		statement string
+		expected  []string
+	}{
+		{`if NameOfDay == Wed { p.yes nid "a" } else { p.no nid "b" }`, []string{"p.yes"}},
+		{`if NameOfDay != Wed { p.yes nid "a" } else { p.no nid "b" }`, []string{"p.no"}},
+		{`if MovableCycleDay == 46 && (Date == Mar 25 || ModeOfWeek < 9) { p.yes nid "a" }`, []string{"p.yes"}},
+		{`if MovableCycleDay < 46 || Date < Mar 31 || ModeOfWeek > = 9 { p.yes nid "a" } p.after nid "c"`, []string{"p.after"}},
+		{`if MovableCycleDay <= 46 { p.yes nid "a" } else if { p.no nid "b" }`, []string{"p.yes"}},
+		{`if Exists rid "actors/Priest" { p.yes nid "a" }`, []string{"p.yes"}},
+		{`if Exists rid "actors/Deacon" { p.yes nid "a" } else { if NameOfDay == Wed { p.nested nid "b" } }`, []string{"p.nested"}},
+		{`switch NameOfDay { case Sat, Sun: p.weekend nid "a" case Mon thru Fri: p.weekday nid "b" p.weekday2 nid "c" }`, []string{"p.weekday", "p.weekday2"}},
+		{`switch Date { case Mar 25: p.annunciation nid "a" case Jan 1 thru 10: p.january nid "b" default: p.other nid "c" }`, []string{"p.other"}},
+		{`if Date > Mar 31 && Date < Jun 1 { switch Date { case Mar 25, 31: p.march nid "a" default: p.april nid "b" } }`, []string{"p.april"}},
+		{`switch MovableCycleDay { case 1 thru 22: p.beforeLent nid "a" case 45, 47: { p.odd nid "b" } default: p.lent nid "c" }`, []string{"p.lent"}},
+		{`switch SundaysBeforeTriodion { case 99: p.never nid "a" }`, nil},
+		{`if MovableCycleDay > 70 { p.pentecostarion rid "tr.*/k" } else { p.no nid "b" }`, []string{"p.no"}},
+	}
+	for _, d := range data {
+		input := header + "{\n" + d.statement + "\n}"
+		l := NewLMLParserWithStore("a/b", input, store)
+		for _, e := range l.WalkTemplate() {
+			t.Errorf("%s: %s", d.statement, e.String())
+		}
+		var classes []string
+		for _, p := range l.Listener.ALT.Paragraphs {
+			classes = append(classes, p.Class)
+		}
+		if strings.Join(classes, " ") != strings.Join(d.expected, " ") {
+			t.Errorf("%s: expected paragraphs %v, got %v", d.statement, d.expected, classes)
+		}
+	}
+	l := NewLMLParserWithStore("a/b", header+"{ switch ModeOfWeek { case Mon: p.yes nid \"a\" } }", store)
+	if errors := l.WalkTemplate(); len(errors) != 1 || !strings.Contains(errors[0].Message, "does not match") {
+		t.Errorf("expected an error for a case of the wrong kind, got %v", errors)
+	}
+	l = NewLMLParserWithStore("a/b", header+"{ if Exists rid \"le.*/x\" { p.yes nid \"a\" } }", store)
+	if errors := l.WalkTemplate(); len(errors) != 1 || !strings.Contains(errors[0].Message, "le.book.part") {
+		t.Errorf("expected an error for a lectionary topic that is not le.book.part, got %v", errors)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	header := func(id, templateType string) string {
+		return "ID = \"" + id + "\"\nType = \"" + templateType + "\"\nStatus = \"draft\"\n"
+	}
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blocks := map[string]string{
+		"blocks/litany": header("blocks/litany", "block") + "{ p.litany1 nid \"a\" insert \"blocks/amen\" p.litany2 nid \"b\" }",
+		"blocks/amen":   header("blocks/amen", "block") + "{ if NameOfDay == Wed { p.amen nid \"a\" } }",
+		"blocks/cycle":  header("blocks/cycle", "block") + "{ p.cycle nid \"a\" insert \"blocks/cycle2\" }",
+		"blocks/cycle2": header("blocks/cycle2", "block") + "{ insert \"blocks/cycle\" }",
+		"blocks/bad":    header("blocks/bad", "block") + "{\np.bad nid \"a\"\ninsert \"blocks/missing\" }",
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "blocks"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for id, input := range blocks {
+		if err = ioutil.WriteFile(filepath.Join(dir, id+Extension), []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Wednesday, April 7, 2021
+	service := header("a/b", "service") + "Month = 4\nDay = 7\nYear = 2021\n"
+	data := []struct {
+		statements string
+		expected   []string
+		errors     []string
+	}{
+		{`p.before nid "a" insert "blocks/litany" p.after nid "b"`, []string{"p.before", "p.litany1", "p.amen", "p.litany2", "p.after"}, nil},
+		{`if NameOfDay == Sun { insert "blocks/litany" } p.after nid "b"`, []string{"p.after"}, nil},
+		{`insert "blocks/cycle"`, []string{"p.cycle"}, []string{"Template blocks/cycle2 Line 4 Column 9: insert cycle blocks/cycle -> blocks/cycle2 -> blocks/cycle"}},
+		{`insert "a/b"`, nil, []string{"Template a/b Line 8 Column 7: insert cycle a/b -> a/b"}},
+		{`insert "blocks/bad"`, []string{"p.bad"}, []string{"Template blocks/bad Line 6 Column 7: cannot insert blocks/missing"}},
+	}
+	for _, reader := range []TemplateReader{TemplateDir(dir), TemplateReaderFunc(func(id string) (string, error) {
+		if input, ok := blocks[id]; ok {
+			return input, nil
+		}
+		return "", fmt.Errorf("%s not found", id)
+	})} {
+		for _, d := range data {
+			l := NewLMLParserWithStore("a/b", service+"{\n"+d.statements+"\n}", store)
+			l.Listener.Templates = reader
+			errors := l.WalkTemplate()
+			if len(errors) != len(d.errors) {
+				t.Errorf("%s: expected errors %v, got %v", d.statements, d.errors, errors)
+			}
+			for i, e := range errors {
+				if i < len(d.errors) && !strings.HasPrefix(e.StringVerbose(), d.errors[i]) {
+					t.Errorf("%s: expected error %s, got %s", d.statements, d.errors[i], e.StringVerbose())
+				}
+			}
+			var classes []string
+			for _, p := range l.Listener.ALT.Paragraphs {
+				classes = append(classes, p.Class)
+			}
+			if strings.Join(classes, " ") != strings.Join(d.expected, " ") {
+				t.Errorf("%s: expected paragraphs %v, got %v", d.statements, d.expected, classes)
+			}
+			if l.Listener.ALT.ID != "a/b" {
+				t.Errorf("%s: expected the ID of the template to be a/b, got %s", d.statements, l.Listener.ALT.ID)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	store.Merge(models.NewLtx("gr_gr_cog", "actors", "Priest", "Ιερεύς", "", ""))
+	blocks := map[string]string{
+		"blocks/a": "ID = \"blocks/a\"\nType = \"block\"\nStatus = \"draft\"\n{\np.a sid \"actors/Deacon\" rid \"me.*/k\"\ninsert \"blocks/b\"\n}",
+		"blocks/b": "ID = \"blocks/b\"\nType = \"block\"\nStatus = \"draft\"\n{ insert \"blocks/a\" }",
+	}
+	input := "ID = \"a/b\"\nType = \"service\"\nStatus = \"drafty\"\n" +
+		"PageHeader = center @Lookup sid \"actors/Header\" lang 4\n{\n" +
+		"p.a sid \"actors/Reader\"\n" +
+		"p.b sid \"actors/Priest\" sid \"actors/Deacon\"\n" +
+		"if NameOfDay == Sun { p.c sid \"Priest\" rid \"oc.*/k\" @Mode 9 @Day 2 @Day 3 }\n" +
+		"p.d rid \"actors/Priest\" @Mode 1\n" +
+		"p.e p.f sid \"actors/Priest\"\n" +
+		"insert \"blocks/a\"\n" +
+		"insert \"blocks/a\"\n" +
+		"insert \"blocks/missing\"\n" +
+		"}"
+	l := NewLMLParserWithStore("a/b", input, store)
+	l.Listener.Templates = TemplateReaderFunc(func(id string) (string, error) {
+		if input, ok := blocks[id]; ok {
+			return input, nil
+		}
+		return "", fmt.Errorf("%s not found", id)
+	})
+	expected := []struct {
+		templateID   string
+		line, column int
+		severity     Severity
+		code         string
+	}{
+		{"a/b", 3, 9, SeverityError, CodeInvalidProperty},
+		{"a/b", 4, 0, SeverityWarning, CodeMissingDate},
+		{"a/b", 4, 32, SeverityError, CodeNotFound},
+		{"a/b", 4, 53, SeverityError, CodeInvalidLookup},
+		{"a/b", 6, 8, SeverityError, CodeNotFound},
+		{"a/b", 7, 28, SeverityError, CodeNotFound},
+		{"a/b", 8, 30, SeverityError, CodeInvalidID},
+		{"a/b", 8, 58, SeverityError, CodeInvalidOverride},
+		{"a/b", 8, 67, SeverityWarning, CodeDuplicateOverride},
+		{"a/b", 9, 8, SeverityError, CodeInvalidOverride},
+		{"a/b", 10, 4, SeverityError, CodeSyntax},
+		{"a/b", 13, 7, SeverityError, CodeInsertNotFound},
+		{"blocks/a", 5, 8, SeverityError, CodeNotFound},
+		{"blocks/b", 4, 9, SeverityError, CodeInsertCycle},
+	}
+	errors := l.Validate()
+	for i, e := range errors {
+		if i >= len(expected) {
+			t.Errorf("unexpected %s %s %s", e.StringVerbose(), e.Severity, e.Code)
+			continue
+		}
+		x := expected[i]
+		if e.TemplateID != x.templateID || e.Line != x.line || e.Column != x.column || e.Severity != x.severity || e.Code != x.code {
+			t.Errorf("expected %s %d:%d %s %s, got %s %s %s", x.templateID, x.line, x.column, x.severity, x.code, e.StringVerbose(), e.Severity, e.Code)
+		}
+	}
+	if len(errors) < len(expected) {
+		t.Errorf("expected %d errors, got %d", len(expected), len(errors))
+	}
+	// with a date, the relative topics of rids are looked for, and le.go.mc.* has no key k
+	l = NewLMLParserWithStore("a/b", "ID = \"a/b\"\nType = \"service\"\nStatus = \"draft\"\nMonth = 4\nDay = 7\nYear = 2021\n{\np.a rid \"le.go.mc.*/k\"\n}", store)
+	if errors = l.Validate(); len(errors) != 1 || errors[0].Line != 8 || errors[0].Code != CodeNotFound {
+		t.Errorf("expected the rid of a dated template to be not found, got %v", errors)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `// the liturgy
+ID = "a/b" // used as id
+Type = "service"
+Status = "draft"
+{ Year = 2021
+Month = 4 Day = 7
+Calendar = "Julian" }
+{
+p.actor sid "actors/Priest"   rid "oc.*/k" @Mode 1
+
+
+    p.dialog ( span.it sid "prayers/res04p" ) /* inline */ sid "a/b"
+if NameOfDay == Wed && ( MovableCycleDay < 46 || Exists rid "a/b" ) { p.yes nid "a" } else { p.no nid "b" }
+// before the switch
+switch NameOfDay { case Sat , Sun : p.weekend nid "a" case Mon thru Fri: p.weekday nid "b" p.weekday2 nid "c" }
+insert "blocks/x"
+}
+// the end
+`
+	expected := `// the liturgy
+ID = "a/b" // used as id
+Type = "service"
+Status = "draft"
+Calendar = "Julian"
+Month = 4
+Day = 7
+Year = 2021
+{
+	p.actor sid "actors/Priest" rid "oc.*/k" @Mode 1
+
+	p.dialog (span.it sid "prayers/res04p") /* inline */ sid "a/b"
+	if NameOfDay == Wed && (MovableCycleDay < 46 || Exists rid "a/b") {
+		p.yes nid "a"
+	} else {
+		p.no nid "b"
+	}
+	// before the switch
+	switch NameOfDay {
+		case Sat, Sun:
+			p.weekend nid "a"
+		case Mon thru Fri:
+			p.weekday nid "b"
+			p.weekday2 nid "c"
+	}
+	insert "blocks/x"
+}
+// the end
+`
+	formatted, errors := Format("a/b", input)
+	if len(errors) > 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	if formatted != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, formatted)
+	}
+	if again, _ := Format("a/b", formatted); again != formatted {
+		t.Errorf("formatting is not idempotent, got\n%s", again)
+	}
+	bad := "ID = \"a/b\"\nType = \"service\"\n{ p.a sid }"
+	if formatted, errors = Format("a/b", bad); formatted != bad || len(errors) == 0 {
+		t.Errorf("expected the template with syntax errors to be returned as it is, with the errors")
+	}
+}
@@ -0,0 +1,350 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/enums/statuses"
+	"github.com/liturgiko/doxa/pkg/enums/templateTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/template"
+	lml "gitlab.com/ocmc/liturgiko/lml-go/parser"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+Validate checks a template without generating from it.  Unlike the walk of the LMLListener,
+it checks every sid, rid, lookup, insert, override, and property on its own, whatever the
+conditions of the day, and returns all the errors and warnings sorted by template, line, and column,
+each with a Code that tools can use, e.g. to ignore a kind of warning.
+
+The errors reported by antlr while parsing have the code syntax.  Antlr stops reporting
+syntax errors while it recovers from one, so a syntax error can hide the ones after it
+until the parser is back in step, but the checks of the validator do not depend on each other.
+
+The templates that a template inserts are validated once each, with the liturgical day
+properties of the template that inserts them, and their errors have their own template ID.
+ */
+
+// Codes of the errors and warnings found by Validate
+const (
+	CodeSyntax            = "syntax"             // reported by antlr
+	CodeInvalidString     = "invalid-string"     // a string that cannot be unquoted
+	CodeInvalidProperty   = "invalid-property"   // e.g. Month = 13
+	CodeMissingDate       = "missing-date"       // warning: a service without a Month and Day
+	CodeInvalidID         = "invalid-id"         // a sid or rid that is not topic/key
+	CodeNotFound          = "not-found"          // a sid or rid whose topic and key are not in the database
+	CodeInvalidOverride   = "invalid-override"   // e.g. @Mode 9, or an override of a topic that is not of the Octoechos
+	CodeDuplicateOverride = "duplicate-override" // warning: e.g. @Mode 1 @Mode 2
+	CodeInvalidLookup     = "invalid-lookup"     // a lookup of a language other than 1, 2, or 3
+	CodeInsertNotFound    = "insert-not-found"   // an insert whose template cannot be read
+	CodeInsertNotChecked  = "insert-not-checked" // warning: an insert, when there is no TemplateReader
+	CodeInsertCycle       = "insert-cycle"       // an insert that inserts the template again
+)
+
+// Validate parses the template and returns all the errors and warnings in it and the templates it inserts,
+// sorted by template, line, and column.  It uses the store and Templates of the Listener.
+// Validate is an alternative to WalkTemplate: the parse tree can only be walked once per LML.
+func (l *LML) Validate() []ParseError {
+	v := newValidator(l.TemplateID, l.Listener.LtxMapper, l.Listener.Templates)
+	v.atem.Calendar = calendarTypes.Gregorian
+	errors := v.validate(l)
+	sort.SliceStable(errors, func(i, j int) bool {
+		a, b := errors[i], errors[j]
+		if a.TemplateID != b.TemplateID {
+			return a.TemplateID == l.TemplateID || (b.TemplateID != l.TemplateID && a.TemplateID < b.TemplateID)
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return errors
+}
+
+// validator is a listener that checks a template.  Its state belongs to one template.
+type validator struct {
+	lml.BaseLMLListener
+	templateID string
+	store      ltxstore.LtxStore
+	templates  TemplateReader
+	inserting  []string        // the IDs of the templates being validated, from the outermost, ending with templateID
+	validated  map[string]bool // the IDs of the inserted templates already validated, shared by all the validators
+	inserted   bool            // the template is inserted, so its liturgical day properties are those of the template that inserts it
+	atem       template.ATEM   // the properties of the template
+	dated      bool            // the template has a Month or Day, valid or not
+	errors     []ParseError
+}
+
+func newValidator(templateID string, store ltxstore.LtxStore, templates TemplateReader) *validator {
+	v := new(validator)
+	v.templateID = strings.TrimSuffix(templateID, Extension)
+	v.store = store
+	v.templates = templates
+	v.inserting = []string{v.templateID}
+	v.validated = make(map[string]bool)
+	return v
+}
+
+// validate parses the template of l and walks the tree, and returns the syntax errors and those found by the walk
+func (v *validator) validate(l *LML) []ParseError {
+	tree := l.Parser.Template()
+	for _, e := range l.ErrorListener.Errors {
+		e.Code = CodeSyntax
+		v.errors = append(v.errors, e)
+	}
+	antlr.ParseTreeWalkerDefault.Walk(v, tree)
+	return v.errors
+}
+
+func (v *validator) add(token antlr.Token, severity Severity, code, format string, a ...interface{}) {
+	v.errors = append(v.errors, ParseError{
+		TemplateID: v.templateID,
+		Line:       token.GetLine(),
+		Column:     token.GetColumn(),
+		Message:    fmt.Sprintf(format, a...),
+		Severity:   severity,
+		Code:       code,
+	})
+}
+
+// unquote returns the value of the string, or reports it and returns false
+func (v *validator) unquote(node antlr.TerminalNode) (string, bool) {
+	if node == nil {
+		return "", false
+	}
+	value, err := strconv.Unquote(node.GetText())
+	if err != nil {
+		v.add(node.GetSymbol(), SeverityError, CodeInvalidString, "%s: %v", node.GetText(), err)
+		return "", false
+	}
+	return value, true
+}
+
+// integer returns the value of the integer, or reports it and returns false
+func (v *validator) integer(node antlr.TerminalNode) (int, bool) {
+	if node == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(node.GetText())
+	if err != nil {
+		v.add(node.GetSymbol(), SeverityError, CodeInvalidProperty, "%v", err)
+		return 0, false
+	}
+	return n, true
+}
+
+func (v *validator) EnterTmplID(ctx *lml.TmplIDContext) {
+	if id, ok := v.unquote(ctx.STRING()); ok {
+		if !strings.Contains(id, "/") {
+			v.add(ctx.STRING().GetSymbol(), SeverityError, CodeInvalidProperty, "ID '%s' must have at least one forward slash", id)
+		}
+		v.atem.ID = id
+	}
+}
+
+func (v *validator) EnterTmplType(ctx *lml.TmplTypeContext) {
+	if raw, ok := v.unquote(ctx.STRING()); ok {
+		tmplType, err := templateTypes.TemplateTypeString(strings.Title(strings.ToLower(raw)))
+		if err != nil {
+			v.add(ctx.STRING().GetSymbol(), SeverityError, CodeInvalidProperty, "invalid template Type \"%s\", expected one of %s", raw, templateTypes.TemplateTypeValues())
+			return
+		}
+		v.atem.Type = tmplType
+	}
+}
+
+func (v *validator) EnterTmplStatus(ctx *lml.TmplStatusContext) {
+	if raw, ok := v.unquote(ctx.STRING()); ok {
+		if _, err := statuses.StatusString(strings.Title(strings.ToLower(raw))); err != nil {
+			v.add(ctx.STRING().GetSymbol(), SeverityError, CodeInvalidProperty, "invalid template Status \"%s\", expected one of %s", raw, statuses.StatusValues())
+		}
+	}
+}
+
+func (v *validator) EnterTmplCalendar(ctx *lml.TmplCalendarContext) {
+	if value, ok := v.unquote(ctx.STRING()); ok {
+		switch strings.ToLower(value) {
+		case "gregorian", "revised julian", "new":
+			v.atem.Calendar = calendarTypes.Gregorian
+		case "julian", "old":
+			v.atem.Calendar = calendarTypes.Julian
+		default:
+			v.add(ctx.STRING().GetSymbol(), SeverityError, CodeInvalidProperty, "invalid calendar type '%s'. Expected one of %v", value, calendarTypes.CalendarTypeValues())
+		}
+	}
+}
+
+func (v *validator) EnterTmplMonth(ctx *lml.TmplMonthContext) {
+	v.dated = true
+	if n, ok := v.integer(ctx.INTEGER()); ok {
+		if n < 1 || n > 12 {
+			v.add(ctx.INTEGER().GetSymbol(), SeverityError, CodeInvalidProperty, "invalid Month %d, expected value between 1 and 12", n)
+			return
+		}
+		v.atem.Month = n
+	}
+}
+
+func (v *validator) EnterTmplDay(ctx *lml.TmplDayContext) {
+	v.dated = true
+	if n, ok := v.integer(ctx.INTEGER()); ok {
+		if n < 1 || n > 31 {
+			v.add(ctx.INTEGER().GetSymbol(), SeverityError, CodeInvalidProperty, "invalid Day %d, expected value between 1 and 31", n)
+			return
+		}
+		v.atem.Day = n
+	}
+}
+
+func (v *validator) EnterTmplYear(ctx *lml.TmplYearContext) {
+	if n, ok := v.integer(ctx.INTEGER()); ok {
+		v.atem.Year = n
+	}
+}
+
+func (v *validator) EnterTmplHtmlCss(ctx *lml.TmplHtmlCssContext) {
+	v.unquote(ctx.STRING())
+}
+
+func (v *validator) EnterTmplPdfCss(ctx *lml.TmplPdfCssContext) {
+	v.unquote(ctx.STRING())
+}
+
+func (v *validator) EnterTmplTitle(ctx *lml.TmplTitleContext) {
+	v.unquote(ctx.STRING())
+}
+
+func (v *validator) EnterTmplPageNumber(ctx *lml.TmplPageNumberContext) {
+	v.integer(ctx.INTEGER())
+}
+
+// ExitPropertyBlock sets the liturgical day properties from the Month, Day, and Year,
+// which are used for the relative topics of rids
+func (v *validator) ExitPropertyBlock(ctx *lml.PropertyBlockContext) {
+	if v.inserted {
+		return
+	}
+	switch {
+	case v.atem.Month > 0 && v.atem.Day > 0:
+		if err := v.atem.SetLDP(); err != nil {
+			v.add(ctx.GetStart(), SeverityError, CodeInvalidProperty, "invalid date: %v", err)
+		}
+	case !v.dated && v.atem.Type == templateTypes.Service:
+		v.add(ctx.GetStart(), SeverityWarning, CodeMissingDate, "a service should have a Month and Day")
+	}
+}
+
+func (v *validator) EnterSid(ctx *lml.SidContext) {
+	if id, ok := v.unquote(ctx.STRING()); ok {
+		v.checkTopicKey(ctx.STRING().GetSymbol(), id, 0, 0)
+	}
+}
+
+func (v *validator) EnterRid(ctx *lml.RidContext) {
+	var mode, day int
+	for _, o := range ctx.AllOverride() {
+		override := o.(*lml.OverrideContext)
+		var node antlr.TerminalNode
+		var name string
+		var value *int
+		var max int
+		if m := override.OverrideMode(); m != nil {
+			node, name, value, max = m.(*lml.OverrideModeContext).INTEGER(), "@Mode", &mode, 8
+		} else if d := override.OverrideDay(); d != nil {
+			node, name, value, max = d.(*lml.OverrideDayContext).INTEGER(), "@Day", &day, 7
+		} else {
+			continue
+		}
+		n, ok := v.integer(node)
+		if !ok {
+			continue
+		}
+		if n < 1 || n > max {
+			v.add(node.GetSymbol(), SeverityError, CodeInvalidOverride, "expected a value between 1 and %d for %s, but got %d", max, name, n)
+			continue
+		}
+		if *value > 0 {
+			v.add(override.GetStart(), SeverityWarning, CodeDuplicateOverride, "%s is overridden more than once, the last is used", name)
+		}
+		*value = n
+	}
+	if id, ok := v.unquote(ctx.STRING()); ok {
+		if (mode > 0 || day > 0) && !strings.HasPrefix(id, "oc") {
+			v.add(ctx.STRING().GetSymbol(), SeverityError, CodeInvalidOverride, "rid directives (@Mode or @Day) may only be used for topics starting with 'oc' (i.e. Octoechos)")
+		}
+		v.checkTopicKey(ctx.STRING().GetSymbol(), id, mode, day)
+	}
+}
+
+// checkTopicKey reports an id that is not topic/key, or whose topic and key are not in the database.
+// The topic of a rid is relative to the liturgical day, so it is only looked for when the template,
+// or the template that inserts it, has a Month and Day.  A block has neither.
+func (v *validator) checkTopicKey(token antlr.Token, id string, mode, day int) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		v.add(token, SeverityError, CodeInvalidID, "'%s' must be topic/key, with one forward slash", id)
+		return
+	}
+	topic := parts[0]
+	if ldp.CheckTopic(topic) != nil {
+		v.add(token, SeverityError, CodeInvalidID, "the topic of '%s' must be le.book.part", id)
+		return
+	}
+	if strings.HasSuffix(topic, "*") || mode > 0 || day > 0 {
+		if v.atem.LDP.TheDay.IsZero() {
+			return
+		}
+		topic = v.atem.LDP.RelativeTopic(topic, mode, day)
+	}
+	if !v.store.ExistsTK(topic, parts[1]) {
+		v.add(token, SeverityError, CodeNotFound, "topic/key '%s' does not exist in the database", id)
+	}
+}
+
+func (v *validator) EnterLookup(ctx *lml.LookupContext) {
+	if n, err := strconv.Atoi(ctx.INTEGER().GetText()); err != nil || n < 1 || n > 3 {
+		v.add(ctx.INTEGER().GetSymbol(), SeverityError, CodeInvalidLookup, "invalid language number %s, expected 1, 2, or 3", ctx.INTEGER().GetText())
+	}
+}
+
+// EnterInsert checks that the inserted template can be read and is not already being inserted,
+// and validates it once
+func (v *validator) EnterInsert(ctx *lml.InsertContext) {
+	id, ok := v.unquote(ctx.STRING())
+	if !ok {
+		return
+	}
+	id = strings.TrimSuffix(id, Extension)
+	token := ctx.STRING().GetSymbol()
+	for i, inserting := range v.inserting {
+		if inserting == id {
+			cycle := append(append([]string{}, v.inserting[i:]...), id)
+			v.add(token, SeverityError, CodeInsertCycle, "insert cycle %s", strings.Join(cycle, " -> "))
+			return
+		}
+	}
+	if v.templates == nil {
+		v.add(token, SeverityWarning, CodeInsertNotChecked, "cannot check insert %s: no templates directory or database", id)
+		return
+	}
+	input, err := v.templates.ReadTemplate(id)
+	if err != nil {
+		v.add(token, SeverityError, CodeInsertNotFound, "cannot insert %s: %v", id, err)
+		return
+	}
+	if v.validated[id] {
+		return
+	}
+	v.validated[id] = true
+	child := newValidator(id, v.store, v.templates)
+	child.inserting = append(append([]string{}, v.inserting...), id)
+	child.validated = v.validated
+	child.inserted = true
+	child.atem.Calendar = v.atem.Calendar
+	child.atem.LDP = v.atem.LDP
+	v.errors = append(v.errors, child.validate(newLML(id, input, NewLMLListenerWithStore(v.store)))...)
+}
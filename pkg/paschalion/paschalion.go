@@ -0,0 +1,173 @@
+/**
+Package paschalion computes tables of the dates of the movable cycle, i.e. the dates that depend
+on Pascha, for a range of years, and provides helpers for date arithmetic relative to them.
+
+Pascha, and so the Triodion, Pentecost, and All Saints, always follow the Julian paschalion,
+so their civil dates are the same for both calendar types (see ldp.ComputeDayOfPascha).
+The calendar type changes what depends on the fixed cycle:
+the length of the Apostles' Fast, which ends on June 28 of the Menaion;
+the Sundays before the Triodion, which are counted after Theophany, January 6 of the Menaion;
+and the Lukan jump, which depends on the Elevation of the Cross, September 14 of the Menaion.
+ */
+package paschalion
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/lectionary"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Year holds the dates of the movable cycle of a year.  The dates are civil dates, yyyy-mm-dd.
+type Year struct {
+	Year                  int    `json:"year"`
+	TriodionStart         string `json:"triodionStart"` // the Sunday of the Publican and the Pharisee
+	CleanMonday           string `json:"cleanMonday"`
+	Pascha                string `json:"pascha"`
+	Ascension             string `json:"ascension"`
+	Pentecost             string `json:"pentecost"`
+	AllSaints             string `json:"allSaints"`
+	ApostlesFastDays      int    `json:"apostlesFastDays"`      // 0 if the Apostles' Fast is not kept
+	SundaysBeforeTriodion int    `json:"sundaysBeforeTriodion"` // the Sundays after Theophany and before the Triodion
+	LukanStart            string `json:"lukanStart"`            // the start of the Lukan cycle, in the autumn of the previous year
+	LukanJump             int    `json:"lukanJump"`             // the weeks of Luke skipped (> 0) or repeated (< 0) after Theophany
+}
+
+// Columns are the columns of a table written as csv
+var Columns = []string{"year", "triodionStart", "cleanMonday", "pascha", "ascension", "pentecost", "allSaints",
+	"apostlesFastDays", "sundaysBeforeTriodion", "lukanStart", "lukanJump"}
+
+// Table holds the dates of the movable cycle for a range of years
+type Table struct {
+	Calendar calendarTypes.CalendarType `json:"calendar"`
+	Years    []Year                     `json:"years"`
+}
+
+// NewYear computes the dates of the movable cycle of the year
+func NewYear(year int, calendarType calendarTypes.CalendarType) (Year, error) {
+	// the liturgical day properties of the Triodion start give the start of the Lukan cycle
+	triodionStart := ldp.ComputeDayOfPascha(year, calendarType).AddDate(0, 0, -70)
+	l, err := ldp.Compute(triodionStart, calendarType)
+	if err != nil {
+		return Year{}, err
+	}
+	pascha := l.PaschaDateThisYear
+	allSaints := l.AllSaintsDateThisYear
+	y := Year{
+		Year:          year,
+		TriodionStart: format(triodionStart),
+		CleanMonday:   format(l.GreatLentStartDate),
+		Pascha:        format(pascha),
+		Ascension:     format(pascha.AddDate(0, 0, 39)),
+		Pentecost:     format(l.PentecostDate),
+		AllSaints:     format(allSaints),
+		LukanStart:    format(l.StartDateOfLukanCycleLast),
+	}
+	if days := DaysBetween(allSaints, ldp.CivilDate(year, 6, 28, calendarType)); days > 0 {
+		y.ApostlesFastDays = days
+	}
+	theophany := ldp.CivilDate(year, 1, 6, calendarType)
+	for sunday := SundayOnOrAfter(theophany.AddDate(0, 0, 1)); sunday.Before(triodionStart); sunday = sunday.AddDate(0, 0, 7) {
+		y.SundaysBeforeTriodion++
+	}
+	// the Lukan cycle starts on a Monday, so the days from its start through the start of the Triodion are whole weeks
+	y.LukanJump = (DaysBetween(l.StartDateOfLukanCycleLast, triodionStart.AddDate(0, 0, 1)) - lectionary.LukanCycleDays) / 7
+	return y, nil
+}
+
+// NewTable computes the dates of the movable cycle of the years from first through last
+func NewTable(first, last int, calendarType calendarTypes.CalendarType) (*Table, error) {
+	if last < first {
+		return nil, fmt.Errorf("the last year %d is before the first year %d", last, first)
+	}
+	t := &Table{Calendar: calendarType}
+	for year := first; year <= last; year++ {
+		y, err := NewYear(year, calendarType)
+		if err != nil {
+			return nil, err
+		}
+		t.Years = append(t.Years, y)
+	}
+	return t, nil
+}
+
+// WriteJSON writes the table as indented json
+func (t *Table) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// WriteCSV writes the table as csv, with a header row of the Columns
+func (t *Table) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, y := range t.Years {
+		err := writer.Write([]string{
+			strconv.Itoa(y.Year), y.TriodionStart, y.CleanMonday, y.Pascha, y.Ascension, y.Pentecost, y.AllSaints,
+			strconv.Itoa(y.ApostlesFastDays), strconv.Itoa(y.SundaysBeforeTriodion), y.LukanStart, strconv.Itoa(y.LukanJump),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// DaysBetween returns the number of days from the date from to the date to, negative if to is before from
+func DaysBetween(from, to time.Time) int {
+	from = ldp.NewDate(from.Year(), int(from.Month()), from.Day())
+	to = ldp.NewDate(to.Year(), int(to.Month()), to.Day())
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// SundayOnOrAfter returns the date, if it is a Sunday, or the Sunday after it
+func SundayOnOrAfter(date time.Time) time.Time {
+	return date.AddDate(0, 0, (7-int(date.Weekday()))%7)
+}
+
+// SundayOnOrBefore returns the date, if it is a Sunday, or the Sunday before it
+func SundayOnOrBefore(date time.Time) time.Time {
+	return date.AddDate(0, 0, -int(date.Weekday()))
+}
+
+// SundayAfterPentecost returns N for the Nth Sunday after Pentecost on or before the date,
+// e.g. 1 for the Sunday of All Saints, and true, or false if the date is in the Triodion
+// or the Pentecostarion, i.e. from the Sunday of the Publican and the Pharisee through Pentecost.
+func SundayAfterPentecost(date time.Time) (int, bool) {
+	pascha := ldp.ComputeDayOfPascha(date.Year(), calendarTypes.Gregorian)
+	pentecost := pascha.AddDate(0, 0, 49)
+	if DaysBetween(pascha.AddDate(0, 0, -70), date) >= 0 && DaysBetween(pentecost, date) <= 0 {
+		return 0, false
+	}
+	if DaysBetween(pentecost, date) < 0 {
+		pentecost = ldp.ComputeDayOfPascha(date.Year()-1, calendarTypes.Gregorian).AddDate(0, 0, 49)
+	}
+	return DaysBetween(pentecost, SundayOnOrBefore(date)) / 7, true
+}
+
+// SundayOfLent returns N for the Nth Sunday of Great Lent, from 1 for the Sunday of Orthodoxy
+// through 5, and true, or false if the date is not a Sunday of Great Lent.
+func SundayOfLent(date time.Time) (int, bool) {
+	if date.Weekday() != time.Sunday {
+		return 0, false
+	}
+	days := DaysBetween(date, ldp.ComputeDayOfPascha(date.Year(), calendarTypes.Gregorian))
+	if days%7 != 0 || days < 14 || days > 42 {
+		return 0, false
+	}
+	return 7 - days/7, true
+}
+
+func format(t time.Time) string {
+	return t.Format("2006-01-02")
+}
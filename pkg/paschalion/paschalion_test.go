@@ -0,0 +1,79 @@
+package paschalion
+
+import (
+	"bytes"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewYear(t *testing.T) {
+	data := []struct {
+		year         int
+		calendarType calendarTypes.CalendarType
+		expected     Year
+	}{
+		{2020, calendarTypes.Gregorian, Year{2020, "2020-02-09", "2020-03-02", "2020-04-19", "2020-05-28", "2020-06-07", "2020-06-14", 14, 4, "2019-09-16", 4}},
+		{2020, calendarTypes.Julian, Year{2020, "2020-02-09", "2020-03-02", "2020-04-19", "2020-05-28", "2020-06-07", "2020-06-14", 27, 2, "2019-09-30", 2}},
+		{2024, calendarTypes.Gregorian, Year{2024, "2024-02-25", "2024-03-18", "2024-05-05", "2024-06-13", "2024-06-23", "2024-06-30", 0, 7, "2023-09-18", 6}},
+	}
+	for _, d := range data {
+		y, err := NewYear(d.year, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if y != d.expected {
+			t.Errorf("%d %s: expected %+v, got %+v", d.year, d.calendarType, d.expected, y)
+		}
+	}
+	if _, err := NewTable(2021, 2020, calendarTypes.Gregorian); err == nil {
+		t.Errorf("expected an error when the last year is before the first")
+	}
+	table, err := NewTable(2020, 2024, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = table.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 || lines[0] != strings.Join(Columns, ",") || !strings.HasPrefix(lines[5], "2024,2024-02-25,") {
+		t.Errorf("unexpected csv %s", buf.String())
+	}
+}
+
+func TestSundayAfterPentecost(t *testing.T) {
+	data := []struct {
+		year, month, day int
+		expected         int
+		ok               bool
+	}{
+		{2020, 6, 14, 1, true},   // All Saints
+		{2020, 6, 17, 1, true},   // the Wednesday after
+		{2020, 12, 27, 29, true}, // the Sunday after the Nativity
+		{2021, 2, 14, 36, true},  // the Sunday before the Triodion
+		{2021, 2, 21, 0, false},  // the Publican and the Pharisee
+		{2021, 6, 20, 0, false},  // Pentecost
+	}
+	for _, d := range data {
+		n, ok := SundayAfterPentecost(ldp.NewDate(d.year, d.month, d.day))
+		if n != d.expected || ok != d.ok {
+			t.Errorf("%d-%d-%d: expected %d %v, got %d %v", d.year, d.month, d.day, d.expected, d.ok, n, ok)
+		}
+	}
+}
+
+func TestSundayOfLent(t *testing.T) {
+	for date, expected := range map[string]int{"2021-03-21": 1, "2021-04-18": 5, "2021-04-25": 0, "2021-03-22": 0} {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := SundayOfLent(d); n != expected {
+			t.Errorf("%s: expected Sunday of Lent %d, got %d", date, expected, n)
+		}
+	}
+}
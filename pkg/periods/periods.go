@@ -0,0 +1,234 @@
+/**
+Package periods names the liturgical periods and days of the liturgical day, e.g.
+"Fourth Week of Great Lent", "Wednesday of the Fourth Week of Great Lent", and "Afterfeast of Theophany",
+in the language of a library, for titles and headers.
+
+The names are the records of the topic periods in a library, whose keys are those of ldp.Period, e.g.
+
+  periods/greatLent = "{week} Week of Great Lent"
+  periods/greatLent.sunday = "{week} Sunday of Great Lent"
+  periods/theophany.afterfeast = "Afterfeast of Theophany"
+
+and whose values may have the placeholders:
+  {week}      the ordinal of the week of the period, the value of the key ordinal.N, e.g. ordinal.4 = "Fourth"
+  {day}       the name of the day of the week, the value of the key day.sunday, day.monday, etc.
+  {period}    the name of the period
+
+The name of a day of a period is the value of the key of the period followed by .sunday, .monday, etc.,
+if the library has it, or else of the key dayOfPeriod, e.g. "{day} of the {period}".
+The name of a day that is a period of one day, e.g. Pascha, is the name of the period.
+The name of the day of the Lukan cycle is the value of the key lukanCycleWeekDay.
+
+If a library does not have a key, the value of the Fallback library of the Service is used, if it has one.
+A key that neither has is reported in Names.Missing, and its name is the key itself,
+or for an ordinal, the number, so that the names of one language are not mixed with those of another.
+Names.MissingFor returns only the missing keys of one of the names, e.g. of the Day.
+ */
+package periods
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"strconv"
+	"strings"
+)
+
+// Topic is the topic of the records that hold the names
+const Topic = "periods"
+
+// Keys of the names that are not the keys of periods
+const (
+	OrdinalPrefix        = "ordinal."
+	DayPrefix            = "day."
+	KeyDayOfPeriod       = "dayOfPeriod"
+	KeyLukanCycleWeekDay = "lukanCycleWeekDay"
+)
+
+// Placeholders in the names
+const (
+	WeekPlaceholder   = "{week}"
+	DayPlaceholder    = "{day}"
+	PeriodPlaceholder = "{period}"
+)
+
+// Names of the values of Names, as in its json, for MissingFor
+const (
+	NamePeriodNames       = "periodNames"
+	NameDay               = "day"
+	NameLukanCycleWeekDay = "lukanCycleWeekDay"
+)
+
+// days are the names of the days of the week used in keys, from Sunday
+var days = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// Names holds the names of the periods and the day of a date in a library
+type Names struct {
+	Date              string       `json:"date"`
+	Library           string       `json:"library"`
+	Periods           []ldp.Period `json:"periods"`
+	PeriodNames       []string     `json:"periodNames"`       // the names of the Periods, in the same order
+	Day               string       `json:"day"`               // the name of the day in the period of the movable cycle
+	LukanCycleWeekDay string       `json:"lukanCycleWeekDay"` // e.g. Wednesday of the Fourth Week of Luke
+	Missing           []string     `json:"missing,omitempty"` // the keys used that neither the library nor the fallback has
+	missingFor        map[string][]string
+}
+
+// MissingFor returns the keys that neither the library nor the fallback has, of the name
+// NamePeriodNames, NameDay, or NameLukanCycleWeekDay
+func (n *Names) MissingFor(name string) []string {
+	return n.missingFor[name]
+}
+
+// Service names periods and days using the records of a store
+type Service struct {
+	store ltxstore.LtxStore
+	// Fallback is the library whose names are used for the keys that a library does not have, e.g. en_us_goa.
+	// If it is empty, there is no fallback.
+	Fallback string
+}
+
+// NewService returns a service that reads the names from the store
+func NewService(store ltxstore.LtxStore) *Service {
+	return &Service{store: store}
+}
+
+// Names returns the names of the periods and the day of the liturgical day in the library
+func (s *Service) Names(l *ldp.LDP, library string) (*Names, error) {
+	values, err := s.read(library)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Fallback) > 0 && s.Fallback != library {
+		fallback, err := s.read(s.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		values.fallback = fallback.library
+	}
+	names := &Names{
+		Date:       l.TheDay.Format("2006-01-02"),
+		Library:    library,
+		Periods:    l.Periods(),
+		missingFor: make(map[string][]string),
+	}
+	day := days[l.TheDay.Weekday()]
+	for i, p := range names.Periods {
+		name := values.expand(values.get(p.Key), p.Week, "", "")
+		names.PeriodNames = append(names.PeriodNames, name)
+		missing := values.take()
+		names.missingFor[NamePeriodNames] = append(names.missingFor[NamePeriodNames], missing...)
+		if i > 0 {
+			continue
+		}
+		// the name of the day includes the name of its period
+		switch {
+		case p.OneDay:
+			names.Day = name
+		case values.has(p.Key + "." + day):
+			names.Day = values.expand(values.get(p.Key+"."+day), p.Week, day, name)
+		default:
+			names.Day = values.expand(values.get(KeyDayOfPeriod), p.Week, day, name)
+		}
+		names.missingFor[NameDay] = append(missing, values.take()...)
+	}
+	names.LukanCycleWeekDay = values.expand(values.get(KeyLukanCycleWeekDay), l.LukanCycleWeek(), day, "")
+	names.missingFor[NameLukanCycleWeekDay] = values.take()
+	names.Missing = values.missing
+	return names, nil
+}
+
+// values are the names in a library and in its fallback, by key, the keys used that neither has,
+// and those of them used since the last take
+type values struct {
+	library  map[string]string
+	fallback map[string]string
+	missing  []string
+	taken    []string
+}
+
+// read returns the names in the library, with redirects resolved
+func (s *Service) read(library string) (*values, error) {
+	records, err := s.store.ReadByLT(library, Topic, true)
+	if err != nil {
+		return nil, err
+	}
+	v := &values{library: make(map[string]string)}
+	for _, record := range records {
+		value := record.Value
+		if len(record.Redirect) > 0 {
+			to, _, err := ltxstore.Resolve(s.store, record.ID)
+			if err != nil {
+				return nil, err
+			}
+			value = to.Value
+		}
+		if len(value) > 0 {
+			v.library[record.Key] = value
+		}
+	}
+	return v, nil
+}
+
+func (v *values) has(key string) bool {
+	if _, ok := v.library[key]; ok {
+		return true
+	}
+	_, ok := v.fallback[key]
+	return ok
+}
+
+// get returns the value of the key in the library, or else in the fallback, or else the key, which is reported missing
+func (v *values) get(key string) string {
+	if value, ok := v.library[key]; ok {
+		return value
+	}
+	if value, ok := v.fallback[key]; ok {
+		return value
+	}
+	v.miss(key)
+	return key
+}
+
+func (v *values) miss(key string) {
+	v.missing = appendNew(v.missing, key)
+	v.taken = appendNew(v.taken, key)
+}
+
+// take returns the keys missed since it was last called
+func (v *values) take() []string {
+	taken := v.taken
+	v.taken = nil
+	return taken
+}
+
+// appendNew appends the key to the keys, unless they have it
+func appendNew(keys []string, key string) []string {
+	for _, k := range keys {
+		if k == key {
+			return keys
+		}
+	}
+	return append(keys, key)
+}
+
+// expand replaces the placeholders in the name with the ordinal of the week, the name of the day, and the period
+func (v *values) expand(name string, week int, day, period string) string {
+	if strings.Contains(name, WeekPlaceholder) {
+		name = strings.ReplaceAll(name, WeekPlaceholder, v.ordinal(week))
+	}
+	if len(day) > 0 && strings.Contains(name, DayPlaceholder) {
+		name = strings.ReplaceAll(name, DayPlaceholder, v.get(DayPrefix+day))
+	}
+	return strings.ReplaceAll(name, PeriodPlaceholder, period)
+}
+
+// ordinal returns the name of the ordinal n in the library, e.g. Fourth,
+// or if neither the library nor the fallback has it, the number, e.g. 24
+func (v *values) ordinal(n int) string {
+	key := OrdinalPrefix + strconv.Itoa(n)
+	if v.has(key) {
+		return v.get(key)
+	}
+	v.miss(key)
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,237 @@
+package periods
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/models"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// english are the names of en_us_goa
+var english = map[string]string{
+	ldp.PeriodPublican:        "Week of the Publican and the Pharisee",
+	ldp.PeriodProdigal:        "Week of the Prodigal Son",
+	ldp.PeriodMeatfare:        "Meatfare Sunday",
+	ldp.PeriodCheesefare:      "Cheesefare Week",
+	ldp.PeriodGreatLent:       "{week} Week of Great Lent",
+	"greatLent.sunday":        "{week} Sunday of Great Lent",
+	ldp.PeriodLazarusSaturday: "Lazarus Saturday",
+	ldp.PeriodPalmSunday:      "Palm Sunday",
+	ldp.PeriodHolyWeek:        "Holy Week",
+	"holyWeek.monday":         "Holy Monday",
+	"holyWeek.tuesday":        "Holy Tuesday",
+	"holyWeek.wednesday":      "Holy Wednesday",
+	"holyWeek.thursday":       "Holy Thursday",
+	"holyWeek.friday":         "Holy Friday",
+	"holyWeek.saturday":       "Holy Saturday",
+	ldp.PeriodPascha:          "Pascha",
+	ldp.PeriodBrightWeek:      "Bright Week",
+	"brightWeek.monday":       "Bright Monday",
+	"brightWeek.tuesday":      "Bright Tuesday",
+	"brightWeek.wednesday":    "Bright Wednesday",
+	"brightWeek.thursday":     "Bright Thursday",
+	"brightWeek.friday":       "Bright Friday",
+	"brightWeek.saturday":     "Bright Saturday",
+	ldp.PeriodAfterPascha:     "{week} Week of Pascha",
+	"afterPascha.sunday":      "{week} Sunday of Pascha",
+	ldp.PeriodPentecost:       "Pentecost",
+	ldp.PeriodAfterPentecost:  "{week} Week after Pentecost",
+	"afterPentecost.sunday":   "{week} Sunday after Pentecost",
+
+	"midPentecost":                    "Mid-Pentecost",
+	"midPentecost.afterfeast":         "Afterfeast of Mid-Pentecost",
+	"midPentecost.leavetaking":        "Leave-taking of Mid-Pentecost",
+	"ascension":                       "Ascension",
+	"ascension.afterfeast":            "Afterfeast of the Ascension",
+	"ascension.leavetaking":           "Leave-taking of the Ascension",
+	"nativityOfTheotokos":             "Nativity of the Theotokos",
+	"nativityOfTheotokos.forefeast":   "Forefeast of the Nativity of the Theotokos",
+	"nativityOfTheotokos.afterfeast":  "Afterfeast of the Nativity of the Theotokos",
+	"nativityOfTheotokos.leavetaking": "Leave-taking of the Nativity of the Theotokos",
+	"elevationOfCross":                "Elevation of the Cross",
+	"elevationOfCross.forefeast":      "Forefeast of the Elevation of the Cross",
+	"elevationOfCross.afterfeast":     "Afterfeast of the Elevation of the Cross",
+	"elevationOfCross.leavetaking":    "Leave-taking of the Elevation of the Cross",
+	"entranceOfTheotokos":             "Entrance of the Theotokos",
+	"entranceOfTheotokos.forefeast":   "Forefeast of the Entrance of the Theotokos",
+	"entranceOfTheotokos.afterfeast":  "Afterfeast of the Entrance of the Theotokos",
+	"entranceOfTheotokos.leavetaking": "Leave-taking of the Entrance of the Theotokos",
+	"nativityOfChrist":                "Nativity of Christ",
+	"nativityOfChrist.forefeast":      "Forefeast of the Nativity of Christ",
+	"nativityOfChrist.afterfeast":     "Afterfeast of the Nativity of Christ",
+	"nativityOfChrist.leavetaking":    "Leave-taking of the Nativity of Christ",
+	"theophany":                       "Theophany",
+	"theophany.forefeast":             "Forefeast of Theophany",
+	"theophany.afterfeast":            "Afterfeast of Theophany",
+	"theophany.leavetaking":           "Leave-taking of Theophany",
+	"meetingOfLord":                   "Meeting of the Lord",
+	"meetingOfLord.forefeast":         "Forefeast of the Meeting of the Lord",
+	"meetingOfLord.afterfeast":        "Afterfeast of the Meeting of the Lord",
+	"meetingOfLord.leavetaking":       "Leave-taking of the Meeting of the Lord",
+	"annunciation":                    "Annunciation",
+	"annunciation.forefeast":          "Forefeast of the Annunciation",
+	"annunciation.afterfeast":         "Afterfeast of the Annunciation",
+	"annunciation.leavetaking":        "Leave-taking of the Annunciation",
+	"transfiguration":                 "Transfiguration",
+	"transfiguration.forefeast":       "Forefeast of the Transfiguration",
+	"transfiguration.afterfeast":      "Afterfeast of the Transfiguration",
+	"transfiguration.leavetaking":     "Leave-taking of the Transfiguration",
+	"dormition":                       "Dormition of the Theotokos",
+	"dormition.forefeast":             "Forefeast of the Dormition of the Theotokos",
+	"dormition.afterfeast":            "Afterfeast of the Dormition of the Theotokos",
+	"dormition.leavetaking":           "Leave-taking of the Dormition of the Theotokos",
+
+	KeyDayOfPeriod:       "{day} of the {period}",
+	KeyLukanCycleWeekDay: "{day} of the {week} Week of Luke",
+	"day.sunday":         "Sunday",
+	"day.monday":         "Monday",
+	"day.tuesday":        "Tuesday",
+	"day.wednesday":      "Wednesday",
+	"day.thursday":       "Thursday",
+	"day.friday":         "Friday",
+	"day.saturday":       "Saturday",
+	"ordinal.1":          "First",
+	"ordinal.2":          "Second",
+	"ordinal.3":          "Third",
+	"ordinal.4":          "Fourth",
+	"ordinal.5":          "Fifth",
+	"ordinal.6":          "Sixth",
+	"ordinal.7":          "Seventh",
+	"ordinal.8":          "Eighth",
+	"ordinal.9":          "Ninth",
+	"ordinal.10":         "Tenth",
+}
+
+func init() {
+	for n := 11; n <= 40; n++ {
+		suffix := "th"
+		switch {
+		case n%100 >= 11 && n%100 <= 13:
+		case n%10 == 1:
+			suffix = "st"
+		case n%10 == 2:
+			suffix = "nd"
+		case n%10 == 3:
+			suffix = "rd"
+		}
+		english[OrdinalPrefix+strconv.Itoa(n)] = strconv.Itoa(n) + suffix
+	}
+}
+
+func TestNames(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	for key, value := range english {
+		store.Merge(models.NewLtx("en_us_goa", Topic, key, value, "", ""))
+	}
+	for _, r := range []struct {
+		library, key, value, redirect string
+	}{
+		{"gr_gr_cog", "greatLent", "Εβδομάδα {week} των Νηστειών", ""},
+		{"gr_gr_cog", "greatLent.wednesday", "Τετάρτη της {week} Εβδομάδος των Νηστειών", ""},
+		{"gr_gr_cog", "ordinal.4", "Δ΄", ""},
+		{"gr_gr_cog", "theophany.afterfeast", "Μεθέορτα των Θεοφανείων", ""},
+		{"en_us_dedes", "theophany.afterfeast", "", "en_us_goa/periods/theophany.afterfeast"},
+		{"en_us_goa", "theophany.afterfeast", "After-feast of the Theophany", ""},
+		{"en_us_dedes", "afterPentecost", "{week} Week after Pentecost", ""},
+		{"en_us_dedes", "afterPentecost.sunday", "", "en_us_goa/periods/afterPentecost.sunday"},
+		{"en_us_dedes", "ordinal.31", "", "en_us_goa/periods/ordinal.31"},
+	} {
+		store.Merge(models.NewLtx(r.library, Topic, r.key, r.value, "", r.redirect))
+	}
+	service := NewService(store)
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		library          string
+		periods          []string
+		dayName          string
+		missing          []string
+	}{
+		{2021, 4, 7, calendarTypes.Gregorian, "en_us_goa", []string{"Fourth Week of Great Lent"}, "Wednesday of the Fourth Week of Great Lent", nil},
+		{2021, 4, 7, calendarTypes.Gregorian, "gr_gr_cog", []string{"Εβδομάδα Δ΄ των Νηστειών"}, "Τετάρτη της Δ΄ Εβδομάδος των Νηστειών", []string{KeyLukanCycleWeekDay}},
+		{2021, 4, 4, calendarTypes.Gregorian, "en_us_goa", []string{"Third Week of Great Lent"}, "Third Sunday of Great Lent", nil},
+		{2021, 4, 30, calendarTypes.Gregorian, "en_us_goa", []string{"Holy Week"}, "Holy Friday", nil},
+		{2021, 5, 2, calendarTypes.Gregorian, "en_us_goa", []string{"Pascha"}, "Pascha", nil},
+		{2021, 5, 9, calendarTypes.Gregorian, "en_us_goa", []string{"Second Week of Pascha"}, "Second Sunday of Pascha", nil},
+		{2021, 6, 10, calendarTypes.Gregorian, "en_us_goa", []string{"Sixth Week of Pascha", "Ascension"}, "Thursday of the Sixth Week of Pascha", nil},
+		{2021, 1, 10, calendarTypes.Gregorian, "en_us_goa", []string{"31st Week after Pentecost", "After-feast of the Theophany"}, "31st Sunday after Pentecost", nil},
+		{2021, 1, 10, calendarTypes.Gregorian, "en_us_dedes", []string{"31st Week after Pentecost", "After-feast of the Theophany"}, "31st Sunday after Pentecost", []string{KeyLukanCycleWeekDay}},
+		{2021, 1, 10, calendarTypes.Gregorian, "gr_gr_cog", []string{"afterPentecost", "Μεθέορτα των Θεοφανείων"}, KeyDayOfPeriod, []string{"afterPentecost", KeyDayOfPeriod, KeyLukanCycleWeekDay}},
+		{2020, 12, 31, calendarTypes.Gregorian, "en_us_goa", []string{"30th Week after Pentecost", "Leave-taking of the Nativity of Christ"}, "Thursday of the 30th Week after Pentecost", nil},
+		{2021, 1, 2, calendarTypes.Gregorian, "en_us_goa", []string{"30th Week after Pentecost", "Forefeast of Theophany"}, "Saturday of the 30th Week after Pentecost", nil},
+		{2021, 1, 20, calendarTypes.Julian, "en_us_goa", []string{"33rd Week after Pentecost", "After-feast of the Theophany"}, "Wednesday of the 33rd Week after Pentecost", nil},
+	}
+	for _, d := range data {
+		l, err := ldp.NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, err := service.Names(&l, d.library)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names.PeriodNames) != len(d.periods) {
+			t.Errorf("%s %s %s: expected periods %v, got %v", names.Date, d.calendarType, d.library, d.periods, names.PeriodNames)
+			continue
+		}
+		for i, name := range names.PeriodNames {
+			if name != d.periods[i] {
+				t.Errorf("%s %s %s: expected period %s, got %s", names.Date, d.calendarType, d.library, d.periods[i], name)
+			}
+		}
+		if names.Day != d.dayName {
+			t.Errorf("%s %s %s: expected day %s, got %s", names.Date, d.calendarType, d.library, d.dayName, names.Day)
+		}
+		if strings.Join(names.Missing, " ") != strings.Join(d.missing, " ") {
+			t.Errorf("%s %s %s: expected missing %v, got %v", names.Date, d.calendarType, d.library, d.missing, names.Missing)
+		}
+	}
+	// the missing keys of each name are only those it uses
+	l, err := ldp.NewLDPYMD(2021, 1, 10, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := service.Names(&l, "gr_gr_cog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string][]string{
+		NamePeriodNames:       {"afterPentecost"},
+		NameDay:               {"afterPentecost", KeyDayOfPeriod},
+		NameLukanCycleWeekDay: {KeyLukanCycleWeekDay},
+	} {
+		if got := names.MissingFor(name); strings.Join(got, " ") != strings.Join(expected, " ") {
+			t.Errorf("%s: expected missing %v, got %v", name, expected, got)
+		}
+	}
+	// with a fallback library, the names the library does not have are those of the fallback
+	service.Fallback = "en_us_goa"
+	names, err = service.Names(&l, "gr_gr_cog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names.Day != "31st Sunday after Pentecost" || len(names.Missing) > 0 {
+		t.Errorf("expected the day of the fallback and no missing keys, got %s %v", names.Day, names.Missing)
+	}
+}
+
+func TestLukanCycleWeekDay(t *testing.T) {
+	l, err := ldp.NewLDPYMD(2020, 10, 14, calendarTypes.Gregorian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := ltx2mem.NewLtxMapper()
+	for key, value := range english {
+		store.Merge(models.NewLtx("en_us_goa", Topic, key, value, "", ""))
+	}
+	names, err := NewService(store).Names(&l, "en_us_goa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Wednesday of the Fourth Week of Luke"; names.LukanCycleWeekDay != expected {
+		t.Errorf("expected %s, got %s", expected, names.LukanCycleWeekDay)
+	}
+}
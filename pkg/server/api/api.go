@@ -6,10 +6,10 @@
 package api
 
 import (
-	"database/sql"
 	"github.com/gorilla/mux"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"html/template"
 	"log"
 	"net/http"
@@ -17,7 +17,7 @@ import (
 )
 
 type server struct {
-	ltxMapper *ltx2sql.LtxMapper // there should be a map of mappers here
+	ltxMapper ltxstore.LtxStore // there should be a map of mappers here
 	router    *mux.Router
 	api       *mux.Router
 	api1      *mux.Router
@@ -54,15 +54,19 @@ func Serve(dbname, port string) {
 	var err error
 
 	// open the database
-	db, err := sql.Open("sqlite3", dbname)
+	mapper, err := ltx2sql.NewLtxMapper(dbname)
 	if err != nil {
 		log.Println(err.Error())
+		return
 	}
-	defer db.Close()
-	mapper := ltx2sql.LtxMapper{}
-	mapper.DB = db
+	defer mapper.Close()
+	log.Printf("doxa db is at %s\n", dbname)
+	ServeStore(mapper, port)
+}
+// ServeStore serves the api using the supplied store for liturgical texts
+func ServeStore(store ltxstore.LtxStore, port string) {
 	srv := server{}
-	srv.ltxMapper = &mapper
+	srv.ltxMapper = store
 	srv.router = mux.NewRouter()
 	srv.router.Headers().HeadersRegexp("Content-Type", "text/css")
 	//	srv.router.Headers().HeadersRegexp("Content-Type", "text/(html|csv|javascript|plain)")
@@ -79,6 +83,5 @@ func Serve(dbname, port string) {
 		ReadTimeout:  15 * time.Second,
 	}
 	log.Printf("doxa api is listening on http://127.0.0.1:%s\n", port)
-	log.Printf("doxa db is at %s\n", dbname)
 	log.Fatal(srv.http.ListenAndServe())
 }
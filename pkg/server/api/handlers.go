@@ -1,14 +1,23 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/liturgiko/doxa/pkg/commemorations"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
 	"github.com/liturgiko/doxa/pkg/models"
+	"github.com/liturgiko/doxa/pkg/periods"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // handleHome provides path information in the event that the requester fails
@@ -18,6 +27,10 @@ func (s *server) handleHome() http.HandlerFunc {
 		fmt.Fprintf(w, "Add /id/library/topic/key to %s, e.g., id/gr_gr_cog/actors/Priest to view for specific key.", s.http.Addr)
 		fmt.Fprintf(w, "\nor\nAdd /id/topic/key to %s, e.g., id/actors/Priest to view for all libraries.", s.http.Addr)
 		fmt.Fprintf(w, "\nor\nAdd /topic/library/topic to %s, e.g., topic/gr_gr_cog/actors to view all keys for that library and topic.", s.http.Addr)
+		fmt.Fprintf(w, "\nor\nAdd /api/v1/search?q=query to %s, e.g., api/v1/search?q=\"have mercy\"&like=en_us_dedes/%%25 to search the values.", s.http.Addr)
+		fmt.Fprintf(w, "\nor\nAdd /api/v1/ldp?date=yyyy-mm-dd to %s, e.g., api/v1/ldp?date=2021-04-29&calendar=julian&rid=oc.*/ocVE.ApolTheotokionVM to view the liturgical day properties.", s.http.Addr)
+		fmt.Fprintf(w, "\nor\nAdd /api/v1/commemorations?date=yyyy-mm-dd to %s, e.g., api/v1/commemorations?date=2021-01-01&library=en_us_dedes to view who is commemorated.", s.http.Addr)
+		fmt.Fprintf(w, "\nor\nAdd /api/v1/periods?date=yyyy-mm-dd to %s, e.g., api/v1/periods?date=2021-04-07&library=gr_gr_cog to view the names of the period and day.", s.http.Addr)
 	}
 }
 // handleID returns the liturgical text that matches the requested library, topic, and key.
@@ -45,7 +58,10 @@ func (s *server) handleID(files ...string) http.HandlerFunc {
 		id = append(id, vars["topic"])
 		id = append(id, vars["key"])
 
-		rec, err := s.ltxMapper.ReadById(strings.Join(id, "~"))
+		rec, err := s.ltxMapper.ReadById(strings.Join(id, s.ltxMapper.IDDelimiter()))
+		if err == nil && rec == nil {
+			err = ltxstore.ErrNotFound
+		}
 		if err == nil {
 			recs := models.NewLtxArray()
 			recs.Append(rec)
@@ -88,6 +104,174 @@ func (s *server) handleTopic() http.HandlerFunc {
 	}
 }
 
+// handleSearchV1 returns, as json, the liturgical texts that match the full text query ?q=.
+// The optional queries are column (value, nnp, or nwp), like (e.g. gr_gr_cog/%), and limit.
+// The records are ordered best match first.
+func (s *server) handleSearchV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("charset", "utf-8")
+		values := r.URL.Query()
+		options := ltxstore.SearchOptions{
+			Column: values.Get("column"),
+			Like:   values.Get("like"),
+		}
+		if limit := values.Get("limit"); len(limit) > 0 {
+			l, err := strconv.Atoi(limit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("limit %s: %v", limit, err), http.StatusBadRequest)
+				return
+			}
+			options.Limit = l
+		}
+		recs, err := s.ltxMapper.Search(values.Get("q"), options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if recs == nil {
+			recs = []*models.Ltx{}
+		}
+		err = json.NewEncoder(w).Encode(recs)
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+// handleLdpV1 returns, as json, the liturgical day properties of the date ?date=yyyy-mm-dd (default is today).
+// The optional queries are calendar (gregorian or julian), mode, day, and mcday (the overrides),
+// and rid, once for each rid to resolve, e.g. rid=oc.*/ocVE.ApolTheotokionVM @Mode 3
+func (s *server) handleLdpV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("charset", "utf-8")
+		values := r.URL.Query()
+		t, calendarType, err := dateQuery(values)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var o ldp.Overrides
+		for name, value := range map[string]*int{"mode": &o.Mode, "day": &o.Day, "mcday": &o.MovableCycleDay} {
+			if v := values.Get(name); len(v) > 0 {
+				if *value, err = strconv.Atoi(v); err != nil {
+					http.Error(w, fmt.Sprintf("%s %s: %v", name, v, err), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		inspection, err := ldp.Inspect(t, calendarType, o, values["rid"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = json.NewEncoder(w).Encode(inspection)
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+// handleCommemorationsV1 returns, as json, the commemorations of the date ?date=yyyy-mm-dd (default is today),
+// for each library ?library= (default is all libraries).  The optional query calendar is gregorian or julian.
+func (s *server) handleCommemorationsV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("charset", "utf-8")
+		values := r.URL.Query()
+		t, calendarType, err := dateQuery(values)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := ldp.Compute(t, calendarType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		libraries := values["library"]
+		if len(libraries) == 0 {
+			if libraries, err = s.ltxMapper.Libraries(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		service := commemorations.NewService(s.ltxMapper)
+		days := []*commemorations.Day{}
+		for _, library := range libraries {
+			day, err := service.Lookup(&l, library)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			days = append(days, day)
+		}
+		err = json.NewEncoder(w).Encode(days)
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// handlePeriodsV1 returns, as json, the names of the periods and day of the date ?date=yyyy-mm-dd (default is today),
+// for each library ?library= (default is all libraries).  The optional query calendar is gregorian or julian,
+// and fallback is the library whose names are used for the keys a library does not have (see periods.Service).
+func (s *server) handlePeriodsV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("charset", "utf-8")
+		values := r.URL.Query()
+		t, calendarType, err := dateQuery(values)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := ldp.Compute(t, calendarType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		libraries := values["library"]
+		if len(libraries) == 0 {
+			if libraries, err = s.ltxMapper.Libraries(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		service := periods.NewService(s.ltxMapper)
+		service.Fallback = values.Get("fallback")
+		all := []*periods.Names{}
+		for _, library := range libraries {
+			names, err := service.Names(&l, library)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			all = append(all, names)
+		}
+		err = json.NewEncoder(w).Encode(all)
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// dateQuery returns the date of the query date=yyyy-mm-dd, or today, and the calendar type of the query calendar
+func dateQuery(values url.Values) (time.Time, calendarTypes.CalendarType, error) {
+	var err error
+	t := time.Now()
+	if date := values.Get("date"); len(date) > 0 {
+		if t, err = time.Parse("2006-01-02", date); err != nil {
+			return t, calendarTypes.Gregorian, fmt.Errorf("invalid date %s. Expected yyyy-mm-dd", date)
+		}
+	}
+	calendarType := calendarTypes.Gregorian
+	if calendar := values.Get("calendar"); len(calendar) > 0 {
+		if calendarType, err = ldp.ParseCalendarType(calendar); err != nil {
+			return t, calendarType, err
+		}
+	}
+	return t, calendarType, nil
+}
 func (s *server) handleHomeV1() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Greetings from version 1 of the api")
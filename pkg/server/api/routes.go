@@ -13,6 +13,10 @@ func (s *server) routes() {
 
 	// api version 1
 	s.api1.HandleFunc("/status", s.handleHomeV1())
+	s.api1.HandleFunc("/search", s.handleSearchV1()).Queries("q", "{q}").Methods("GET")
+	s.api1.HandleFunc("/ldp", s.handleLdpV1()).Methods("GET")
+	s.api1.HandleFunc("/commemorations", s.handleCommemorationsV1()).Methods("GET")
+	s.api1.HandleFunc("/periods", s.handlePeriodsV1()).Methods("GET")
 
 	// api version 2
 	s.api2.HandleFunc("/status", s.handleHomeV2())
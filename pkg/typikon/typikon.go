@@ -0,0 +1,321 @@
+/**
+Package typikon ranks the commemorations of a day, and chooses the variant of the services,
+using rules stored in the liturgical database.
+
+The rules of a typikon are the records of the topic typikon in a library, e.g. gr_gr_cog/typikon/annunciation.
+They are maintained as ares files, e.g. typikon_gr_GR_cog.ares, and loaded like any other ares file.
+The key of a record is the name of the rule, and the value is the rule, e.g.
+
+  annunciation = "menaion 03-25 rank 90 variant feast"
+  palmSunday = "pascha -7 rank 100 variant palmSunday"
+  triodionSunday = "sunday triodion rank 70"
+  annunciationPalmSunday = "when annunciation and palmSunday variant annunciationPalmSunday"
+
+A commemoration rule starts with when it is commemorated:
+  menaion MM-DD       the month and day of the fixed cycle, which follows the calendar type
+  pascha N            N days after (or, if negative, before) Pascha
+  season S            every day of the season S
+  DAY [S]             every DAY, e.g. sunday, or every DAY of the season S
+followed by rank N, where higher ranks take precedence, and optionally variant V,
+the variant of the services when it has the highest rank.
+The seasons are triodion, lent, holyweek, brightweek, and pentecostarion.
+
+A collision rule, when A and B ..., names commemorations, and is followed by variant V.
+It applies when all the named commemorations fall on the same day, and its variant
+is used instead of that of the commemoration with the highest rank.
+If several collision rules apply, the one naming the most commemorations is used.
+ */
+package typikon
+
+import (
+	"fmt"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Topic is the topic of the records that hold the rules of a typikon
+const Topic = "typikon"
+
+// Kinds of rules
+const (
+	KindMenaion = "menaion"
+	KindPascha  = "pascha"
+	KindSeason  = "season"
+	KindWeekday = "weekday"
+	KindWhen    = "when"
+)
+
+// Seasons are the seasons that rules can refer to
+var Seasons = []string{"triodion", "lent", "holyweek", "brightweek", "pentecostarion"}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Rule is a rule of a typikon
+type Rule struct {
+	Name    string
+	Kind    string
+	Month   int          // for KindMenaion
+	Day     int          // for KindMenaion, or for KindPascha, the days after Pascha
+	Weekday time.Weekday // for KindWeekday
+	Season  string       // for KindSeason, and optionally for KindWeekday
+	Names   []string     // for KindWhen, the commemorations that must fall on the same day, in lower case
+	Rank    int
+	Variant string
+}
+
+// ParseRule parses the text of the rule with the name
+func ParseRule(name, text string) (*Rule, error) {
+	r := &Rule{Name: name}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("typikon: rule %s is empty", name)
+	}
+	i := 1
+	arg := func() (string, error) {
+		if i >= len(fields) {
+			return "", fmt.Errorf("typikon: rule %s: missing value after %s", name, fields[i-1])
+		}
+		i++
+		return fields[i-1], nil
+	}
+	var err error
+	var s string
+	switch first := strings.ToLower(fields[0]); {
+	case first == KindMenaion:
+		r.Kind = KindMenaion
+		if s, err = arg(); err != nil {
+			return nil, err
+		}
+		var t time.Time
+		if t, err = time.Parse("01-02", s); err != nil {
+			return nil, fmt.Errorf("typikon: rule %s: %s is not MM-DD", name, s)
+		}
+		r.Month, r.Day = int(t.Month()), t.Day()
+	case first == KindPascha:
+		r.Kind = KindPascha
+		if s, err = arg(); err != nil {
+			return nil, err
+		}
+		if r.Day, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("typikon: rule %s: %s is not a number of days", name, s)
+		}
+	case first == KindSeason:
+		r.Kind = KindSeason
+		if s, err = arg(); err != nil {
+			return nil, err
+		}
+		r.Season = strings.ToLower(s)
+		if !isSeason(r.Season) {
+			return nil, fmt.Errorf("typikon: rule %s: unknown season %s, expected one of %v", name, r.Season, Seasons)
+		}
+	case first == KindWhen:
+		r.Kind = KindWhen
+		for {
+			if s, err = arg(); err != nil {
+				return nil, err
+			}
+			r.Names = append(r.Names, strings.ToLower(s))
+			if i >= len(fields) || strings.ToLower(fields[i]) != "and" {
+				break
+			}
+			i++
+		}
+	default:
+		weekday, ok := weekdays[first]
+		if !ok {
+			return nil, fmt.Errorf("typikon: rule %s: expected menaion, pascha, season, when, or a day of the week, but got %s", name, first)
+		}
+		r.Kind = KindWeekday
+		r.Weekday = weekday
+		if i < len(fields) && isSeason(strings.ToLower(fields[i])) {
+			r.Season = strings.ToLower(fields[i])
+			i++
+		}
+	}
+	hasRank := false
+	for i < len(fields) {
+		clause := strings.ToLower(fields[i])
+		i++
+		if s, err = arg(); err != nil {
+			return nil, err
+		}
+		switch clause {
+		case "rank":
+			if r.Rank, err = strconv.Atoi(s); err != nil {
+				return nil, fmt.Errorf("typikon: rule %s: rank %s is not a number", name, s)
+			}
+			hasRank = true
+		case "variant":
+			r.Variant = s
+		default:
+			return nil, fmt.Errorf("typikon: rule %s: expected rank or variant, but got %s", name, clause)
+		}
+	}
+	if r.Kind == KindWhen {
+		if hasRank {
+			return nil, fmt.Errorf("typikon: rule %s: a when rule cannot have a rank", name)
+		}
+		if len(r.Variant) == 0 {
+			return nil, fmt.Errorf("typikon: rule %s: a when rule must have a variant", name)
+		}
+	} else if !hasRank {
+		return nil, fmt.Errorf("typikon: rule %s: missing rank", name)
+	}
+	return r, nil
+}
+
+func isSeason(s string) bool {
+	for _, season := range Seasons {
+		if s == season {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules are the rules of a typikon
+type Rules struct {
+	Library        string
+	Commemorations []*Rule // sorted by name
+	Collisions     []*Rule // sorted by name
+}
+
+// ReadRules reads and parses the rules of the typikon in the library.
+// All the rules must be valid, and a when rule may only name commemoration rules.
+// A rule can redirect to a rule of another library.  Empty records are skipped.
+func ReadRules(store ltxstore.LtxStore, library string) (*Rules, error) {
+	records, err := store.ReadByLT(library, Topic, true)
+	if err != nil {
+		return nil, err
+	}
+	rules := &Rules{Library: library}
+	for _, record := range records {
+		text := record.Value
+		if len(record.Redirect) > 0 {
+			to, _, err := ltxstore.Resolve(store, record.ID)
+			if err != nil {
+				return nil, err
+			}
+			text = to.Value
+		}
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		r, err := ParseRule(record.Key, text)
+		if err != nil {
+			return nil, err
+		}
+		if r.Kind == KindWhen {
+			rules.Collisions = append(rules.Collisions, r)
+		} else {
+			rules.Commemorations = append(rules.Commemorations, r)
+		}
+	}
+	sort.Slice(rules.Commemorations, func(i, j int) bool { return rules.Commemorations[i].Name < rules.Commemorations[j].Name })
+	sort.Slice(rules.Collisions, func(i, j int) bool { return rules.Collisions[i].Name < rules.Collisions[j].Name })
+	names := make(map[string]bool)
+	for _, r := range rules.Commemorations {
+		names[strings.ToLower(r.Name)] = true
+	}
+	for _, r := range rules.Collisions {
+		for _, name := range r.Names {
+			if !names[name] {
+				return nil, fmt.Errorf("typikon: rule %s: %s is not a commemoration rule", r.Name, name)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Commemoration is a commemoration of a day, ranked by a rule
+type Commemoration struct {
+	Name    string `json:"name"`
+	Rank    int    `json:"rank"`
+	Variant string `json:"variant,omitempty"`
+}
+
+// Day is the result of evaluating the rules for a liturgical day
+type Day struct {
+	Date           string          `json:"date"`
+	Commemorations []Commemoration `json:"commemorations"` // the highest rank first
+	Variant        string          `json:"variant"`        // the variant of the services, or empty
+	VariantRule    string          `json:"variantRule"`    // the name of the rule that chose the variant
+}
+
+// Evaluate ranks the commemorations of the liturgical day, and chooses the variant of the services
+func (rules *Rules) Evaluate(l *ldp.LDP) *Day {
+	day := &Day{Date: l.TheDay.Format("2006-01-02")}
+	matched := make(map[string]bool)
+	for _, r := range rules.Commemorations {
+		if r.matches(l) {
+			matched[strings.ToLower(r.Name)] = true
+			day.Commemorations = append(day.Commemorations, Commemoration{Name: r.Name, Rank: r.Rank, Variant: r.Variant})
+		}
+	}
+	sort.SliceStable(day.Commemorations, func(i, j int) bool { return day.Commemorations[i].Rank > day.Commemorations[j].Rank })
+	for _, c := range day.Commemorations {
+		if len(c.Variant) > 0 {
+			day.Variant, day.VariantRule = c.Variant, c.Name
+			break
+		}
+	}
+	var collision *Rule
+	for _, r := range rules.Collisions {
+		applies := true
+		for _, name := range r.Names {
+			applies = applies && matched[name]
+		}
+		if applies && (collision == nil || len(r.Names) > len(collision.Names)) {
+			collision = r
+		}
+	}
+	if collision != nil {
+		day.Variant, day.VariantRule = collision.Variant, collision.Name
+	}
+	return day
+}
+
+// matches reports whether the commemoration rule applies to the liturgical day
+func (r *Rule) matches(l *ldp.LDP) bool {
+	switch r.Kind {
+	case KindMenaion:
+		return l.MenaionMonth == r.Month && l.MenaionDay == r.Day
+	case KindPascha:
+		return l.TheDay.Equal(l.PaschaDateThisYear.AddDate(0, 0, r.Day))
+	case KindSeason:
+		return inSeason(l, r.Season)
+	case KindWeekday:
+		return l.TheDay.Weekday() == r.Weekday && (len(r.Season) == 0 || inSeason(l, r.Season))
+	}
+	return false
+}
+
+// inSeason reports whether the liturgical day is in the season
+func inSeason(l *ldp.LDP, season string) bool {
+	d := int(l.TheDay.Sub(l.PaschaDateThisYear).Hours() / 24) // days since Pascha
+	switch season {
+	case "triodion":
+		return l.IsTriodion
+	case "lent":
+		return d >= -48 && d <= -9
+	case "holyweek":
+		return d >= -6 && d <= -1
+	case "brightweek":
+		return d >= 0 && d <= 6
+	case "pentecostarion":
+		return l.IsPentecostarion
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package typikon
+
+import (
+	"github.com/liturgiko/doxa/pkg/db/ltx2mem"
+	"github.com/liturgiko/doxa/pkg/enums/calendarTypes"
+	"github.com/liturgiko/doxa/pkg/ldp"
+	"github.com/liturgiko/doxa/pkg/models"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"menaion 13-01 rank 1",
+		"menaion 03-25",
+		"pascha x rank 1",
+		"season advent rank 1",
+		"someday rank 1",
+		"sunday rank",
+		"sunday rank 1 colour red",
+		"when a and b",
+		"when a and b rank 1 variant v",
+	} {
+		if _, err := ParseRule("r", text); err == nil {
+			t.Errorf("expected an error for '%s'", text)
+		}
+	}
+	r, err := ParseRule("r", "Sunday Triodion rank 70 variant triodionSunday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != KindWeekday || r.Season != "triodion" || r.Rank != 70 || r.Variant != "triodionSunday" {
+		t.Errorf("unexpected rule %+v", r)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	store := ltx2mem.NewLtxMapper()
+	library := "en_us_goa"
+	for key, value := range map[string]string{
+		"annunciation":           "menaion 03-25 rank 90 variant feast",
+		"holyThursday":           "pascha -3 rank 100 variant holyThursday",
+		"sunday":                 "sunday rank 10",
+		"triodionSunday":         "sunday triodion rank 70 variant triodionSunday",
+		"lent":                   "season lent rank 5",
+		"annunciationHoly":       "when annunciation and holyThursday variant annunciationHolyThursday",
+		"annunciationLentSunday": "when annunciation and triodionSunday variant annunciationSunday",
+	} {
+		store.Merge(models.NewLtx(library, Topic, key, value, "", ""))
+	}
+	rules, err := ReadRules(store, library)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		year, month, day int
+		calendarType     calendarTypes.CalendarType
+		first            string
+		count            int
+		variant          string
+	}{
+		{2021, 3, 25, calendarTypes.Gregorian, "annunciation", 2, "feast"},              // Thursday in Lent
+		{2018, 3, 25, calendarTypes.Gregorian, "annunciation", 4, "annunciationSunday"}, // Sunday in Lent
+		{2021, 4, 29, calendarTypes.Gregorian, "holyThursday", 1, "holyThursday"},       // Holy Thursday
+		{2021, 4, 7, calendarTypes.Julian, "annunciation", 2, "feast"},                  // Annunciation on the Old calendar
+		{2021, 4, 29, calendarTypes.Julian, "holyThursday", 1, "holyThursday"},          // Pascha does not depend on the calendar
+		{2024, 4, 7, calendarTypes.Julian, "annunciation", 4, "annunciationSunday"},     // Old calendar Annunciation on a Sunday in Lent
+		{2021, 7, 4, calendarTypes.Gregorian, "sunday", 1, ""},                          // an ordinary Sunday
+	}
+	for _, d := range data {
+		l, err := ldp.NewLDPYMD(d.year, d.month, d.day, d.calendarType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		day := rules.Evaluate(&l)
+		if len(day.Commemorations) != d.count || day.Commemorations[0].Name != d.first || day.Variant != d.variant {
+			t.Errorf("%s %s: unexpected %+v", day.Date, d.calendarType, day)
+		}
+	}
+	store.Merge(models.NewLtx("en_us_dedes", Topic, "annunciation", "", "", library+"/"+Topic+"/annunciation"))
+	store.Merge(models.NewLtx("en_us_dedes", Topic, "unused", "", "", ""))
+	if rules, err = ReadRules(store, "en_us_dedes"); err != nil {
+		t.Fatal(err)
+	} else if len(rules.Commemorations) != 1 || rules.Commemorations[0].Variant != "feast" {
+		t.Errorf("expected the redirected annunciation rule, got %+v", rules.Commemorations)
+	}
+	store.Merge(models.NewLtx(library, Topic, "bad", "when annunciation and pentecost variant v", "", ""))
+	if _, err = ReadRules(store, library); err == nil {
+		t.Errorf("expected an error for a when rule naming an unknown commemoration")
+	}
+}
@@ -5,11 +5,11 @@ package oslw
 
 import (
 	"bufio"
-	"database/sql"
 	"errors"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/liturgiko/doxa/pkg/ages/ares"
 	"github.com/liturgiko/doxa/pkg/db/ltx2sql"
+	"github.com/liturgiko/doxa/pkg/db/ltxstore"
 	"github.com/liturgiko/doxa/pkg/models"
 	"github.com/liturgiko/doxa/pkg/utils/ltfile"
 	"github.com/liturgiko/doxa/pkg/utils/ltstring"
@@ -54,26 +54,20 @@ func ParseOslwResource(id, value string) (ares.LineParts, error) {
 // and writes them to a database opened for the specified
 // dbName
 func Res2Sql(dir string, dbName string, logger *log.Logger) error {
-	var err error
-	var update = true // used to avoid updating record for gr_gr_cog if already exists
-
 	// prepare the database
-	var db *sql.DB
-	mapper := &ltx2sql.LtxMapper{}
-	db, err = sql.Open("sqlite3", dbName)
-	if err!= nil {
-		return err
-	}
-	defer db.Close()
-	err = db.Ping()
+	mapper, err := ltx2sql.NewLtxMapper(dbName)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(ltx2sql.SQLCreateTable)
-	if err!= nil {
-		return err
-	}
-	mapper.DB = db
+	defer mapper.Close()
+	return Res2Store(dir, mapper, logger)
+}
+
+// Reads all OSLW resource files in specified directory
+// and writes them to the specified store
+func Res2Store(dir string, mapper ltxstore.LtxStore, logger *log.Logger) error {
+	var err error
+	var update = true // used to avoid updating record for gr_gr_cog if already exists
 
 	// process the files
 	ext := "tex"
@@ -109,8 +103,9 @@ func Res2Sql(dir string, dbName string, logger *log.Logger) error {
 				ltx.Key = lineParts.Key
 				update = true
 				if strings.HasPrefix(ltx.ID, "gr_gr_cog") {
-					_, err = mapper.ReadById(ltx.ID)
-					update = err != nil
+					var rec *models.Ltx
+					rec, err = mapper.ReadById(ltx.ID)
+					update = err == nil && rec == nil
 				}
 				if update {
 					err = mapper.Merge(&ltx)